@@ -13,7 +13,6 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
-	"time"
 )
 
 // MNISTImageData represents the structure of each entry in mnistData.json
@@ -491,7 +490,9 @@ func GenerateModels(numModels int, inputSize, outputSize int, outputTypes []stri
 	// Generate and save models
 	for i := 0; i < numModels; i++ {
 		modelID := fmt.Sprintf("model_%d", i)
-		modelConfig := dense.CreateRandomNetworkConfig(inputSize, outputSize, outputTypes, modelID, projectName)
+		modelSeed := dense.NewSeed()
+		modelConfig := dense.CreateRandomNetworkConfig(inputSize, outputSize, outputTypes, modelID, projectName, dense.NewRand(modelSeed))
+		modelConfig.Metadata.Seed = modelSeed
 
 		// Serialize the model to JSON
 		modelFilePath := filepath.Join(modelDir, modelID+".json")
@@ -610,74 +611,76 @@ func processModel(modelFilePath, mnistDataFilePath string, percentageTrain float
 
 // Apply a random number of mutations to a model
 func applyRandomMutation(config *dense.NetworkConfig) {
-	mutations := []func(*dense.NetworkConfig){
-		/*func(c *dense.NetworkConfig) { dense.MutateCNNWeights(c, 0.1, 20) },
-		func(c *dense.NetworkConfig) { dense.MutateCNNBiases(c, 20, 0.1) },
-		func(c *dense.NetworkConfig) { dense.RandomizeCNNWeights(c, 20) },
-		func(c *dense.NetworkConfig) { dense.InvertCNNWeights(c, 20) },
-		func(c *dense.NetworkConfig) { dense.AddCNNLayerAtRandomPosition(c, 20) },
-		func(c *dense.NetworkConfig) { dense.MutateCNNFilterSize(c, 20) },       // Add mutation to CNN filter size
-		func(c *dense.NetworkConfig) { dense.MutateCNNStrideAndPadding(c, 20) }, // Add mutation to CNN stride and padding
-		func(c *dense.NetworkConfig) { dense.DuplicateCNNLayer(c, 20) },         // Add mutation to duplicate CNN layers
-		func(c *dense.NetworkConfig) { dense.AddMultipleCNNLayers(c, 20, 5) },   // Add multiple CNN layers*/
+	mutations := []func(*dense.NetworkConfig, *rand.Rand){
+		/*func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateCNNWeights(c, 0.1, 20, rng) },
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateCNNBiases(c, 20, 0.1, rng) },
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RandomizeCNNWeights(c, 20, rng) },
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertCNNWeights(c, 20, rng) },
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddCNNLayerAtRandomPosition(c, 20, rng) },
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateCNNFilterSize(c, 20, rng) },       // Add mutation to CNN filter size
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateCNNStrideAndPadding(c, 20, rng) }, // Add mutation to CNN stride and padding
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.DuplicateCNNLayer(c, 20, rng) },         // Add mutation to duplicate CNN layers
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddMultipleCNNLayers(c, 20, 5, rng) },   // Add multiple CNN layers*/
 
 
 		// FFNN mutations
-		/*func(c *dense.NetworkConfig) { dense.MutateWeights(c, 0.1, 20) },        // Mutate FFNN weights
-		func(c *dense.NetworkConfig) { dense.MutateBiases(c, 20, 0.1) },         // Mutate FFNN biases
-		func(c *dense.NetworkConfig) { dense.AddNeuron(c, 20) },                 // Add neuron to FFNN layer
-		func(c *dense.NetworkConfig) { dense.AddLayerFullConnections(c, 20) },   // Add fully connected FFNN layer
-		func(c *dense.NetworkConfig) { dense.RemoveNeuron(c, 20) },              // Remove neuron from FFNN layer
-		func(c *dense.NetworkConfig) { dense.RemoveLayer(c, 20) },               // Remove FFNN layer
-		func(c *dense.NetworkConfig) { dense.DuplicateNeuron(c, 20) },           // Duplicate neuron in FFNN layer
-		func(c *dense.NetworkConfig) { dense.MutateActivationFunctions(c, 20) }, // Mutate activation functions in FFNN
-		func(c *dense.NetworkConfig) { dense.AddLayerRandomPosition(c, 20) },    // Add FFNN layer at random position
-		func(c *dense.NetworkConfig) { dense.ShuffleLayers(c, 20) },             // Shuffle layers in FFNN
-		func(c *dense.NetworkConfig) { dense.InvertWeights(c, 20) },             // Invert FFNN weights
-		func(c *dense.NetworkConfig) { dense.SplitNeuron(c, 20) },               // Split neuron in FFNN*/
+		/*func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateWeights(c, 0.1, 20, rng) },        // Mutate FFNN weights
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateBiases(c, 20, 0.1, rng) },         // Mutate FFNN biases
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddNeuron(c, 20, rng) },                 // Add neuron to FFNN layer
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLayerFullConnections(c, 20, rng) },   // Add fully connected FFNN layer
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RemoveNeuron(c, 20, rng) },              // Remove neuron from FFNN layer
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RemoveLayer(c, 20, rng) },               // Remove FFNN layer
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.DuplicateNeuron(c, 20, rng) },           // Duplicate neuron in FFNN layer
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateActivationFunctions(c, 20, rng) }, // Mutate activation functions in FFNN
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLayerRandomPosition(c, 20, rng) },    // Add FFNN layer at random position
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.ShuffleLayers(c, 20, rng) },             // Shuffle layers in FFNN
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertWeights(c, 20, rng) },             // Invert FFNN weights
+		func(c *dense.NetworkConfig, rng *rand.Rand) { dense.SplitNeuron(c, 20, rng) },               // Split neuron in FFNN*/
 
 		 // FFNN mutations
-		 func(c *dense.NetworkConfig) { dense.MutateWeights(c, 0.1, 20) },              // Mutate FFNN weights
-		 func(c *dense.NetworkConfig) { dense.AddNeuron(c, 20) },                       // Add neuron to FFNN layer
-		 func(c *dense.NetworkConfig) { dense.AddLayerFullConnections(c, 20) },         // Add fully connected FFNN layer
-		 func(c *dense.NetworkConfig) { dense.AddLayer(c, 20) },                        // Add layer with sparse connections
-		 func(c *dense.NetworkConfig) { dense.AddLayerRandomPosition(c, 20) },          // Add FFNN layer at random position
-		 func(c *dense.NetworkConfig) { dense.MutateActivationFunctions(c, 20) },       // Mutate activation functions in FFNN
-		 func(c *dense.NetworkConfig) { dense.RemoveNeuron(c, 20) },                    // Remove neuron from FFNN layer
-		 func(c *dense.NetworkConfig) { dense.RemoveLayer(c, 20) },                     // Remove FFNN layer
-		 func(c *dense.NetworkConfig) { dense.DuplicateNeuron(c, 20) },                 // Duplicate neuron in FFNN layer
-		 func(c *dense.NetworkConfig) { dense.MutateBiases(c, 20, 0.1) },               // Mutate FFNN biases
-		 func(c *dense.NetworkConfig) { dense.RandomizeWeights(c, 20) },                // Randomize FFNN weights
-		 func(c *dense.NetworkConfig) { dense.SplitNeuron(c, 20) },                     // Split neuron in FFNN
-		 func(c *dense.NetworkConfig) { dense.SwapLayerActivations(c, 20) },            // Swap layer activations in FFNN
-		 func(c *dense.NetworkConfig) { dense.ShuffleLayerConnections(c, 20) },         // Shuffle connections within layers in FFNN
-		 func(c *dense.NetworkConfig) { dense.ShuffleLayers(c, 20) },                   // Shuffle layers in FFNN
-		 func(c *dense.NetworkConfig) { dense.AddMultipleLayers(c, 20) },               // Add multiple random layers to FFNN
-		 func(c *dense.NetworkConfig) { dense.DoubleLayers(c, 20) },                    // Double the number of layers in FFNN
-		 func(c *dense.NetworkConfig) { dense.MirrorLayersTopToBottom(c, 20) },         // Mirror layers from top to bottom in FFNN
-		 func(c *dense.NetworkConfig) { dense.MirrorEdgesSideToSide(c, 20) },           // Mirror connections in each layer from side to side
-		 func(c *dense.NetworkConfig) { dense.InvertWeights(c, 20) },                   // Invert weights in FFNN
-		 func(c *dense.NetworkConfig) { dense.InvertBiases(c, 20) },                    // Invert biases in FFNN
-		 func(c *dense.NetworkConfig) { dense.InvertActivationFunctions(c, 20) },       // Invert activation functions in FFNN
-		 func(c *dense.NetworkConfig) { dense.InvertConnections(c, 20) },               // Invert connections in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateWeights(c, 0.1, 20, rng) },              // Mutate FFNN weights
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddNeuron(c, 20, rng) },                       // Add neuron to FFNN layer
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLayerFullConnections(c, 20, rng) },         // Add fully connected FFNN layer
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLayer(c, 20, rng) },                        // Add layer with sparse connections
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLayerRandomPosition(c, 20, rng) },          // Add FFNN layer at random position
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateActivationFunctions(c, 20, rng) },       // Mutate activation functions in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RemoveNeuron(c, 20, rng) },                    // Remove neuron from FFNN layer
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RemoveLayer(c, 20, rng) },                     // Remove FFNN layer
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.DuplicateNeuron(c, 20, rng) },                 // Duplicate neuron in FFNN layer
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateBiases(c, 20, 0.1, rng) },               // Mutate FFNN biases
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RandomizeWeights(c, 20, rng) },                // Randomize FFNN weights
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.SplitNeuron(c, 20, rng) },                     // Split neuron in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.SwapLayerActivations(c, 20, rng) },            // Swap layer activations in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.ShuffleLayerConnections(c, 20, rng) },         // Shuffle connections within layers in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.ShuffleLayers(c, 20, rng) },                   // Shuffle layers in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddMultipleLayers(c, 20, rng) },               // Add multiple random layers to FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.DoubleLayers(c, 20, rng) },                    // Double the number of layers in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MirrorLayersTopToBottom(c, 20, rng) },         // Mirror layers from top to bottom in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MirrorEdgesSideToSide(c, 20, rng) },           // Mirror connections in each layer from side to side
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertWeights(c, 20, rng) },                   // Invert weights in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertBiases(c, 20, rng) },                    // Invert biases in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertActivationFunctions(c, 20, rng) },       // Invert activation functions in FFNN
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertConnections(c, 20, rng) },               // Invert connections in FFNN
 	 
 		 // LSTM mutations
-		 func(c *dense.NetworkConfig) { dense.MutateLSTMCells(c, 20) },                 // Mutate LSTM cells
-		 func(c *dense.NetworkConfig) { dense.AddLSTMLayerAtRandomPosition(c, 20) },    // Add LSTM layer at random position
-		 func(c *dense.NetworkConfig) { dense.InvertLSTMWeights(c, 20) },               // Invert LSTM weights
-		 func(c *dense.NetworkConfig) { dense.RandomizeLSTMWeights(c, 20) },            // Randomize LSTM weights
-		 func(c *dense.NetworkConfig) { dense.MutateLSTMBiases(c, 20, 0.1) },           // Mutate LSTM biases
-		 func(c *dense.NetworkConfig) { dense.MutateLSTMWeights(c, 0.1, 20) },          // Mutate LSTM weights
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateLSTMCells(c, 20, rng) },                 // Mutate LSTM cells
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.AddLSTMLayerAtRandomPosition(c, 20, rng) },    // Add LSTM layer at random position
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.InvertLSTMWeights(c, 20, rng) },               // Invert LSTM weights
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.RandomizeLSTMWeights(c, 20, rng) },            // Randomize LSTM weights
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateLSTMBiases(c, 20, 0.1, rng) },           // Mutate LSTM biases
+		 func(c *dense.NetworkConfig, rng *rand.Rand) { dense.MutateLSTMWeights(c, 0.1, 20, rng) },          // Mutate LSTM weights
 	}
 
+	// Mutations draw from the model's own seed so they can be replayed
+	rng := dense.MutationRand(config)
+
 	// Select a random number of mutations between 1 and 5
-	rand.Seed(time.Now().UnixNano())
-	numMutations := rand.Intn(5) + 1 // Random number from 1 to 5
+	numMutations := rng.Intn(5) + 1 // Random number from 1 to 5
 
 	// Apply the random number of mutations
 	for i := 0; i < numMutations; i++ {
-		mutation := mutations[rand.Intn(len(mutations))] // Randomly select a mutation
-		mutation(config)
+		mutation := mutations[rng.Intn(len(mutations))] // Randomly select a mutation
+		mutation(config, rng)
 	}
 
 	//fmt.Printf("Applied %d mutations to the model.\n", numMutations)
@@ -736,6 +739,8 @@ func EvolveNextGeneration(currentGenDir, nextGenDir string, numModels int, topPe
 				continue
 			}
 
+			modelConfig.Metadata.Path = modelFilePath
+
 			// Evaluate the model if not already evaluated
 			if modelConfig.Metadata.LastTestAccuracy == 0 {
 				accuracy, err := EvaluateModel(mnistDataFilePath, modelConfig, percentageTrain)
@@ -763,13 +768,17 @@ func EvolveNextGeneration(currentGenDir, nextGenDir string, numModels int, topPe
 	// Number of top models to select
 	topCount := int(float64(numModels) * topPercentage)
 
+	// Model IDs are prefixed with the generation so they stay unique across generations
+	generationName := filepath.Base(nextGenDir)
+
 	// 1. Copy the top 10% without mutations to the next generation
 	for i := 0; i < topCount; i++ {
 		modelID := fmt.Sprintf("model_%d", i)
 		modelFilePath := filepath.Join(nextGenDir, modelID+".json")
 
-		// Load the model from the current generation
-		modelConfig := models[i]
+		// Copy the model from the current generation
+		modelConfig, _ := dense.SpawnChild(models[i], i, fmt.Sprintf("gen%s_%s", generationName, modelID))
+		dense.LinkParentChild(models[i], modelConfig)
 
 		// Reset the LastTestAccuracy
 		// modelConfig.Metadata.LastTestAccuracy = 0.0
@@ -787,14 +796,15 @@ func EvolveNextGeneration(currentGenDir, nextGenDir string, numModels int, topPe
 	index := topCount
 	for i := 0; i < topCount; i++ {
 		for j := 0; j < mutationCountPerTopModel; j++ {
-			// Reload the top model from the current generation
-			modelConfig := models[i]
+			// Copy the top model from the current generation
+			modelID := fmt.Sprintf("model_%d", index)
+			modelConfig, _ := dense.SpawnChild(models[i], index, fmt.Sprintf("gen%s_%s", generationName, modelID))
+			dense.LinkParentChild(models[i], modelConfig)
 
 			// Apply random mutation
 			applyRandomMutation(modelConfig)
 
 			// Save the mutated model into the next generation folder
-			modelID := fmt.Sprintf("model_%d", index)
 			modelFilePath := filepath.Join(nextGenDir, modelID+".json")
 			modelConfig.Metadata.LastTestAccuracy = 0.0
 			if err := saveModel(modelFilePath, modelConfig); err != nil {
@@ -807,14 +817,16 @@ func EvolveNextGeneration(currentGenDir, nextGenDir string, numModels int, topPe
 
 	// If we have any remaining models to fill (because of rounding issues)
 	for index < numModels {
-		// Reload additional models from the top ones
-		modelConfig := models[index%topCount]
+		// Copy additional models from the top ones
+		modelID := fmt.Sprintf("model_%d", index)
+		parent := models[index%topCount]
+		modelConfig, _ := dense.SpawnChild(parent, index, fmt.Sprintf("gen%s_%s", generationName, modelID))
+		dense.LinkParentChild(parent, modelConfig)
 
 		// Apply random mutation
 		applyRandomMutation(modelConfig)
 
 		// Save the model with mutation to the next generation
-		modelID := fmt.Sprintf("model_%d", index)
 		modelFilePath := filepath.Join(nextGenDir, modelID+".json")
 		if err := saveModel(modelFilePath, modelConfig); err != nil {
 			return fmt.Errorf("failed to save mutated model: %v", err)
@@ -823,6 +835,13 @@ func EvolveNextGeneration(currentGenDir, nextGenDir string, numModels int, topPe
 		index++
 	}
 
+	// Save the parents so they list their children as well
+	for _, parent := range models[:topCount] {
+		if err := saveModel(parent.Metadata.Path, parent); err != nil {
+			log.Printf("Failed to update parent model %s: %v", parent.Metadata.Path, err)
+		}
+	}
+
 	log.Printf("Successfully created generation %s with %d models.", nextGenDir, numModels)
 	return nil
 }
@@ -844,51 +863,53 @@ func findTopModels(models []*dense.NetworkConfig, topPercentage float64) []*dens
 }
 
 func OLDmain() {
-	rand.Seed(time.Now().UnixNano())
+	seed := dense.NewSeed()
+	fmt.Printf("Using seed %d\n", seed)
+	rng := dense.NewRand(seed)
 
 	// Test 1: FFNN + CNN Model
 	fmt.Println("Test 1: FFNN + CNN Model")
 
 	// Create a model configuration with FFNN and CNN layers
-	config1 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "ffnn_cnn_test", "FFNN + CNN Test")
-	addConvLayer(config1)
-	addDenseLayer(config1)
+	config1 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "ffnn_cnn_test", "FFNN + CNN Test", rng)
+	addConvLayer(config1, rng)
+	addDenseLayer(config1, rng)
 
 	// Apply CNN mutations
-	applyCNNMutations(config1)
+	applyCNNMutations(config1, rng)
 
 	// Test 2: CNN + LSTM Model
 	fmt.Println("\nTest 2: CNN + LSTM Model")
 
 	// Create a model configuration with CNN and LSTM layers
-	config2 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "cnn_lstm_test", "CNN + LSTM Test")
-	addConvLayer(config2)
-	addLSTMLayer(config2)
+	config2 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "cnn_lstm_test", "CNN + LSTM Test", rng)
+	addConvLayer(config2, rng)
+	addLSTMLayer(config2, rng)
 
 	// Apply CNN mutations
-	applyCNNMutations(config2)
+	applyCNNMutations(config2, rng)
 
 	// Test 3: CNN + LSTM + CNN Model
 	fmt.Println("\nTest 3: CNN + LSTM + CNN Model")
 
 	// Create a model configuration with CNN, LSTM, and CNN layers
-	config3 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "cnn_lstm_cnn_test", "CNN + LSTM + CNN Test")
-	addConvLayer(config3)
-	addLSTMLayer(config3)
-	addConvLayer(config3)
+	config3 := dense.CreateRandomNetworkConfig(3, 1, []string{"relu"}, "cnn_lstm_cnn_test", "CNN + LSTM + CNN Test", rng)
+	addConvLayer(config3, rng)
+	addLSTMLayer(config3, rng)
+	addConvLayer(config3, rng)
 
 	// Apply CNN mutations
-	applyCNNMutations(config3)
+	applyCNNMutations(config3, rng)
 }
 
 // Adds a CNN layer to the config
-func addConvLayer(config *dense.NetworkConfig) {
+func addConvLayer(config *dense.NetworkConfig, rng *rand.Rand) {
 	newLayer := dense.Layer{
 		LayerType: "conv",
 		Filters: []dense.Filter{
 			{
-				Weights: dense.Random2DSlice(3, 3),
-				Bias:    rand.Float64(),
+				Weights: dense.Random2DSlice(3, 3, rng),
+				Bias:    rng.Float64(),
 			},
 		},
 		Stride:  1,
@@ -899,16 +920,16 @@ func addConvLayer(config *dense.NetworkConfig) {
 }
 
 // Adds an LSTM layer to the config
-func addLSTMLayer(config *dense.NetworkConfig) {
+func addLSTMLayer(config *dense.NetworkConfig, rng *rand.Rand) {
 	newLayer := dense.Layer{
 		LayerType: "lstm",
 		LSTMCells: []dense.LSTMCell{
 			{
-				InputWeights:  dense.RandomSlice(3),
-				ForgetWeights: dense.RandomSlice(3),
-				OutputWeights: dense.RandomSlice(3),
-				CellWeights:   dense.RandomSlice(3),
-				Bias:          rand.Float64(),
+				InputWeights:  dense.RandomSlice(3, rng),
+				ForgetWeights: dense.RandomSlice(3, rng),
+				OutputWeights: dense.RandomSlice(3, rng),
+				CellWeights:   dense.RandomSlice(3, rng),
+				Bias:          rng.Float64(),
 			},
 		},
 	}
@@ -917,18 +938,18 @@ func addLSTMLayer(config *dense.NetworkConfig) {
 }
 
 // Adds a Dense layer to the config
-func addDenseLayer(config *dense.NetworkConfig) {
+func addDenseLayer(config *dense.NetworkConfig, rng *rand.Rand) {
 	newLayer := dense.Layer{
 		LayerType: "dense",
 		Neurons: map[string]dense.Neuron{
 			"hidden1": {
 				ActivationType: "relu",
 				Connections: map[string]dense.Connection{
-					"input0": {Weight: rand.Float64()},
-					"input1": {Weight: rand.Float64()},
-					"input2": {Weight: rand.Float64()},
+					"input0": {Weight: rng.Float64()},
+					"input1": {Weight: rng.Float64()},
+					"input2": {Weight: rng.Float64()},
 				},
-				Bias: rand.Float64(),
+				Bias: rng.Float64(),
 			},
 		},
 	}
@@ -937,29 +958,29 @@ func addDenseLayer(config *dense.NetworkConfig) {
 }
 
 // Apply CNN mutations to the network
-func applyCNNMutations(config *dense.NetworkConfig) {
+func applyCNNMutations(config *dense.NetworkConfig, rng *rand.Rand) {
 	fmt.Println("Applying MutateCNNWeights...")
-	dense.MutateCNNWeights(config, 0.01, 20)
+	dense.MutateCNNWeights(config, 0.01, 20, rng)
 
 	printCNNLayer(config)
 
 	fmt.Println("Applying MutateCNNBiases...")
-	dense.MutateCNNBiases(config, 20, 0.01)
+	dense.MutateCNNBiases(config, 20, 0.01, rng)
 
 	printCNNLayer(config)
 
 	fmt.Println("Applying RandomizeCNNWeights...")
-	dense.RandomizeCNNWeights(config, 20)
+	dense.RandomizeCNNWeights(config, 20, rng)
 
 	printCNNLayer(config)
 
 	fmt.Println("Applying InvertCNNWeights...")
-	dense.InvertCNNWeights(config, 20)
+	dense.InvertCNNWeights(config, 20, rng)
 
 	printCNNLayer(config)
 
 	fmt.Println("Applying AddCNNLayerAtRandomPosition...")
-	dense.AddCNNLayerAtRandomPosition(config, 20)
+	dense.AddCNNLayerAtRandomPosition(config, 20, rng)
 
 	printCNNLayer(config)
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"dense"
+)
+
+func main() {
+	// Setup command-line flags
+	modelPath := flag.String("model", "best_model.json", "Model to compress")
+	outPath := flag.String("out", "compressed_model.json", "Where to write the compressed model")
+	dataPath := flag.String("data", "test_data.json", "MNIST data saved with dense.SaveMNIST, used for probes and the accuracy check")
+	numProbes := flag.Int("probes", 200, "Images used to detect dead neurons and identity layers")
+	numEval := flag.Int("eval", 1000, "Images used to check accuracy after each pass")
+	threshold := flag.Float64("threshold", 0.01, "Remove connections with a smaller absolute weight (0 to skip)")
+	deadTolerance := flag.Float64("dead-tol", 1e-9, "Activation spread under which a neuron counts as constant")
+	identityTolerance := flag.Float64("identity-tol", 1e-9, "Difference under which a layer counts as identity")
+	maxDrop := flag.Float64("max-drop", 0.005, "Largest accuracy drop a pass may cause before it is rolled back")
+	flag.Parse()
+
+	config, err := dense.LoadNetworkFromFile(*modelPath)
+	if err != nil {
+		fmt.Println("Error loading model:", err)
+		return
+	}
+	data, err := dense.LoadMNIST(*dataPath)
+	if err != nil {
+		fmt.Println("Error loading data:", err)
+		return
+	}
+
+	var probes []map[string]interface{}
+	for i := 0; i < *numProbes && i < len(data.Images); i++ {
+		probes = append(probes, imageToInputs(data.Images[i]))
+	}
+	if len(probes) == 0 {
+		fmt.Println("Error: no probe images, -probes must be positive and the data must not be empty")
+		os.Exit(1)
+	}
+	evalData := &dense.MNISTData{Images: data.Images, Labels: data.Labels}
+	if len(evalData.Images) > *numEval {
+		evalData.Images = evalData.Images[:*numEval]
+		evalData.Labels = evalData.Labels[:*numEval]
+	}
+
+	inputShape := dense.InputShape{Values: len(probes[0])}
+	before := dense.SummarizeModel(config, inputShape)
+
+	report, err := dense.Prune(config, dense.PruneOptions{
+		MagnitudeThreshold: *threshold,
+		Probes:             probes,
+		DeadTolerance:      *deadTolerance,
+		IdentityTolerance:  *identityTolerance,
+		MaxAccuracyDrop:    *maxDrop,
+		Evaluate: func(c *dense.NetworkConfig) float64 {
+			return evaluateAccuracy(c, evalData)
+		},
+	})
+	if err != nil {
+		fmt.Println("Error pruning model:", err)
+		return
+	}
+	fmt.Print(dense.FormatPruneReport(report))
+
+	after := dense.SummarizeModel(config, inputShape)
+	after.ModelID += " (compressed)"
+	dense.PrintSummaryComparison(os.Stdout, []*dense.ModelSummary{before, after})
+
+	if err := dense.SaveNetworkToFile(config, *outPath); err != nil {
+		fmt.Println("Error saving compressed model:", err)
+		return
+	}
+	fmt.Printf("Saved compressed model to %s\n", *outPath)
+}
+
+// imageToInputs scales an MNIST image into the input map the models expect.
+func imageToInputs(image []byte) map[string]interface{} {
+	input := make(map[string]interface{}, len(image))
+	for j, pixel := range image {
+		input[fmt.Sprintf("input%d", j)] = float64(pixel) / 255.0
+	}
+	return input
+}
+
+// evaluateAccuracy is the fraction of images whose highest output matches the label.
+func evaluateAccuracy(config *dense.NetworkConfig, mnist *dense.MNISTData) float64 {
+	if len(mnist.Images) == 0 {
+		return 0
+	}
+	correct := 0
+	for i, image := range mnist.Images {
+		outputs := dense.Feedforward(config, imageToInputs(image))
+		predictedDigit := 0
+		highestProb := 0.0
+		for k := 0; k < 10; k++ {
+			if prob, ok := outputs[fmt.Sprintf("output%d", k)]; ok && prob > highestProb {
+				highestProb = prob
+				predictedDigit = k
+			}
+		}
+		if predictedDigit == int(mnist.Labels[i]) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(mnist.Images))
+}
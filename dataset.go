@@ -0,0 +1,184 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Sample is one example of a dataset.
+type Sample struct {
+	ID      string                        // Names the input in layer state caches and learnedornot folders
+	Inputs  func() map[string]interface{} // Loads the inputs; only called when no cached state can be used
+	Targets map[string]float64            // Expected output per output neuron ID
+}
+
+// Dataset is a set of samples the engine can evaluate models on and save layer states for.
+type Dataset interface {
+	Len() int
+	Sample(i int) Sample
+}
+
+// SliceDataset is a dataset held in memory.
+type SliceDataset []Sample
+
+func (d SliceDataset) Len() int            { return len(d) }
+func (d SliceDataset) Sample(i int) Sample { return d[i] }
+
+// NewSliceDataset pairs inputs with their targets. Sample i gets the ID <name>_<i>, so datasets whose
+// states are saved in the same generation need different names.
+func NewSliceDataset(name string, inputs []map[string]interface{}, targets []map[string]float64) (SliceDataset, error) {
+	if len(inputs) != len(targets) {
+		return nil, fmt.Errorf("%d inputs but %d targets", len(inputs), len(targets))
+	}
+	name = SafeSampleID(name)
+	dataset := make(SliceDataset, len(inputs))
+	for i := range inputs {
+		values := inputs[i]
+		dataset[i] = Sample{ID: fmt.Sprintf("%s_%d", name, i), Inputs: func() map[string]interface{} { return values }, Targets: targets[i]}
+	}
+	return dataset, nil
+}
+
+// MNISTDataset is the list of images SaveMNISTImagesAndData writes, read from ImgDir. Images are
+// identified by file name, escaped with SafeSampleID, and their targets are OutputMap, or the one-hot
+// encoding of Label over the 10 digits when it isn't set. The IDs aren't prefixed with a dataset name:
+// SaveMNISTImagesAndData numbers every image it writes into one folder, so file names are already unique,
+// and names like "img12.jpg" pass through unchanged, keeping existing caches and learnedornot folders valid.
+type MNISTDataset struct {
+	ImgDir string
+	Images []ImageData
+}
+
+// NewMNISTDataset returns the dataset of images stored in imgDir.
+func NewMNISTDataset(imgDir string, images []ImageData) *MNISTDataset {
+	return &MNISTDataset{ImgDir: imgDir, Images: images}
+}
+
+// LoadMNISTDataset reads the image list written by SaveMNISTImagesAndData.
+func LoadMNISTDataset(dataFile, imgDir string) (*MNISTDataset, error) {
+	data, err := os.ReadFile(dataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MNIST data file: %w", err)
+	}
+	var images []ImageData
+	if err := json.Unmarshal(data, &images); err != nil {
+		return nil, fmt.Errorf("failed to decode MNIST data file: %w", err)
+	}
+	return NewMNISTDataset(imgDir, images), nil
+}
+
+func (d *MNISTDataset) Len() int { return len(d.Images) }
+
+func (d *MNISTDataset) Sample(i int) Sample {
+	image := d.Images[i]
+	targets := image.OutputMap
+	if targets == nil {
+		targets = OneHotOutputs(image.Label, 10)
+	}
+	return Sample{
+		ID:      SafeSampleID(image.FileName),
+		Inputs:  func() map[string]interface{} { return ConvertImageToInputs(filepath.Join(d.ImgDir, image.FileName)) },
+		Targets: targets,
+	}
+}
+
+// ImageFolderDataset holds JPEG images sorted into one subdirectory per class. Classes are numbered in
+// name order and targets are one-hot over them; samples are identified by the root's base name and their
+// path below it, escaped with SafeSampleID, e.g. "train%2Fcat%2F1.jpg".
+type ImageFolderDataset struct {
+	Root    string
+	Classes []string
+	files   []string
+	labels  []int
+}
+
+// LoadImageFolder lists the images under root.
+func LoadImageFolder(root string) (*ImageFolderDataset, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image folder: %w", err)
+	}
+	d := &ImageFolderDataset{Root: root}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			d.Classes = append(d.Classes, entry.Name())
+		}
+	}
+	sort.Strings(d.Classes)
+
+	for label, class := range d.Classes {
+		files, err := os.ReadDir(filepath.Join(root, class))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read class folder %s: %w", class, err)
+		}
+		for _, file := range files {
+			ext := strings.ToLower(filepath.Ext(file.Name()))
+			if file.IsDir() || (ext != ".jpg" && ext != ".jpeg") {
+				continue
+			}
+			d.files = append(d.files, filepath.Join(class, file.Name()))
+			d.labels = append(d.labels, label)
+		}
+	}
+	return d, nil
+}
+
+func (d *ImageFolderDataset) Len() int { return len(d.files) }
+
+func (d *ImageFolderDataset) Sample(i int) Sample {
+	file := d.files[i]
+	return Sample{
+		ID:      SafeSampleID(filepath.Base(d.Root) + "/" + filepath.ToSlash(file)),
+		Inputs:  func() map[string]interface{} { return ConvertImageToInputs(filepath.Join(d.Root, file)) },
+		Targets: OneHotOutputs(d.labels[i], len(d.Classes)),
+	}
+}
+
+// LoadCSVDataset reads a CSV file whose header names the neurons: columns starting with "output" are
+// targets and the others are inputs. Every value must be a number. Rows are identified as in
+// LoadTabularDataset. Use LoadTabularDataset to map, encode or normalize columns.
+func LoadCSVDataset(filePath string) (SliceDataset, error) {
+	dataset, _, err := LoadTabularDataset(filePath, []TabularColumn{
+		{Match: "output*", Output: true, Missing: MissingError},
+		{Match: "*", Missing: MissingError},
+	})
+	return dataset, err
+}
+
+// DatasetName is the name a file's samples are identified by: its base name without the extension,
+// made safe with SafeSampleID.
+func DatasetName(filePath string) string {
+	base := filepath.Base(filePath)
+	return SafeSampleID(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// SafeSampleID escapes an ID so it can be part of a file name, as layer state and learnedornot files
+// are named after sample IDs. Letters, digits, '.', '-' and '_' are kept and every other byte becomes
+// %XX, so different IDs stay different.
+func SafeSampleID(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// OneHotOutputs returns the targets of a classification label: output<label> is 1 and the other
+// output<i> below numClasses are 0.
+func OneHotOutputs(label, numClasses int) map[string]float64 {
+	outputs := make(map[string]float64, numClasses)
+	for i := 0; i < numClasses; i++ {
+		outputs[fmt.Sprintf("output%d", i)] = 0
+	}
+	outputs[fmt.Sprintf("output%d", label)] = 1
+	return outputs
+}
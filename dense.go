@@ -48,14 +48,19 @@ type Layer struct {
 
 // ModelMetadata holds metadata for the model.
 type ModelMetadata struct {
-	ModelID              string   `json:"modelID"`
-	ProjectName          string   `json:"projectName"`
-	LastTrainingAccuracy float64  `json:"lastTrainingAccuracy"`
-	LastTestAccuracy     float64  `json:"lastTestAccuracy"`
-	Path                 string   `json:"path"`
-	Evaluated            bool     `json:"evaluated"`      // Field to track if the model has been evaluated
-	ParentModelIDs       []string `json:"parentModelIDs"` // Field to track multiple parent models
-	ChildModelIDs        []string `json:"childModelIDs"`  // Field to track child models
+	ModelID              string           `json:"modelID"`
+	ProjectName          string           `json:"projectName"`
+	LastTrainingAccuracy float64          `json:"lastTrainingAccuracy"`
+	LastTestAccuracy     float64          `json:"lastTestAccuracy"`
+	Path                 string           `json:"path"`
+	Evaluated            bool             `json:"evaluated"`                // Field to track if the model has been evaluated
+	ParentModelIDs       []string         `json:"parentModelIDs"`           // Field to track multiple parent models
+	ChildModelIDs        []string         `json:"childModelIDs"`            // Field to track child models
+	MutationPolicy       *MutationPolicy  `json:"mutationPolicy,omitempty"` // Policy used to mutate this model
+	Seed                 int64            `json:"seed"`                     // Seed the model was created or mutated with
+	Lineage              []MutationRecord `json:"lineage,omitempty"`        // Mutations applied since the model was created
+	LineageDropped       int              `json:"lineageDropped,omitempty"` // Oldest lineage records dropped to stay within MaxLineageLength
+	Objectives           *ModelObjectives `json:"objectives,omitempty"`     // Multi-objective scores and Pareto ranking
 }
 
 
@@ -592,7 +597,7 @@ func dotProduct(a []float64, b []float64) float64 {
 }
 
 // CreateRandomNetworkConfig dynamically generates a network with specified input and output sizes and allows dynamic configuration of output neurons.
-func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes []string, modelID, projectName string) *NetworkConfig {
+func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes []string, modelID, projectName string, rng *rand.Rand) *NetworkConfig {
 	config := &NetworkConfig{
 		Metadata: ModelMetadata{
 			ModelID:             modelID,
@@ -622,11 +627,11 @@ func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes
 					Connections: func() map[string]Connection {
 						connections := make(map[string]Connection)
 						for i := 0; i < numInputs; i++ {
-							connections["input"+strconv.Itoa(i)] = Connection{Weight: rand.Float64()}
+							connections["input"+strconv.Itoa(i)] = Connection{Weight: rng.Float64()}
 						}
 						return connections
 					}(),
-					Bias: rand.Float64(),
+					Bias: rng.Float64(),
 				},
 			},
 		},
@@ -636,11 +641,11 @@ func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes
 			Filters: []Filter{
 				{
 					Weights: [][]float64{
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
 					},
-					Bias: rand.Float64(),
+					Bias: rng.Float64(),
 				},
 			},
 			Stride:  1,
@@ -651,11 +656,11 @@ func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes
 			LayerType: "lstm",
 			LSTMCells: []LSTMCell{
 				{
-					InputWeights:  RandomSlice(numInputs),
-					ForgetWeights: RandomSlice(numInputs),
-					OutputWeights: RandomSlice(numInputs),
-					CellWeights:   RandomSlice(numInputs),
-					Bias:          rand.Float64(),
+					InputWeights:  RandomSlice(numInputs, rng),
+					ForgetWeights: RandomSlice(numInputs, rng),
+					OutputWeights: RandomSlice(numInputs, rng),
+					CellWeights:   RandomSlice(numInputs, rng),
+					Bias:          rng.Float64(),
 				},
 			},
 		},*/
@@ -676,9 +681,9 @@ func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes
 		config.Layers.Output.Neurons[neuronID] = Neuron{
 			ActivationType: activationType,
 			Connections: map[string]Connection{
-				"hidden1": {Weight: rand.Float64()},
+				"hidden1": {Weight: rng.Float64()},
 			},
-			Bias: rand.Float64(),
+			Bias: rng.Float64(),
 		}
 	}
 
@@ -687,7 +692,7 @@ func CreateRandomNetworkConfig(numInputs, numOutputs int, outputActivationTypes
 
 // CreateCustomNetworkConfig dynamically generates a network with specified input and output sizes,
 // allows dynamic configuration of the first layer's neurons, and the output neurons.
-func CreateCustomNetworkConfig(numInputs, numFirstLayerNeurons, numOutputs int, outputActivationTypes []string, modelID, projectName string) *NetworkConfig {
+func CreateCustomNetworkConfig(numInputs, numFirstLayerNeurons, numOutputs int, outputActivationTypes []string, modelID, projectName string, rng *rand.Rand) *NetworkConfig {
     config := &NetworkConfig{
         Metadata: ModelMetadata{
             ModelID:             modelID,
@@ -722,11 +727,11 @@ func CreateCustomNetworkConfig(numInputs, numFirstLayerNeurons, numOutputs int,
             Connections: func() map[string]Connection {
                 connections := make(map[string]Connection)
                 for j := 0; j < numInputs; j++ {
-                    connections["input"+strconv.Itoa(j)] = Connection{Weight: rand.Float64()}
+                    connections["input"+strconv.Itoa(j)] = Connection{Weight: rng.Float64()}
                 }
                 return connections
             }(),
-            Bias: rand.Float64(),
+            Bias: rng.Float64(),
         }
     }
 
@@ -746,12 +751,12 @@ func CreateCustomNetworkConfig(numInputs, numFirstLayerNeurons, numOutputs int,
             ActivationType: activationType,
             Connections: func() map[string]Connection {
                 connections := make(map[string]Connection)
-                for hiddenNeuronID := range config.Layers.Hidden[0].Neurons {
-                    connections[hiddenNeuronID] = Connection{Weight: rand.Float64()}
+                for _, hiddenNeuronID := range sortedKeys(config.Layers.Hidden[0].Neurons) {
+                    connections[hiddenNeuronID] = Connection{Weight: rng.Float64()}
                 }
                 return connections
             }(),
-            Bias: rand.Float64(),
+            Bias: rng.Float64(),
         }
     }
 
@@ -759,7 +764,7 @@ func CreateCustomNetworkConfig(numInputs, numFirstLayerNeurons, numOutputs int,
 }
 
 // AdjustOutputLayer dynamically sets the connections for the output layer based on the last hidden layer.
-func AdjustOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTypes []string) {
+func AdjustOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTypes []string, rng *rand.Rand) {
     // Get the last hidden layer
     lastHiddenLayer := config.Layers.Hidden[len(config.Layers.Hidden)-1]
 
@@ -786,12 +791,12 @@ func AdjustOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTy
                 connections := make(map[string]Connection)
 
                 // Connect to every neuron in the last hidden layer
-                for hiddenNeuronID := range lastHiddenLayer.Neurons {
-                    connections[hiddenNeuronID] = Connection{Weight: rand.Float64()}
+                for _, hiddenNeuronID := range sortedKeys(lastHiddenLayer.Neurons) {
+                    connections[hiddenNeuronID] = Connection{Weight: rng.Float64()}
                 }
                 return connections
             }(),
-            Bias: rand.Float64(),
+            Bias: rng.Float64(),
         }
     }
 
@@ -801,7 +806,7 @@ func AdjustOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTy
 }
 
 // ReattachOutputLayer connects the output layer to the last hidden layer
-func ReattachOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTypes []string) {
+func ReattachOutputLayer(config *NetworkConfig, numOutputs int, outputActivationTypes []string, rng *rand.Rand) {
     lastHiddenLayer := config.Layers.Hidden[len(config.Layers.Hidden)-1]
 
     // Reset the output layer
@@ -819,14 +824,14 @@ func ReattachOutputLayer(config *NetworkConfig, numOutputs int, outputActivation
         }
 
         connections := make(map[string]Connection)
-        for hiddenNeuronID := range lastHiddenLayer.Neurons {
-            connections[hiddenNeuronID] = Connection{Weight: rand.Float64() - 0.5} // Initialize weights around 0
+        for _, hiddenNeuronID := range sortedKeys(lastHiddenLayer.Neurons) {
+            connections[hiddenNeuronID] = Connection{Weight: rng.Float64() - 0.5} // Initialize weights around 0
         }
 
         config.Layers.Output.Neurons[neuronID] = Neuron{
             ActivationType: activationType,
             Connections:    connections,
-            Bias:           rand.Float64() - 0.5, // Initialize biases around 0
+            Bias:           rng.Float64() - 0.5, // Initialize biases around 0
         }
     }
 
@@ -838,10 +843,10 @@ func ReattachOutputLayer(config *NetworkConfig, numOutputs int, outputActivation
 
 
 
-func RandomSlice(length int) []float64 {
+func RandomSlice(length int, rng *rand.Rand) []float64 {
 	slice := make([]float64, length)
 	for i := range slice {
-		slice[i] = rand.Float64()
+		slice[i] = rng.Float64()
 	}
 	return slice
 }
@@ -876,6 +881,13 @@ func DeepCopy(config *NetworkConfig) *NetworkConfig {
 	// Deep copy output layer
 	newConfig.Layers.Output = deepCopyLayer(config.Layers.Output)
 
+	// The lineage is appended to per model, so it must not share a backing array
+	newConfig.Metadata.Lineage = append([]MutationRecord(nil), config.Metadata.Lineage...)
+	if config.Metadata.Objectives != nil {
+		objectives := *config.Metadata.Objectives
+		newConfig.Metadata.Objectives = &objectives
+	}
+
 	return newConfig
 }
 
@@ -885,8 +897,8 @@ func deepCopyLayer(layer Layer) Layer {
     }
     
     switch layer.LayerType {
-    case "dense":
-        // Ensure the neurons and connections are deep copied
+    case "dense", "":
+        // Ensure the neurons and connections are deep copied (untyped layers hold neurons too)
         newLayer.Neurons = make(map[string]Neuron)
         for key, neuron := range layer.Neurons {
             newNeuron := Neuron{
@@ -19,15 +19,11 @@ type ImageData struct {
     OutputMap map[string]float64 `json:"output_map"`
 }
 
-// TestData is a generalized interface for different types of test data.
-type TestData interface {
-	GetInputs() map[string]interface{} // Convert data to a format suitable for feeding into the model
-	GetLabel() int                     // Get the label or expected output for comparison
-}
-
 
 
-func GenerateModelsIfNotExist(modelDir string, numModels, inputSize, outputSize int, outputTypes []string, projectName string) error {
+// GenerateModelsIfNotExist creates numModels random models in modelDir. Each model gets a seed
+// derived from seed, so the same seed regenerates the same models.
+func GenerateModelsIfNotExist(modelDir string, numModels, inputSize, outputSize int, outputTypes []string, projectName string, seed int64) error {
     // Create the directory to store the models
     if err := os.MkdirAll(modelDir, os.ModePerm); err != nil {
         return fmt.Errorf("failed to create model directory: %w", err)
@@ -39,7 +35,9 @@ func GenerateModelsIfNotExist(modelDir string, numModels, inputSize, outputSize
 
         // Define the number of neurons in the first layer
         firstLayerNeurons := 128
-        modelConfig := CreateCustomNetworkConfig(inputSize, firstLayerNeurons, outputSize, outputTypes, modelID, projectName)
+        modelSeed := DeriveSeed(seed, i)
+        modelConfig := CreateCustomNetworkConfig(inputSize, firstLayerNeurons, outputSize, outputTypes, modelID, projectName, NewRand(modelSeed))
+        modelConfig.Metadata.Seed = modelSeed
 
         // Serialize the model to JSON
         modelFilePath := filepath.Join(modelDir, modelID+".json")
@@ -62,12 +60,15 @@ func GenerateModelsIfNotExist(modelDir string, numModels, inputSize, outputSize
 }
 
 // SaveLayerStates processes the models in the generation directory and saves layer states for the input data.
-func SaveLayerStates(generationDir string, data *[]interface{}, imgDir string) {
+// States live in the generation's shared activation cache, so a model whose leading layers match a model
+// processed before resumes from the deepest shared prefix; each model's layer refers to its cache shard.
+func SaveLayerStates(generationDir string, data Dataset) {
     files, err := ioutil.ReadDir(generationDir)
     if err != nil {
         fmt.Printf("Failed to read models directory: %v\n", err)
         return
     }
+    cache := NewActivationCache(generationDir)
 
     // Get the number of available CPU cores and create a semaphore based on this number
     numCores := runtime.NumCPU()
@@ -94,21 +95,21 @@ func SaveLayerStates(generationDir string, data *[]interface{}, imgDir string) {
         }
 
         layerStateNumber := GetLastHiddenLayerIndex(modelConfig)
-
-        // Construct the shard folder path inside the model's folder
-        modelFolderPath := filepath.Join(generationDir, modelName)
-        shardFolderPath := filepath.Join(modelFolderPath, fmt.Sprintf("layer_%d_shards", layerStateNumber))
-
-        // Check if the shard folder for this layer already exists
-        if _, err := os.Stat(shardFolderPath); !os.IsNotExist(err) {
-            fmt.Printf("Shard folder for layer %d already exists in model %s, skipping...\n", layerStateNumber, modelName)
+        if layerStateNumber < 0 {
+            fmt.Printf("Model %s has no hidden layers, skipping...\n", modelName)
             continue
         }
 
-        // Create the shard folder if it doesn't exist
-        err = os.MkdirAll(shardFolderPath, os.ModePerm)
+        prefixHashes, err := LayerPrefixHashes(modelConfig)
         if err != nil {
-            fmt.Printf("Failed to create shard folder in model %s: %v\n", modelName, err)
+            fmt.Printf("Failed to hash layers of model %s: %v\n", modelName, err)
+            continue
+        }
+
+        // Point the model's layer at the cache shard of its prefix, so the states are stored only once
+        lastHash := prefixHashes[layerStateNumber]
+        if err := SaveLayerShardRef(filePath, layerStateNumber, lastHash); err != nil {
+            fmt.Printf("Failed to save layer state reference in model %s: %v\n", modelName, err)
             continue
         }
 
@@ -116,44 +117,26 @@ func SaveLayerStates(generationDir string, data *[]interface{}, imgDir string) {
         var wg sync.WaitGroup
 
         // Loop through the data and launch a goroutine for each item
-        for _, v := range *data {
+        for i := 0; i < data.Len(); i++ {
             semaphore <- struct{}{} // Acquire a semaphore slot
             wg.Add(1)
 
             // Launch a goroutine for each data item
-            go func(d interface{}) {
+            go func(sample Sample) {
                 defer wg.Done()
                 defer func() { <-semaphore }() // Release semaphore slot when done
 
-                var inputs map[string]interface{}
-                var inputID string
-
-                // Handle the type of data
-                switch d := d.(type) {
-                case ImageData:
-                    inputs = ConvertImageToInputs(filepath.Join(imgDir, d.FileName)) // Convert image to input values
-                    inputID = d.FileName
-                    fmt.Println(d.Label)
-                default:
-                    fmt.Printf("Unknown data type: %T\n", d)
+                // Skip inputs this model or a sibling with the same prefix already saved
+                if cache.Has(lastHash, sample.ID) {
                     return
                 }
 
-                // Construct the path to check if the shard for this input already exists in the model's shard folder
-                shardFilePath := filepath.Join(shardFolderPath, fmt.Sprintf("input_%s.csv", inputID))
-
-                // Check if the shard already exists for this input
-                if _, err := os.Stat(shardFilePath); err == nil {
-                    fmt.Printf("Shard already exists for input %s, skipping...\n", inputID)
-                    return
+                // Compute the layer state from the deepest cached prefix
+                if _, _, err := cache.LayerState(modelConfig, prefixHashes, layerStateNumber, sample.ID, sample.Inputs); err != nil {
+                    fmt.Printf("Failed to compute layer state for input %s: %v\n", sample.ID, err)
                 }
 
-                // Run Feedforward and save the layer state if it doesn't exist
-                outputPredicted, layerState := FeedforwardLayerStateSavingShard(modelConfig, inputs, layerStateNumber, filePath)
-                _ = outputPredicted
-                SaveShardedLayerState(layerState, filePath, layerStateNumber, inputID)
-
-            }(v)
+            }(data.Sample(i))
         }
 
         // Wait for all goroutines to finish
@@ -169,12 +152,15 @@ func SaveLayerStates(generationDir string, data *[]interface{}, imgDir string) {
 
 
 
-func EvaluateModelAccuracyFromLayerState(generationDir string, data *[]interface{}, imgDir string) {
+// EvaluateModelAccuracyFromLayerState evaluates the models in the generation directory, resuming every input
+// from the deepest hidden layer state in the generation's activation cache.
+func EvaluateModelAccuracyFromLayerState(generationDir string, data Dataset) {
     files, err := ioutil.ReadDir(generationDir)
     if err != nil {
         fmt.Printf("Failed to read models directory: %v\n", err)
         return
     }
+    cache := NewActivationCache(generationDir)
 
     // Get the number of available CPU cores and create a semaphore based on this number
     numCores := runtime.NumCPU()
@@ -207,13 +193,9 @@ func EvaluateModelAccuracyFromLayerState(generationDir string, data *[]interface
 
         layerStateNumber := GetLastHiddenLayerIndex(modelConfig)
 
-        // Construct the shard folder path inside the model's folder
-        modelFolderPath := filepath.Join(generationDir, modelName)
-        shardFolderPath := filepath.Join(modelFolderPath, fmt.Sprintf("layer_%d_shards", layerStateNumber))
-
-        // Check if the shard folder for this layer exists
-        if _, err := os.Stat(shardFolderPath); os.IsNotExist(err) {
-            fmt.Printf("Shard folder for layer %d does not exist in model %s, skipping...\n", layerStateNumber, modelName)
+        prefixHashes, err := LayerPrefixHashes(modelConfig)
+        if err != nil {
+            fmt.Printf("Failed to hash layers of model %s: %v\n", modelName, err)
             continue
         }
 
@@ -224,58 +206,35 @@ func EvaluateModelAccuracyFromLayerState(generationDir string, data *[]interface
         var wg sync.WaitGroup
 
         // This will store the results (0 or 1) for each data item
-        results := make(chan int, len(*data))
+        results := make(chan int, data.Len())
 
         // Loop through the data and launch a goroutine for each item
-        for _, v := range *data {
+        for i := 0; i < data.Len(); i++ {
             semaphore <- struct{}{} // Acquire a semaphore slot
             wg.Add(1)
 
-            go func(d interface{}) {
+            go func(sample Sample) {
                 defer wg.Done()
                 defer func() { <-semaphore }() // Release semaphore slot when done
 
-                var inputID string
-                var actualOutput map[string]float64
-
-                // Handle the type of data with type assertion
-                switch d := d.(type) {
-                case ImageData:
-                    inputID = d.FileName
-                    actualOutput = d.OutputMap
-                default:
-                    fmt.Printf("Unknown data type: %T\n", d)
+                // Run the evaluation starting from the deepest cached layer state
+                result, _, err := cache.Feedforward(modelConfig, prefixHashes, sample.ID, sample.Inputs)
+                if err != nil {
+                    fmt.Printf("Failed to evaluate input ID %s: %v. Skipping.\n", sample.ID, err)
                     return
                 }
 
-                // Construct the path to the shard file
-                shardFilePath := filepath.Join(shardFolderPath, fmt.Sprintf("input_%s.csv", inputID))
-
-                // Check if the shard file exists
-                if _, err := os.Stat(shardFilePath); err == nil {
-                    
-                    // Load the saved layer state from the shard file
-                    savedLayerData := LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
-                    if savedLayerData == nil {
-                        fmt.Printf("No saved layer data for input ID %s. Skipping.\n", inputID)
-                        return
-                    }
-
-                    // Run the evaluation starting from the saved layer state
-                    result := ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
-                    
-                    // Compare the results and store the prediction status
-                    isCorrect := CompareOutputs(result, actualOutput)
-                    if isCorrect {
-                        results <- 1
-                    } else {
-                        results <- 0
-                    }
-
-                    // Save the learned status (true if correct, false if incorrect)
-                    SaveLearnedOrNot(learnedOrNotFolder, inputID, isCorrect)
+                // Compare the results and store the prediction status
+                isCorrect := CompareOutputs(result, sample.Targets)
+                if isCorrect {
+                    results <- 1
+                } else {
+                    results <- 0
                 }
-            }(v)
+
+                // Save the learned status (true if correct, false if incorrect)
+                SaveLearnedOrNot(learnedOrNotFolder, sample.ID, isCorrect)
+            }(data.Sample(i))
         }
 
         // Wait for all goroutines to finish
@@ -284,7 +243,7 @@ func EvaluateModelAccuracyFromLayerState(generationDir string, data *[]interface
 
         // Tally up the correct results
         totalCorrect := 0
-        totalData := len(*data)
+        totalData := data.Len()
 
         for res := range results {
             totalCorrect += res
@@ -333,14 +292,19 @@ func CompareOutputs(predicted, actual map[string]float64) bool {
 
 
 
-func EvaluateSingleModelAccuracy(modelConfig *NetworkConfig, data *[]interface{}, layerStateNumber int, generationDir string) (float64, error) {
+// EvaluateSingleModelAccuracy evaluates a model from the layer states in the generation's activation cache.
+// Only inputs with a cached state at layerStateNumber or deeper along the model's own layers are evaluated.
+func EvaluateSingleModelAccuracy(modelConfig *NetworkConfig, data Dataset, layerStateNumber int, generationDir string) (float64, error) {
     modelName := modelConfig.Metadata.ModelID
-    modelFolderPath := filepath.Join(generationDir, modelName)
-    shardFolderPath := filepath.Join(modelFolderPath, fmt.Sprintf("layer_%d_shards", layerStateNumber))
-
-    // Check if the shard folder for this layer exists
-    if _, err := os.Stat(shardFolderPath); os.IsNotExist(err) {
-        return 0, fmt.Errorf("Shard folder for layer %d does not exist in model %s", layerStateNumber, modelName)
+    cache := NewActivationCache(generationDir)
+    cache.Mapped = MappedLayerStates // Many children are evaluated against the same cached layers
+    cache.ReadOnly = true // Children's own layers would only grow the cache
+    prefixHashes, err := LayerPrefixHashes(modelConfig)
+    if err != nil {
+        return 0, fmt.Errorf("failed to hash layers of model %s: %w", modelName, err)
+    }
+    if layerStateNumber < 0 || layerStateNumber >= len(prefixHashes) {
+        return 0, fmt.Errorf("model %s has no hidden layer %d", modelName, layerStateNumber)
     }
 
     // Get the number of available CPU cores and create a semaphore based on this number
@@ -350,51 +314,37 @@ func EvaluateSingleModelAccuracy(modelConfig *NetworkConfig, data *[]interface{}
     var wg sync.WaitGroup
 
     // Channel to store the evaluation results (0 for incorrect, 1 for correct)
-    results := make(chan int, len(*data))
+    results := make(chan int, data.Len())
 
     // Loop through the data and launch a goroutine for each item
-    for _, v := range *data {
+    for i := 0; i < data.Len(); i++ {
         semaphore <- struct{}{} // Acquire a semaphore slot
         wg.Add(1)
 
-        go func(d interface{}) {
+        go func(sample Sample) {
             defer wg.Done()
             defer func() { <-semaphore }() // Release semaphore slot when done
 
-            var inputID string
-            var actualOutput map[string]float64
+            inputID := sample.ID
 
-            // Handle the type of data with type assertion
-            switch d := d.(type) {
-            case ImageData:
-                inputID = d.FileName
-                actualOutput = d.OutputMap
-            default:
-                fmt.Printf("Unknown data type: %T\n", d)
+            // Only inputs whose state at layerStateNumber can be rebuilt from the cache are evaluated
+            if cache.DeepestCachedLayer(prefixHashes, inputID, len(prefixHashes)-1) < layerStateNumber {
                 return
             }
 
-            // Construct the path to the shard file
-            shardFilePath := filepath.Join(shardFolderPath, fmt.Sprintf("input_%s.csv", inputID))
-
-            // Check if the shard file exists
-            if _, err := os.Stat(shardFilePath); err == nil {
-                // Load the saved layer state from the shard file
-                savedLayerData := LoadShardedLayerState(modelFolderPath, layerStateNumber, inputID)
-                if savedLayerData == nil {
-                    fmt.Printf("No saved layer data for input ID %s. Skipping.\n", inputID)
-                    return
-                }
-
-                // Run the evaluation starting from the saved layer state
-                result := ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
-                if CompareOutputs(result, actualOutput) {
-                    results <- 1
-                } else {
-                    results <- 0
-                }
+            // Run the evaluation starting from the deepest cached layer state
+            // The check above means a state is cached, so the inputs are only loaded in verification mode
+            result, _, err := cache.Feedforward(modelConfig, prefixHashes, inputID, sample.Inputs)
+            if err != nil {
+                fmt.Printf("No saved layer data for input ID %s: %v. Skipping.\n", inputID, err)
+                return
+            }
+            if CompareOutputs(result, sample.Targets) {
+                results <- 1
+            } else {
+                results <- 0
             }
-        }(v)
+        }(data.Sample(i))
     }
 
     // Wait for all goroutines to finish
@@ -403,7 +353,7 @@ func EvaluateSingleModelAccuracy(modelConfig *NetworkConfig, data *[]interface{}
 
     // Tally up the correct results
     totalCorrect := 0
-    totalData := len(*data)
+    totalData := data.Len()
 
     for res := range results {
         totalCorrect += res
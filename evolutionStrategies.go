@@ -0,0 +1,415 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// MaxCMADimensions caps the number of parameters CMA-ES accepts; its covariance matrix grows with the
+// square and each eigendecomposition with the cube.
+const MaxCMADimensions = 500
+
+// ESOptions configures OptimizeOpenAIES and OptimizeCMAES.
+type ESOptions struct {
+	Generations  int
+	Population   int     // OpenAI-ES: antithetic pairs per generation; CMA-ES: offspring, at least 2, 0 for the default
+	Sigma        float64 // Initial perturbation size
+	LearningRate float64 // OpenAI-ES step size
+	Workers      int     // Parallel evaluations, defaults to the number of CPUs
+	Seed         int64
+
+	// Evaluate returns the fitness of a model, higher is better.
+	Evaluate func(config *NetworkConfig) float64
+	// OnGeneration is called after each generation with the best fitness so far and the generation's mean.
+	OnGeneration func(generation int, best, mean float64)
+}
+
+// ESResult is the outcome of an evolution strategies run.
+type ESResult struct {
+	BestFitness float64
+	Evaluations int
+}
+
+// OptimizeOpenAIES tunes the model's weights with OpenAI-style evolution strategies: each generation
+// evaluates antithetic pairs theta +/- sigma*eps, estimates the gradient from centred fitness ranks and
+// takes a step. The topology is left alone. The best parameters seen are written back into config.
+func OptimizeOpenAIES(config *NetworkConfig, opts ESOptions) (*ESResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Population <= 0 {
+		opts.Population = 25
+	}
+
+	rng := NewRand(opts.Seed)
+	theta := FlattenParameters(config)
+	n := len(theta)
+	best := append([]float64(nil), theta...)
+	result := &ESResult{BestFitness: opts.Evaluate(config), Evaluations: 1}
+
+	for gen := 0; gen < opts.Generations; gen++ {
+		noise := make([][]float64, opts.Population)
+		candidates := make([][]float64, 0, 2*opts.Population)
+		for i := range noise {
+			eps := make([]float64, n)
+			plus := make([]float64, n)
+			minus := make([]float64, n)
+			for k := range eps {
+				eps[k] = rng.NormFloat64()
+				plus[k] = theta[k] + opts.Sigma*eps[k]
+				minus[k] = theta[k] - opts.Sigma*eps[k]
+			}
+			noise[i] = eps
+			candidates = append(candidates, plus, minus)
+		}
+
+		fitness := evaluateParameterVectors(config, candidates, opts)
+		result.Evaluations += len(candidates)
+		mean := 0.0
+		for i, f := range fitness {
+			mean += f / float64(len(fitness))
+			if f > result.BestFitness {
+				result.BestFitness = f
+				copy(best, candidates[i])
+			}
+		}
+
+		// Centred ranks make the step independent of the fitness scale
+		ranks := centredRanks(fitness)
+		scale := opts.LearningRate / (float64(opts.Population) * opts.Sigma)
+		for i, eps := range noise {
+			weight := (ranks[2*i] - ranks[2*i+1]) * scale
+			for k := range theta {
+				theta[k] += weight * eps[k]
+			}
+		}
+
+		if opts.OnGeneration != nil {
+			opts.OnGeneration(gen, result.BestFitness, mean)
+		}
+	}
+
+	// The final mean may beat every sample that was evaluated
+	thetaFitness := evaluateParameterVectors(config, [][]float64{theta}, opts)[0]
+	result.Evaluations++
+	if thetaFitness > result.BestFitness {
+		result.BestFitness = thetaFitness
+		best = theta
+	}
+	if err := SetParameters(config, best); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OptimizeCMAES tunes the weights of a small model with CMA-ES, adapting a full covariance matrix over
+// the flattened parameters. Models with more than MaxCMADimensions parameters are rejected; use
+// OptimizeOpenAIES for those. The best parameters seen are written back into config.
+func OptimizeCMAES(config *NetworkConfig, opts ESOptions) (*ESResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	mean := FlattenParameters(config)
+	n := len(mean)
+	if n == 0 {
+		return nil, fmt.Errorf("model has no parameters to optimize")
+	}
+	if n > MaxCMADimensions {
+		return nil, fmt.Errorf("model has %d parameters, CMA-ES is limited to %d", n, MaxCMADimensions)
+	}
+
+	// Strategy parameters as recommended by Hansen's tutorial
+	lambda := opts.Population
+	if lambda <= 0 {
+		lambda = 4 + int(3*math.Log(float64(n)))
+	}
+	if lambda < 2 {
+		return nil, fmt.Errorf("CMA-ES needs a population of at least 2 to recombine, got %d", lambda)
+	}
+	mu := lambda / 2
+	weights := make([]float64, mu)
+	weightSum := 0.0
+	for i := range weights {
+		weights[i] = math.Log(float64(mu)+0.5) - math.Log(float64(i+1))
+		weightSum += weights[i]
+	}
+	squares := 0.0
+	for i := range weights {
+		weights[i] /= weightSum
+		squares += weights[i] * weights[i]
+	}
+	mueff := 1 / squares
+	nf := float64(n)
+	cc := (4 + mueff/nf) / (nf + 4 + 2*mueff/nf)
+	cs := (mueff + 2) / (nf + mueff + 5)
+	c1 := 2 / ((nf+1.3)*(nf+1.3) + mueff)
+	cmu := math.Min(1-c1, 2*(mueff-2+1/mueff)/((nf+2)*(nf+2)+mueff))
+	damps := 1 + 2*math.Max(0, math.Sqrt((mueff-1)/(nf+1))-1) + cs
+	chiN := math.Sqrt(nf) * (1 - 1/(4*nf) + 1/(21*nf*nf))
+
+	sigma := opts.Sigma
+	pc := make([]float64, n)
+	ps := make([]float64, n)
+	cov := identityMatrix(n)
+	basis := identityMatrix(n) // Eigenvectors of cov, as columns
+	scales := make([]float64, n)
+	for i := range scales {
+		scales[i] = 1 // Square roots of the eigenvalues
+	}
+	// Decompose the covariance only every few generations, as Hansen suggests; it changes slowly
+	eigenEvery := int(1 / ((c1 + cmu) * nf * 10))
+	if eigenEvery < 1 {
+		eigenEvery = 1
+	}
+
+	rng := NewRand(opts.Seed)
+	best := append([]float64(nil), mean...)
+	result := &ESResult{BestFitness: opts.Evaluate(config), Evaluations: 1}
+
+	for gen := 0; gen < opts.Generations; gen++ {
+		// Sample x = m + sigma * B * D * z
+		candidates := make([][]float64, lambda)
+		steps := make([][]float64, lambda)
+		for i := range candidates {
+			scaled := make([]float64, n)
+			for k := range scaled {
+				scaled[k] = scales[k] * rng.NormFloat64()
+			}
+			y := matVec(basis, scaled)
+			x := make([]float64, n)
+			for k := range x {
+				x[k] = mean[k] + sigma*y[k]
+			}
+			candidates[i], steps[i] = x, y
+		}
+
+		fitness := evaluateParameterVectors(config, candidates, opts)
+		result.Evaluations += lambda
+		order := make([]int, lambda)
+		generationMean := 0.0
+		for i := range order {
+			order[i] = i
+			generationMean += fitness[i] / float64(lambda)
+			if fitness[i] > result.BestFitness {
+				result.BestFitness = fitness[i]
+				copy(best, candidates[i])
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool { return fitness[order[a]] > fitness[order[b]] })
+
+		// Recombine the best mu steps into the new mean
+		stepMean := make([]float64, n)
+		for i := 0; i < mu; i++ {
+			for k := range stepMean {
+				stepMean[k] += weights[i] * steps[order[i]][k]
+			}
+		}
+		for k := range mean {
+			mean[k] += sigma * stepMean[k]
+		}
+
+		// Evolution paths; ps uses C^(-1/2) * stepMean = B * D^-1 * B^T * stepMean
+		whitened := matTVec(basis, stepMean)
+		for k := range whitened {
+			whitened[k] /= scales[k]
+		}
+		whitened = matVec(basis, whitened)
+		psNorm := 0.0
+		for k := range ps {
+			ps[k] = (1-cs)*ps[k] + math.Sqrt(cs*(2-cs)*mueff)*whitened[k]
+			psNorm += ps[k] * ps[k]
+		}
+		psNorm = math.Sqrt(psNorm)
+		hsig := 0.0
+		if psNorm/math.Sqrt(1-math.Pow(1-cs, float64(2*(gen+1))))/chiN < 1.4+2/(nf+1) {
+			hsig = 1
+		}
+		for k := range pc {
+			pc[k] = (1-cc)*pc[k] + hsig*math.Sqrt(cc*(2-cc)*mueff)*stepMean[k]
+		}
+
+		// Rank-one and rank-mu covariance update
+		for r := 0; r < n; r++ {
+			for c := 0; c <= r; c++ {
+				rankMu := 0.0
+				for i := 0; i < mu; i++ {
+					step := steps[order[i]]
+					rankMu += weights[i] * step[r] * step[c]
+				}
+				value := (1-c1-cmu)*cov[r][c] +
+					c1*(pc[r]*pc[c]+(1-hsig)*cc*(2-cc)*cov[r][c]) +
+					cmu*rankMu
+				cov[r][c], cov[c][r] = value, value
+			}
+		}
+		sigma *= math.Exp((cs / damps) * (psNorm/chiN - 1))
+
+		if (gen+1)%eigenEvery == 0 {
+			eigenvalues, eigenvectors := symmetricEigen(cov)
+			for k, value := range eigenvalues {
+				scales[k] = math.Sqrt(math.Max(value, 1e-20))
+			}
+			basis = eigenvectors
+		}
+
+		if opts.OnGeneration != nil {
+			opts.OnGeneration(gen, result.BestFitness, generationMean)
+		}
+	}
+
+	if err := SetParameters(config, best); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// validate checks the options shared by both optimizers.
+func (opts *ESOptions) validate() error {
+	if opts.Evaluate == nil {
+		return fmt.Errorf("evolution strategies need an evaluation function")
+	}
+	if opts.Sigma <= 0 {
+		return fmt.Errorf("sigma must be positive")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	return nil
+}
+
+// evaluateParameterVectors evaluates each parameter vector on its own copy of the model, in parallel.
+func evaluateParameterVectors(config *NetworkConfig, vectors [][]float64, opts ESOptions) []float64 {
+	fitness := make([]float64, len(vectors))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			model := DeepCopy(config)
+			for i := range jobs {
+				SetParameters(model, vectors[i])
+				fitness[i] = opts.Evaluate(model)
+			}
+		}()
+	}
+	for i := range vectors {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return fitness
+}
+
+// centredRanks maps fitness values to ranks scaled into [-0.5, 0.5].
+func centredRanks(fitness []float64) []float64 {
+	order := make([]int, len(fitness))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fitness[order[a]] < fitness[order[b]] })
+
+	ranks := make([]float64, len(fitness))
+	if len(fitness) < 2 {
+		return ranks
+	}
+	for rank, i := range order {
+		ranks[i] = float64(rank)/float64(len(fitness)-1) - 0.5
+	}
+	return ranks
+}
+
+// identityMatrix returns the n x n identity.
+func identityMatrix(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+// matVec returns m * v.
+func matVec(m [][]float64, v []float64) []float64 {
+	out := make([]float64, len(m))
+	for i, row := range m {
+		for j, value := range row {
+			out[i] += value * v[j]
+		}
+	}
+	return out
+}
+
+// matTVec returns m^T * v.
+func matTVec(m [][]float64, v []float64) []float64 {
+	out := make([]float64, len(m[0]))
+	for i, row := range m {
+		for j, value := range row {
+			out[j] += value * v[i]
+		}
+	}
+	return out
+}
+
+// symmetricEigen decomposes a symmetric matrix with the cyclic Jacobi method. It returns the
+// eigenvalues and a matrix whose columns are the matching eigenvectors.
+func symmetricEigen(matrix [][]float64) ([]float64, [][]float64) {
+	n := len(matrix)
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = append([]float64(nil), matrix[i]...)
+	}
+	v := identityMatrix(n)
+
+	for sweep := 0; sweep < 50; sweep++ {
+		offDiagonal := 0.0
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				offDiagonal += a[p][q] * a[p][q]
+			}
+		}
+		if offDiagonal < 1e-22 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(a[p][q]) < 1e-300 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	eigenvalues := make([]float64, n)
+	for i := range eigenvalues {
+		eigenvalues[i] = a[i][i]
+	}
+	return eigenvalues, v
+}
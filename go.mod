@@ -2,4 +2,4 @@ module dense
 
 go 1.22.3
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,274 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// learnedOrNotFolderName matches the layer_<n>_learnedornot folders written by CreateLearnedOrNotFolder.
+var learnedOrNotFolderName = regexp.MustCompile(`^layer_(\d+)_learnedornot$`)
+
+// ExampleDifficulty is how the models of a generation did on one input.
+type ExampleDifficulty struct {
+	InputID   string  `json:"inputID"`
+	Wrong     int     `json:"wrong"`     // Models that got the input wrong
+	Evaluated int     `json:"evaluated"` // Models that were evaluated on it
+	Score     float64 `json:"score"`     // Smoothed failure rate, (wrong+1)/(evaluated+2)
+}
+
+// HardExamples ranks the inputs of a generation by how many of its models got them wrong, hardest first.
+// The failure rate is smoothed so an input seen by one model that missed it doesn't outrank one missed by
+// most of a large population.
+type HardExamples struct {
+	Examples []ExampleDifficulty `json:"examples"`
+	index    map[string]int
+}
+
+// MineHardExamples reads the learnedornot results of every model in a generation directory. For each
+// model the highest numbered layer_<n>_learnedornot folder is used, as that is its latest evaluation. If
+// both a .true and a .false marker exist for an input, the newer one counts.
+func MineHardExamples(generationDir string) (*HardExamples, error) {
+	entries, err := os.ReadDir(generationDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation directory: %w", err)
+	}
+
+	counts := make(map[string]*ExampleDifficulty)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == activationCacheDir {
+			continue
+		}
+		folder, err := latestLearnedOrNotFolder(filepath.Join(generationDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if folder == "" {
+			continue
+		}
+		results, err := ReadLearnedOrNot(folder)
+		if err != nil {
+			return nil, err
+		}
+		for inputID, learned := range results {
+			example, ok := counts[inputID]
+			if !ok {
+				example = &ExampleDifficulty{InputID: inputID}
+				counts[inputID] = example
+			}
+			example.Evaluated++
+			if !learned {
+				example.Wrong++
+			}
+		}
+	}
+
+	hard := &HardExamples{}
+	for _, example := range counts {
+		example.Score = float64(example.Wrong+1) / float64(example.Evaluated+2)
+		hard.Examples = append(hard.Examples, *example)
+	}
+	hard.sort()
+	return hard, nil
+}
+
+// latestLearnedOrNotFolder returns the highest numbered learnedornot folder of a model folder, or "".
+func latestLearnedOrNotFolder(modelFolder string) (string, error) {
+	entries, err := os.ReadDir(modelFolder)
+	if err != nil {
+		return "", fmt.Errorf("failed to read model folder: %w", err)
+	}
+	highest, folder := -1, ""
+	for _, entry := range entries {
+		match := learnedOrNotFolderName.FindStringSubmatch(entry.Name())
+		if !entry.IsDir() || match == nil {
+			continue
+		}
+		if layer, _ := strconv.Atoi(match[1]); layer > highest {
+			highest, folder = layer, filepath.Join(modelFolder, entry.Name())
+		}
+	}
+	return folder, nil
+}
+
+// ReadLearnedOrNot reads the input_<id>.true and input_<id>.false markers of a learnedornot folder into a
+// map from input ID to whether the model got it right. When both markers exist the newer one wins.
+func ReadLearnedOrNot(learnedOrNotFolder string) (map[string]bool, error) {
+	entries, err := os.ReadDir(learnedOrNotFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read learnedornot folder: %w", err)
+	}
+	results := make(map[string]bool)
+	written := make(map[string]time.Time)
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || !strings.HasPrefix(name, "input_") || (ext != ".true" && ext != ".false") {
+			continue
+		}
+		inputID := strings.TrimSuffix(strings.TrimPrefix(name, "input_"), ext)
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if last, ok := written[inputID]; ok && !info.ModTime().After(last) {
+			continue
+		}
+		results[inputID] = ext == ".true"
+		written[inputID] = info.ModTime()
+	}
+	return results, nil
+}
+
+// sort orders the examples hardest first, breaking ties by input ID, and rebuilds the index.
+func (h *HardExamples) sort() {
+	sort.Slice(h.Examples, func(i, j int) bool {
+		if h.Examples[i].Score != h.Examples[j].Score {
+			return h.Examples[i].Score > h.Examples[j].Score
+		}
+		return h.Examples[i].InputID < h.Examples[j].InputID
+	})
+	h.index = make(map[string]int, len(h.Examples))
+	for i, example := range h.Examples {
+		h.index[example.InputID] = i
+	}
+}
+
+// Score returns the difficulty of an input, 0.5 for inputs no model was evaluated on.
+func (h *HardExamples) Score(inputID string) float64 {
+	if i, ok := h.index[inputID]; ok {
+		return h.Examples[i].Score
+	}
+	return 0.5
+}
+
+// Hardest returns the IDs of the n hardest inputs.
+func (h *HardExamples) Hardest(n int) []string {
+	if n > len(h.Examples) {
+		n = len(h.Examples)
+	}
+	if n < 0 {
+		n = 0
+	}
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = h.Examples[i].InputID
+	}
+	return ids
+}
+
+// Sample draws n distinct inputs with probability proportional to their difficulty raised to sharpness:
+// 0 samples uniformly, 1 in proportion to the score and larger values concentrate on the hardest inputs.
+func (h *HardExamples) Sample(n int, sharpness float64, rng *rand.Rand) []string {
+	if n > len(h.Examples) {
+		n = len(h.Examples)
+	}
+	if n < 0 {
+		n = 0
+	}
+	// Weighted sampling without replacement: keep the n largest u^(1/w)
+	type key struct {
+		id    string
+		value float64
+	}
+	keys := make([]key, len(h.Examples))
+	for i, example := range h.Examples {
+		weight := math.Pow(example.Score, sharpness)
+		keys[i] = key{example.InputID, math.Pow(rng.Float64(), 1/weight)}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].value > keys[j].value })
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = keys[i].id
+	}
+	return ids
+}
+
+// Rank orders input IDs hardest first, for instance the inputs one model failed on, so mutations target
+// the inputs the whole generation struggles with before the ones only this model misses.
+func (h *HardExamples) Rank(inputIDs []string) []string {
+	ranked := append([]string(nil), inputIDs...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return h.Score(ranked[i]) > h.Score(ranked[j])
+	})
+	return ranked
+}
+
+// FailedBy returns up to n inputs the model failed in its learnedornot folder, hardest first.
+func (h *HardExamples) FailedBy(learnedOrNotFolder string, n int) ([]string, error) {
+	results, err := ReadLearnedOrNot(learnedOrNotFolder)
+	if err != nil {
+		return nil, err
+	}
+	var failed []string
+	for inputID, learned := range results {
+		if !learned {
+			failed = append(failed, inputID)
+		}
+	}
+	sort.Strings(failed)
+	failed = h.Rank(failed)
+	if n < 0 {
+		n = 0
+	}
+	if len(failed) > n {
+		failed = failed[:n]
+	}
+	return failed, nil
+}
+
+// CurriculumStage returns the inputs to train on at a stage of a curriculum with the given number of
+// stages. Stage 0 holds the easiest startFraction of the inputs, every stage adds harder ones at an even
+// pace and the last stage holds all of them.
+func (h *HardExamples) CurriculumStage(stage, stages int, startFraction float64) []string {
+	fraction := 1.0
+	if stages > 1 && stage < stages-1 {
+		if stage < 0 {
+			stage = 0
+		}
+		fraction = startFraction + (1-startFraction)*float64(stage)/float64(stages-1)
+	}
+	n := int(math.Ceil(fraction * float64(len(h.Examples))))
+	if n > len(h.Examples) {
+		n = len(h.Examples)
+	}
+	if n < 0 {
+		n = 0
+	}
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = h.Examples[len(h.Examples)-1-i].InputID
+	}
+	return ids
+}
+
+// LoadHardExamples reads hard examples from a JSON file.
+func LoadHardExamples(filePath string) (*HardExamples, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var hard HardExamples
+	if err := json.Unmarshal(data, &hard); err != nil {
+		return nil, fmt.Errorf("failed to decode hard examples: %w", err)
+	}
+	hard.sort()
+	return &hard, nil
+}
+
+// SaveHardExamples writes hard examples to a JSON file.
+func SaveHardExamples(filePath string, hard *HardExamples) error {
+	data, err := json.MarshalIndent(hard, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode hard examples: %w", err)
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
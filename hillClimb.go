@@ -0,0 +1,204 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// HillClimbEvent reports progress of HillClimb. Kind is one of "start", "child", "improved",
+// "accepted", "rejected", "plateau", "restart" or "stopped".
+type HillClimbEvent struct {
+	Kind          string
+	Iteration     int // Children evaluated so far
+	Operator      string
+	Fitness       float64 // Fitness of the child or model the event is about
+	ParentFitness float64 // Fitness of the model the child was mutated from
+	BestFitness   float64
+	Temperature   float64
+	Restarts      int
+	Reason        string // Why the climb stopped, for "stopped"
+}
+
+// RestartSource provides models to restart from when the climb plateaus. MapElitesArchive is one.
+type RestartSource interface {
+	SampleParent(rng *rand.Rand) (*NetworkConfig, error)
+}
+
+// HillClimbOptions configures HillClimb.
+type HillClimbOptions struct {
+	MaxIterations  int     // Children to evaluate in total
+	BatchSize      int     // Children mutated and evaluated concurrently per step
+	Patience       int     // Batches without a new best before the climb counts as plateaued
+	MinImprovement float64 // A child has to beat the best by more than this to count as an improvement
+	TargetFitness  float64 // Stop once the best reaches this, 0 to disable
+	Temperature    float64 // Initial annealing temperature, 0 only accepts improvements
+	Cooling        float64 // Temperature multiplier per batch, defaults to 0.95
+	MaxRestarts    int     // Restarts allowed on plateau before stopping early
+	Restarts       RestartSource
+
+	// Evaluate returns the model's fitness, higher is better.
+	Evaluate func(config *NetworkConfig) float64
+	// Mutate applies one mutation and returns the operator used. Defaults to the mutation policy.
+	Mutate       func(config *NetworkConfig, rng *rand.Rand) string
+	Policy       *MutationPolicy
+	LearningRate float64
+	MutationRate int
+	// OnEvent receives progress events; it is always called from the calling goroutine.
+	OnEvent func(event HillClimbEvent)
+}
+
+// HillClimbResult is the outcome of HillClimb.
+type HillClimbResult struct {
+	Best        *NetworkConfig
+	BestFitness float64
+	Iterations  int
+	Restarts    int
+	Reason      string // "iterations", "target" or "plateau"
+}
+
+// HillClimb mutates batches of children from the current model and moves to the best child of each
+// batch when it improves, or with probability exp(delta/temperature) when it is worse (simulated
+// annealing). After Patience batches without a new best it restarts from Restarts, or from one of the
+// bests found so far, until MaxRestarts is used up and the climb stops early.
+// Children get seeds derived from their parent, so a climb from the same start model is reproducible;
+// change the start model's seed to climb from it again with different children.
+func HillClimb(start *NetworkConfig, opts HillClimbOptions) (*HillClimbResult, error) {
+	if opts.Evaluate == nil {
+		return nil, fmt.Errorf("hill climbing needs an evaluation function")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.Patience <= 0 {
+		opts.Patience = math.MaxInt32
+	}
+	if opts.Cooling <= 0 {
+		opts.Cooling = 0.95
+	}
+	if opts.Mutate == nil {
+		if opts.Policy == nil {
+			opts.Policy = DefaultMutationPolicy()
+		}
+		opts.Mutate = func(config *NetworkConfig, rng *rand.Rand) string {
+			return MutateNetworkWithPolicy(config, opts.Policy, opts.LearningRate, opts.MutationRate, rng)
+		}
+	}
+	emit := func(event HillClimbEvent) {
+		if opts.OnEvent != nil {
+			opts.OnEvent(event)
+		}
+	}
+
+	rng := ModelRand(start)
+	current := DeepCopy(start)
+	currentFitness := opts.Evaluate(current)
+	result := &HillClimbResult{Best: DeepCopy(current), BestFitness: currentFitness, Reason: "iterations"}
+	bests := []*NetworkConfig{result.Best} // Restart points when there is no RestartSource
+	temperature := opts.Temperature
+	stale := 0
+	emit(HillClimbEvent{Kind: "start", Fitness: currentFitness, BestFitness: currentFitness, Temperature: temperature})
+
+	for result.Iterations < opts.MaxIterations {
+		if opts.TargetFitness > 0 && result.BestFitness >= opts.TargetFitness {
+			result.Reason = "target"
+			break
+		}
+
+		batch := opts.BatchSize
+		if remaining := opts.MaxIterations - result.Iterations; batch > remaining {
+			batch = remaining
+		}
+		children := make([]*NetworkConfig, batch)
+		operators := make([]string, batch)
+		fitness := make([]float64, batch)
+		var wg sync.WaitGroup
+		for j := 0; j < batch; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				child, childRng := SpawnChild(current, result.Iterations+j, "")
+				operators[j] = opts.Mutate(child, childRng)
+				fitness[j] = opts.Evaluate(child)
+				children[j] = child
+			}(j)
+		}
+		wg.Wait()
+		result.Iterations += batch
+
+		bestChild := 0
+		for j := range children {
+			emit(HillClimbEvent{Kind: "child", Iteration: result.Iterations, Operator: operators[j], Fitness: fitness[j],
+				ParentFitness: currentFitness, BestFitness: result.BestFitness, Temperature: temperature, Restarts: result.Restarts})
+			if fitness[j] > fitness[bestChild] {
+				bestChild = j
+			}
+		}
+		child, childFitness := children[bestChild], fitness[bestChild]
+		event := HillClimbEvent{Iteration: result.Iterations, Operator: operators[bestChild], Fitness: childFitness,
+			ParentFitness: currentFitness, Temperature: temperature, Restarts: result.Restarts}
+
+		delta := childFitness - currentFitness
+		switch {
+		case childFitness > result.BestFitness+opts.MinImprovement:
+			current, currentFitness = child, childFitness
+			result.Best, result.BestFitness = DeepCopy(child), childFitness
+			bests = append(bests, result.Best)
+			stale = 0
+			event.Kind = "improved"
+		case delta > 0 || (temperature > 0 && rng.Float64() < math.Exp(delta/temperature)):
+			current, currentFitness = child, childFitness
+			stale++
+			event.Kind = "accepted"
+		default:
+			stale++
+			event.Kind = "rejected"
+		}
+		event.BestFitness = result.BestFitness
+		emit(event)
+		temperature *= opts.Cooling
+
+		if stale < opts.Patience {
+			continue
+		}
+		emit(HillClimbEvent{Kind: "plateau", Iteration: result.Iterations, Fitness: currentFitness,
+			BestFitness: result.BestFitness, Temperature: temperature, Restarts: result.Restarts})
+		if result.Restarts >= opts.MaxRestarts {
+			result.Reason = "plateau"
+			break
+		}
+
+		restart, err := restartPoint(opts.Restarts, bests, rng)
+		if err != nil {
+			return nil, err
+		}
+		result.Restarts++
+		current, currentFitness = restart, opts.Evaluate(restart)
+		temperature = opts.Temperature
+		stale = 0
+		emit(HillClimbEvent{Kind: "restart", Iteration: result.Iterations, Fitness: currentFitness,
+			BestFitness: result.BestFitness, Temperature: temperature, Restarts: result.Restarts})
+	}
+	// The target may have been reached by the final batch
+	if opts.TargetFitness > 0 && result.BestFitness >= opts.TargetFitness {
+		result.Reason = "target"
+	}
+
+	emit(HillClimbEvent{Kind: "stopped", Iteration: result.Iterations, Fitness: currentFitness,
+		BestFitness: result.BestFitness, Restarts: result.Restarts, Reason: result.Reason})
+	return result, nil
+}
+
+// restartPoint picks the model to restart from: a sample from the source if there is one,
+// otherwise one of the bests found so far.
+func restartPoint(source RestartSource, bests []*NetworkConfig, rng *rand.Rand) (*NetworkConfig, error) {
+	if source != nil {
+		config, err := source.SampleParent(rng)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample restart model: %w", err)
+		}
+		return config, nil
+	}
+	return DeepCopy(bests[rng.Intn(len(bests))]), nil
+}
@@ -4,16 +4,12 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
-	"sync"
 	"time"
 
 	"dense" // Ensure this import path matches your project structure
 )
 
-type Result struct {
-	fitness  float64
-	tmpModel string
-}
+const historyFile = "hillclimb_project_history.json"
 
 // Function to split the MNIST data into training (80%) and testing (20%)
 func splitData(mnist *dense.MNISTData) (trainData, testData *dense.MNISTData) {
@@ -72,83 +68,62 @@ func evaluateFitness(config *dense.NetworkConfig, mnist *dense.MNISTData) float6
 }
 
 // Hill Climbing Optimization
-func hillClimbingOptimize(trainData, testData *dense.MNISTData, iterations, batchSize, numWorkers int, learningRate, fitnessBuffer float64) float64 {
+func hillClimbingOptimize(trainData, testData *dense.MNISTData, round, iterations, batchSize int, learningRate, fitnessBuffer float64, controller *dense.AdaptiveMutationController) float64 {
 	// Load the best config from the file only once
 	bestConfig, err := dense.LoadNetworkFromFile("best_model.json")
 	if err != nil {
 		fmt.Println("Error loading best model, using default config:", err)
 		return 0.0
 	}
-
-	// Load initial accuracies from metadata
-	bestTrainingAccuracy := bestConfig.Metadata.LastTrainingAccuracy
-	bestTestAccuracy := bestConfig.Metadata.LastTestAccuracy
-	fmt.Printf("Starting optimization with initial accuracies (Training: %.4f%%, Test: %.4f%%)\n", bestTrainingAccuracy*100, bestTestAccuracy*100)
-
-	for i := 0; i < iterations; i += batchSize {
-		var wg sync.WaitGroup
-		results := make(chan Result, batchSize)
-
-		// Start a batch of workers
-		for j := 0; j < batchSize; j++ {
-			wg.Add(1)
-			go func(workerID int) {
-				defer wg.Done()
-				tmpModelFilename := fmt.Sprintf("tmp_model_%d.json", workerID)
-
-				// Load a temporary copy of the best model for this worker
-				currentConfig := dense.DeepCopy(bestConfig)
-
-				// Mutate the model and evaluate its fitness
-				dense.MutateNetwork(currentConfig, learningRate, 50)
-				newFitness := evaluateFitness(currentConfig, trainData)
-
-				// Save mutated model to the temporary file
-				dense.SaveNetworkToFile(currentConfig, tmpModelFilename)
-
-				results <- Result{fitness: newFitness, tmpModel: tmpModelFilename}
-			}(j % numWorkers) // Distribute jobs across workers
-		}
-
-		// Wait for the batch to complete
-		go func() {
-			wg.Wait()
-			close(results)
-		}()
-
-		// After all threads finish in the batch, evaluate the results
-		for result := range results {
-			if result.fitness > bestTrainingAccuracy+fitnessBuffer {
-				bestTrainingAccuracy = result.fitness
-				// Load the best temp model and store it in memory (don't save it to file just yet)
-				tmpConfig, err := dense.LoadNetworkFromFile(result.tmpModel)
-				if err != nil {
-					fmt.Println("Error loading temp model:", err)
-					continue
-				}
-				bestConfig = tmpConfig // Update the best config in memory
-				fmt.Printf("New best model found with accuracy: %.4f%%\n", bestTrainingAccuracy*100)
-			}
-
-			// Delete the temporary model file after it's no longer needed
-			err = os.Remove(result.tmpModel)
-			if err != nil {
-				fmt.Printf("Warning: Failed to delete temp model file: %s\n", result.tmpModel)
+	// Derive the seed from the round so a round that starts from an unchanged model tries different children
+	bestConfig.Metadata.Seed = dense.DeriveSeed(bestConfig.Metadata.Seed, round)
+	fmt.Printf("Starting optimization with initial accuracies (Training: %.4f%%, Test: %.4f%%)\n", bestConfig.Metadata.LastTrainingAccuracy*100, bestConfig.Metadata.LastTestAccuracy*100)
+
+	result, err := dense.HillClimb(bestConfig, dense.HillClimbOptions{
+		MaxIterations:  iterations,
+		BatchSize:      batchSize,
+		Patience:       3,
+		MinImprovement: fitnessBuffer,
+		Temperature:    0.002, // Occasionally accept a slightly worse model to get off a ridge
+		MaxRestarts:    1,
+		Evaluate: func(config *dense.NetworkConfig) float64 {
+			return evaluateFitness(config, trainData)
+		},
+		// Mutate with an adaptively chosen operator
+		Mutate: func(config *dense.NetworkConfig, rng *rand.Rand) string {
+			return controller.Mutate(config, learningRate, 50, rng)
+		},
+		OnEvent: func(event dense.HillClimbEvent) {
+			switch event.Kind {
+			case "child":
+				// Feed the outcome back so successful operators are picked more often
+				controller.Record(event.Operator, event.Fitness > event.ParentFitness)
+			case "improved":
+				fmt.Printf("New best model found with accuracy: %.4f%%\n", event.BestFitness*100)
+			case "accepted", "rejected":
+				fmt.Printf("Iteration %d: %s child at %.4f%%, best %.4f%%, temperature %.5f\n", event.Iteration, event.Kind, event.Fitness*100, event.BestFitness*100, event.Temperature)
+			case "plateau", "restart":
+				fmt.Printf("Iteration %d: %s (restarts %d)\n", event.Iteration, event.Kind, event.Restarts)
+			case "stopped":
+				fmt.Printf("Stopped after %d iterations (%s)\n", event.Iteration, event.Reason)
 			}
-		}
-
-		fmt.Printf("\nBatch ending at iteration %d: Current best training accuracy: %.4f%%\n", i+batchSize, bestTrainingAccuracy*100)
+		},
+	})
+	if err != nil {
+		fmt.Println("Error during hill climbing:", err)
+		return 0.0
 	}
+	bestConfig = result.Best
 
 	// Update metadata with new evaluations
-	bestConfig.Metadata.LastTrainingAccuracy = bestTrainingAccuracy
+	bestConfig.Metadata.LastTrainingAccuracy = result.BestFitness
 	bestConfig.Metadata.LastTestAccuracy = evaluateFitness(bestConfig, testData) // Evaluate on test data
 	fmt.Printf("Final model accuracy on test set: %.4f%%\n", bestConfig.Metadata.LastTestAccuracy*100)
 
 	// Save the best model after all batches are complete
 	dense.SaveNetworkToFile(bestConfig, "best_model.json")
 
-	return bestTrainingAccuracy * 100
+	return result.BestFitness * 100
 }
 
 // Check if a file exists
@@ -181,8 +156,6 @@ func loadData(trainFile, testFile string) (trainData, testData *dense.MNISTData,
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-
 	// Ensure MNIST dataset is downloaded
 	err := dense.EnsureMNISTDownloads()
 	if err != nil {
@@ -230,8 +203,11 @@ func main() {
 			outputActivationTypes[i] = "softmax"
 		}
 
-		// Create a simple FFNN model
-		initialConfig := createFFNNModel(numInputs, numOutputs, outputActivationTypes)
+		// Create a simple FFNN model from a fresh seed, recorded in its metadata
+		seed := dense.NewSeed()
+		fmt.Printf("Using seed %d\n", seed)
+		initialConfig := createFFNNModel(numInputs, numOutputs, outputActivationTypes, dense.NewRand(seed))
+		initialConfig.Metadata.Seed = seed
 		dense.SaveNetworkToFile(initialConfig, "best_model.json") // Save the initial model
 	} else {
 		fmt.Println("Loading existing best model from file...")
@@ -243,13 +219,30 @@ func main() {
 	maxDuration := 12 * time.Hour
 	startTime := time.Now()
 
-	numWorkers := 4  // Adjust this based on your system's capabilities
-	batchSize := 10  // Set the batch size
+	batchSize := 10  // Children evaluated concurrently per step
+
+	// Resume the adaptive mutation statistics from the project history if present
+	history := &dense.ProjectHistory{ProjectName: "FFNN MNIST"}
+	if fileExists(historyFile) {
+		if loaded, err := dense.LoadProjectHistory(historyFile); err == nil {
+			history = loaded
+		} else {
+			fmt.Println("Error loading project history, starting fresh:", err)
+		}
+	}
+	controller := dense.NewAdaptiveMutationController(dense.DefaultMutationPolicy())
+	controller.LoadStats(history.MutationStats)
 
 	for {
-		bestFitness := hillClimbingOptimize(trainData, testData, 100, batchSize, numWorkers, 0.5, 0.001)
+		bestFitness := hillClimbingOptimize(trainData, testData, history.TotalGenerations, 100, batchSize, 0.5, 0.001, controller)
 		fmt.Printf("Current best model accuracy (training set): %.4f%%\n", bestFitness)
 
+		history.TotalGenerations++
+		history.MutationStats = controller.Snapshot()
+		if err := dense.SaveProjectHistory(historyFile, history); err != nil {
+			fmt.Println("Error saving project history:", err)
+		}
+
 		if bestFitness >= desiredAccuracy || time.Since(startTime) >= maxDuration {
 			break
 		}
@@ -267,11 +260,11 @@ func main() {
 }
 
 // Function to create a simple FFNN model for MNIST
-func createFFNNModel(numInputs, numOutputs int, outputActivationTypes []string) *dense.NetworkConfig {
+func createFFNNModel(numInputs, numOutputs int, outputActivationTypes []string, rng *rand.Rand) *dense.NetworkConfig {
 	modelID := "ffnn_model"
 	projectName := "FFNN MNIST"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to be dense
 	config.Layers.Input.LayerType = "dense"
@@ -286,12 +279,12 @@ func createFFNNModel(numInputs, numOutputs int, outputActivationTypes []string)
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
 							for j := 0; j < numInputs; j++ {
 								inputID := fmt.Sprintf("input%d", j)
-								connections[inputID] = dense.Connection{Weight: rand.NormFloat64()}
+								connections[inputID] = dense.Connection{Weight: rng.NormFloat64()}
 							}
 							return connections
 						}(),
@@ -309,12 +302,12 @@ func createFFNNModel(numInputs, numOutputs int, outputActivationTypes []string)
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "softmax",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
 				for j := 0; j < 128; j++ {
 					hiddenID := fmt.Sprintf("hidden%d", j)
-					connections[hiddenID] = dense.Connection{Weight: rand.NormFloat64()}
+					connections[hiddenID] = dense.Connection{Weight: rng.NormFloat64()}
 				}
 				return connections
 			}(),
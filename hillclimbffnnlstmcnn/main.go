@@ -94,22 +94,22 @@ func hillClimbingOptimize(trainData, testData *dense.MNISTData, iterations, batc
 		// Start a batch of workers
 		for j := 0; j < batchSize; j++ {
 			wg.Add(1)
-			go func(workerID int) {
+			go func(workerID, childIndex int) {
 				defer wg.Done()
 				tmpModelFilename := fmt.Sprintf("tmp_model_%d.json", workerID)
 
-				// Load a temporary copy of the best model for this worker
-				currentConfig := dense.DeepCopy(bestConfig)
+				// Copy the best model with a seed derived from its own, so the batch can be reproduced
+				currentConfig, rng := dense.SpawnChild(bestConfig, childIndex, "")
 
 				// Mutate the model and evaluate its fitness
-				dense.MutateNetwork(currentConfig, learningRate, 50)
+				dense.MutateNetwork(currentConfig, learningRate, 50, rng)
 				newFitness := evaluateFitness(currentConfig, trainData)
 
 				// Save mutated model to the temporary file
 				dense.SaveNetworkToFile(currentConfig, tmpModelFilename)
 
 				results <- Result{fitness: newFitness, tmpModel: tmpModelFilename}
-			}(j % numWorkers) // Distribute jobs across workers
+			}(j%numWorkers, j) // Distribute jobs across workers
 		}
 
 		// Wait for the batch to complete
@@ -119,6 +119,7 @@ func hillClimbingOptimize(trainData, testData *dense.MNISTData, iterations, batc
 		}()
 
 		// Evaluate results
+		improved := false
 		for result := range results {
 			if result.fitness > bestTrainingAccuracy+fitnessBuffer {
 				bestTrainingAccuracy = result.fitness
@@ -129,6 +130,7 @@ func hillClimbingOptimize(trainData, testData *dense.MNISTData, iterations, batc
 					continue
 				}
 				bestConfig = tmpConfig
+				improved = true
 				fmt.Printf("New best model found with accuracy: %.4f%%\n", bestTrainingAccuracy*100)
 			}
 
@@ -139,6 +141,11 @@ func hillClimbingOptimize(trainData, testData *dense.MNISTData, iterations, batc
 			}
 		}
 
+		// Without a new best, move the parent's seed on so the next batch tries different children
+		if !improved {
+			bestConfig.Metadata.Seed = dense.DeriveSeed(bestConfig.Metadata.Seed, batchSize)
+		}
+
 		// Check and restore input/output layers after each batch
 		dense.RestoreInputAndOutputLayers(bestConfig, savedInputLayer, savedOutputLayer)
 		dense.CheckForLayerChanges(savedInputLayer, bestConfig.Layers.Input, "Input")
@@ -188,8 +195,6 @@ func loadData(trainFile, testFile string) (trainData, testData *dense.MNISTData,
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-
 	// Ensure MNIST dataset is downloaded
 	err := dense.EnsureMNISTDownloads()
 	if err != nil {
@@ -238,7 +243,10 @@ func main() {
 		}
 
 		// Create a combined FFNN, LSTM, CNN model
-		initialConfig := createCombinedModel(numInputs, numOutputs, outputActivationTypes)
+		seed := dense.NewSeed()
+		fmt.Printf("Using seed %d\n", seed)
+		initialConfig := createCombinedModel(numInputs, numOutputs, outputActivationTypes, dense.NewRand(seed))
+		initialConfig.Metadata.Seed = seed
 		dense.SaveNetworkToFile(initialConfig, "best_model.json") // Save the initial model
 	} else {
 		fmt.Println("Loading existing best model from file...")
@@ -274,11 +282,11 @@ func main() {
 }
 
 // Create a model combining FFNN, LSTM, and CNN layers
-func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []string) *dense.NetworkConfig {
+func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []string, rng *rand.Rand) *dense.NetworkConfig {
 	modelID := "combined_model"
 	projectName := "FFNN + LSTM + CNN MNIST"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to use CNN first, then FFNN and LSTM
 	config.Layers.Input.LayerType = "conv" // Use CNN for input processing
@@ -289,8 +297,8 @@ func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []stri
 			LayerType: "conv",
 			Filters: []dense.Filter{
 				{
-					Weights: dense.Random2DSlice(3, 3),
-					Bias:    rand.Float64(),
+					Weights: dense.Random2DSlice(3, 3, rng),
+					Bias:    rng.Float64(),
 				},
 			},
 			Stride:  1,
@@ -304,12 +312,12 @@ func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []stri
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
 							for j := 0; j < numInputs; j++ {
 								inputID := fmt.Sprintf("input%d", j)
-								connections[inputID] = dense.Connection{Weight: rand.NormFloat64()}
+								connections[inputID] = dense.Connection{Weight: rng.NormFloat64()}
 							}
 							return connections
 						}(),
@@ -322,11 +330,11 @@ func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []stri
 			LayerType: "lstm", // LSTM Layer
 			LSTMCells: []dense.LSTMCell{ // Use LSTMCells instead of Cells
 				{
-					InputWeights:  dense.RandomSlice(numInputs),
-					ForgetWeights: dense.RandomSlice(numInputs),
-					OutputWeights: dense.RandomSlice(numInputs),
-					CellWeights:   dense.RandomSlice(numInputs),
-					Bias:          rand.Float64(),
+					InputWeights:  dense.RandomSlice(numInputs, rng),
+					ForgetWeights: dense.RandomSlice(numInputs, rng),
+					OutputWeights: dense.RandomSlice(numInputs, rng),
+					CellWeights:   dense.RandomSlice(numInputs, rng),
+					Bias:          rng.Float64(),
 				},
 			},
 		},
@@ -339,12 +347,12 @@ func createCombinedModel(numInputs, numOutputs int, outputActivationTypes []stri
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "softmax",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
 				for j := 0; j < 128; j++ {
 					hiddenID := fmt.Sprintf("hidden%d", j)
-					connections[hiddenID] = dense.Connection{Weight: rand.NormFloat64()}
+					connections[hiddenID] = dense.Connection{Weight: rng.NormFloat64()}
 				}
 				return connections
 			}(),
@@ -9,10 +9,8 @@ import (
 	"io/ioutil"
 	"log"
 	"math"
-	"math/rand"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,6 +31,24 @@ var jsonFilePath string
 var mnistData []dense.ImageData
 var testDataChunk []dense.ImageData
 
+// selectionStrategy picks which models survive into the next generation ("accuracy", "nsga2" or "novelty")
+var selectionStrategy = "accuracy"
+
+// noveltyArchivePath stores the behaviours seen so far when selecting with "novelty"
+const noveltyArchivePath = "./host/novelty_archive.json"
+
+// noveltyWeight blends novelty with accuracy: 1 is pure novelty search, 0 is pure accuracy
+const noveltyWeight = 0.5
+
+// numTimingSamples is how many images are used to measure each model's inference time
+const numTimingSamples = 20
+
+// verifyLayerStates checks every output resumed from a saved layer state against a full pass
+const verifyLayerStates = false
+
+// repairGuardSize is how many test images a repaired child must not do worse on than its parent
+const repairGuardSize = 1000
+
 // TestModelPerformance compares the performance of full model evaluation vs. saved layer state.
 func TestModelPerformance(modelConfig *dense.NetworkConfig, testData []dense.ImageData, modelFilePath string) {
 	// Get the index of the last hidden layer
@@ -147,6 +163,7 @@ func main() {
 	}
 
 	LoadMNISTData()
+	dense.VerifyLayerStates = verifyLayerStates
 
 	// Set up the model configuration
 	projectName := "AIModelTestProject"
@@ -174,7 +191,9 @@ func main() {
         fmt.Println("Files with the specified extension already exist. Skipping model generation.")
     } else {
         fmt.Println("No files found with the specified extension. Generating models.")
-        dense.GenerateModelsIfNotExist(projectPath+"0", numModels, inputSize, outputSize, outputTypes, projectName)
+        seed := dense.NewSeed()
+        fmt.Printf("Generating models with seed %d\n", seed)
+        dense.GenerateModelsIfNotExist(projectPath+"0", numModels, inputSize, outputSize, outputTypes, projectName, seed)
     }
 
 	testDataChunk = mnistData[:40000]
@@ -192,20 +211,14 @@ func main() {
 
     
 
-    // Create a new slice of type []interface{}
-    testDataInterface := make([]interface{}, len(trainData))
-
-    // Convert each element from []dense.ImageData to []interface{}
-    for i, data := range trainData {
-        testDataInterface[i] = data
-    }
+    trainDataset := dense.NewMNISTDataset(mnistDir, trainData)
 
 	for i := 0; i <= generationNum; i++ {
 		generationDir := "./host/generations/" + strconv.Itoa(i)
 		fmt.Println("----CURENT GEN---", generationDir)
 
-        dense.SaveLayerStates(generationDir,&testDataInterface,mnistDir)
-        dense.EvaluateModelAccuracyFromLayerState(generationDir,&testDataInterface,mnistDir)
+        dense.SaveLayerStates(generationDir, trainDataset)
+        dense.EvaluateModelAccuracyFromLayerState(generationDir, trainDataset)
 		//GenCycleLocalTesting(generationDir, i)
 		//dense.DeleteAllFolders(generationDir)
 		//CreateNextGeneration(generationDir, numModels, i)
@@ -268,15 +281,45 @@ func CreateNextGeneration(generationDir string, numModels int, genNum int) {
 		})
 	}
 
-	// Step 4: Sort the models by accuracy in descending order
-	sort.Slice(models, func(i, j int) bool {
-		return models[i].Accuracy > models[j].Accuracy
-	})
+	// Step 4: Measure accuracy, size and inference time of every model
+	var timingInputs []map[string]interface{}
+	for i := 0; i < numTimingSamples && i < len(testDataChunk); i++ {
+		timingInputs = append(timingInputs, convertImageToInputs(testDataChunk[i].FileName))
+	}
+	configs := make([]*dense.NetworkConfig, len(models))
+	modelsByConfig := make(map[*dense.NetworkConfig]TopModel, len(models))
+	for i, model := range models {
+		dense.MeasureObjectives(model.Config, timingInputs)
+		configs[i] = model.Config
+		modelsByConfig[model.Config] = model
+	}
+
+	// Novelty search compares each model's outputs on the timing images against the archive
+	if selectionStrategy == "novelty" {
+		archive, err := dense.LoadNoveltyArchive(noveltyArchivePath)
+		if err != nil {
+			fmt.Println("Starting a new novelty archive:", err)
+			archive = dense.NewNoveltyArchive(15, 0, 1000)
+		}
+		dense.ScoreNovelty(configs, timingInputs, archive, noveltyWeight)
+		if err := dense.SaveNoveltyArchive(noveltyArchivePath, archive); err != nil {
+			fmt.Println("Failed to save novelty archive:", err)
+		}
+		fmt.Printf("Novelty archive holds %d behaviours, threshold %.4f\n", len(archive.Entries), archive.Threshold)
+	}
 
-	// Step 5: Get the top 10 models
-	topModels := models
-	if len(models) > 10 {
-		topModels = models[:10]
+	// Step 5: Get the top 10 models according to the selection strategy
+	strategy, err := dense.GetSelectionStrategy(selectionStrategy)
+	if err != nil {
+		fmt.Println("Falling back to accuracy selection:", err)
+		strategy = dense.SelectByAccuracy
+	}
+	var topModels []TopModel
+	for _, config := range strategy(configs, 10) {
+		topModels = append(topModels, modelsByConfig[config])
+		objectives := config.Metadata.Objectives
+		fmt.Printf("Selected %s: accuracy %.2f%%, %d parameters, %.3f ms, rank %d, novelty %.4f\n",
+			config.Metadata.ModelID, objectives.Accuracy*100, objectives.ParamCount, objectives.InferenceTimeMs, objectives.ParetoRank, objectives.Novelty)
 	}
 
 	// Step 6: Prepare the next generation directory
@@ -287,17 +330,32 @@ func CreateNextGeneration(generationDir string, numModels int, genNum int) {
 	}
 
 	// Step 7: Copy the top 10 models into the next generation directory with a UUID
-	for _, model := range topModels {
+	for i, model := range topModels {
 		id := uuid.New() // Generate a new UUID
 		newModelPath := filepath.Join(nextGenerationDir, id.String()+".json")
-		model.Config.Metadata.LastTestAccuracy = 0.0
+		child, _ := dense.SpawnChild(model.Config, i, id.String())
+		child.Metadata.LastTestAccuracy = 0.0
 		// Save the model to the new path
-		if err := dense.SaveModel(newModelPath, model.Config); err != nil {
+		if err := dense.SaveModel(newModelPath, child); err != nil {
 			fmt.Printf("Failed to save model %s: %v\n", newModelPath, err)
-		} else {
-			fmt.Printf("Successfully saved top model to %s\n", newModelPath)
+			continue
 		}
+		fmt.Printf("Successfully saved top model to %s\n", newModelPath)
+
+		// Record the child on the parent so the lineage can be followed in both directions
+		dense.LinkParentChild(model.Config, child)
+		if err := dense.SaveModel(model.Path, model.Config); err != nil {
+			fmt.Printf("Failed to update parent model %s: %v\n", model.Path, err)
+		}
+	}
+
+	// Step 8: Drop the layer states of the models that were not selected
+	manager := dense.NewLayerStateManager(filepath.Dir(generationDir), 0)
+	freed, err := manager.EvictUnselected()
+	if err != nil {
+		fmt.Println("Failed to evict layer states of unselected models:", err)
 	}
+	fmt.Printf("Freed %d bytes of layer states\n", freed)
 }
 
 func testPer() {
@@ -328,6 +386,14 @@ func GenCycleLocalTesting(generationDir string, currentGeneration int) {
 			return
 		}*/
 
+	// Inputs most models of the generation get wrong are targeted first
+	hardExamples, err := dense.MineHardExamples(generationDir)
+	if err != nil {
+		fmt.Printf("Failed to mine hard examples: %v\n", err)
+		return
+	}
+	fmt.Println("Hardest inputs of the generation:", hardExamples.Hardest(10))
+
 	totalFiles := len(files)
 	batchSize := 2 // Number of models to process concurrently
 
@@ -368,7 +434,11 @@ func GenCycleLocalTesting(generationDir string, currentGeneration int) {
 				fmt.Println(layerNum)
 
 				layerOfNotLearned := filepath.Join(modelFilePathFolder, highestFolder)
-				lstEvalsTryingToLearn, _ := dense.GetFilesWithExtension(layerOfNotLearned, ".false", 10, false)
+				lstEvalsTryingToLearn, err := hardExamples.FailedBy(layerOfNotLearned, 10)
+				if err != nil {
+					fmt.Println("Failed to read learnedornot results:", err)
+					return
+				}
 				fmt.Println(lstEvalsTryingToLearn)
 
 				//mutations to try against shards
@@ -380,7 +450,11 @@ func GenCycleLocalTesting(generationDir string, currentGeneration int) {
 					//fmt.Println(modelFilePathFolder + "/layer_" + strconv.Itoa(layerNum) + "_shards/" + dataShard + ".csv")
 
 					inputIDNumber, _ := dense.ExtractDigitsToInt(dataShard)
-					savedLayerData := dense.LoadShardedLayerState(modelFilePath, layerNum, strconv.Itoa(inputIDNumber))
+					savedLayerData, err := dense.LoadShardedLayerState(modelFilePath, layerNum, strconv.Itoa(inputIDNumber))
+					if err != nil {
+						fmt.Println("Failed to load layer state:", err)
+						continue
+					}
 
 					modelConfig, err := dense.LoadModel(modelFilePathFolder + ".json")
 					if err != nil {
@@ -399,7 +473,7 @@ func GenCycleLocalTesting(generationDir string, currentGeneration int) {
 							//fmt.Println(predictedLabel)
 							//fmt.Println(mnistData[inputIDNumber].Label)
 
-							ApplyMutations(modelFilePathFolder, inputIDNumber, layerNum, savedLayerData, generationDir)
+							ApplyMutations(modelFilePathFolder, inputIDNumber, generationDir)
 
 						}
 
@@ -418,120 +492,65 @@ func GenCycleLocalTesting(generationDir string, currentGeneration int) {
 	fmt.Println("All models processed.")
 }
 
-func ApplyMutations(modelFilePathFolder string, inputIDNumber int, layerNum int, savedLayerData interface{}, modelDir string) {
-	var wg sync.WaitGroup   // WaitGroup to manage goroutines
-	var mu sync.Mutex       // Mutex to protect shared resources
-	mutationAttempts := 100 // Number of mutation attempts
-	var foundMatch bool     // Flag to track if we found a matching prediction
-
-	// Channel to capture the result
-	mutationResults := make(chan bool, mutationAttempts)
-
-	for i := 0; i < mutationAttempts; i++ {
-		wg.Add(1) // Increment WaitGroup counter
-
-		go func(iteration int) {
-			defer wg.Done() // Decrement WaitGroup counter when done
-
-			// Load the model configuration inside each goroutine
-			modelConfig, err := dense.LoadModel(modelFilePathFolder + ".json")
-			if err != nil {
-				fmt.Println("Failed to load model:", err)
-				return
-			}
-
-			// Randomize the number of neurons or filter size (for CNN layers) between 10 and 128
-			numNewNeuronsOrFilters := rand.Intn(119) + 10
-
-			// Select mutation type with only 2 possible options
-			mutationType := rand.Intn(2) // 2 mutation types
-
-			// Apply the mutation based on type
-			switch mutationType {
-			case 0:
-				// Mutation Type 0: Append a new layer with full connections
-				dense.AppendNewLayerFullConnections(modelConfig, numNewNeuronsOrFilters)
-			case 1:
-				// Mutation Type 1: Append multiple layers
-				numNewLayers := rand.Intn(3) + 1 // Randomly choose between 1 to 3 new layers
-				dense.AppendMultipleLayers(modelConfig, numNewLayers, numNewNeuronsOrFilters)
-
-				/*
-				   // Mutation Type 2: Add a CNN layer at a random position
-				   case 2:
-				       dense.AddCNNLayerAtRandomPosition(modelConfig, numNewNeuronsOrFilters)
-
-				   // Mutation Type 3: Add multiple CNN layers
-				   case 3:
-				       numNewLayers := rand.Intn(3) + 1 // Randomly choose between 1 to 3 new CNN layers
-				       dense.AddMultipleCNNLayers(modelConfig, 100, numNewLayers)
-
-				   // Mutation Type 4: Add an LSTM layer at a random position
-				   case 4:
-				       dense.AddLSTMLayerAtRandomPosition(modelConfig, 100)
-
-				   // Mutation Type 5: Add multiple generic layers
-				   case 5:
-				       numNewLayers := rand.Intn(3) + 1 // Randomly choose between 1 to 3 new layers
-				       dense.AddMultipleLayers(modelConfig, numNewLayers)
-				*/
-			}
-
-			// *** Reattach the output layer after applying mutations ***
-			numOutputs := 10                             // Number of output neurons (for example, for classification of MNIST digits 0-9)
-			outputActivationTypes := []string{"softmax"} // Activation type for the output layer
-			dense.ReattachOutputLayer(modelConfig, numOutputs, outputActivationTypes)
-
-			// *** Continue the feedforward process from the saved layer state ***
-			result := dense.ContinueFeedforward(modelConfig, savedLayerData, layerNum)
-			mutatedPredictedLabel := getMaxIndex(result)
-
-			// If the prediction matches the actual label, mark the match
-			if mutatedPredictedLabel == mnistData[inputIDNumber].Label {
-				mu.Lock()
-				if !foundMatch { // Check and set foundMatch in a thread-safe manner
-					foundMatch = true
-
-					//fmt.Printf("Match found on iteration %d\n", iteration)
-					//EvaluateModelAccuracyFromLayerState(layerStateNumber int,modelConfig *dense.NetworkConfig, testData []dense.ImageData, modelFilePath string)
-					mutatedAccuracy := EvaluateModelAccuracyFromLayerState(layerNum, modelConfig, testDataChunk, modelFilePathFolder+".json")
-					baselineAccuracy := modelConfig.Metadata.LastTestAccuracy
-
-					if mutatedAccuracy > baselineAccuracy {
-						fmt.Printf("Old Accuracy: %.2f%%\n", baselineAccuracy*100)
-						fmt.Printf("New Accuracy: %.2f%%\n", mutatedAccuracy*100)
-						id := uuid.New()
-						fmt.Println(modelDir+"Generated UUID:", id.String())
-						modelConfig.Metadata.LastTestAccuracy = mutatedAccuracy
-						//modelConfig.Metadata.LastTestAccuracy = 0.0
-						//SaveNetworkToFile(config *NetworkConfig, filename string)
-						dense.SaveNetworkToFile(modelConfig, modelDir+"/"+id.String()+".json")
-					}
-
-				}
-				mu.Unlock()
-				mutationResults <- true
-			} else {
-				mutationResults <- false
-			}
-
-		}(i)
+func ApplyMutations(modelFilePathFolder string, inputIDNumber int, modelDir string) {
+	modelConfig, err := dense.LoadModel(modelFilePathFolder + ".json")
+	if err != nil {
+		fmt.Println("Failed to load model:", err)
+		return
 	}
 
-	// Wait for all goroutines to finish
-	wg.Wait()
-	close(mutationResults)
+	// The failing input is the target; a slice of the test data guards against fixing it at the cost of others
+	target := repairExample(inputIDNumber)
+	guardSize := repairGuardSize
+	if guardSize > len(testDataChunk) {
+		guardSize = len(testDataChunk)
+	}
+	guard := make([]dense.RepairExample, guardSize)
+	for i := range guard {
+		guard[i] = repairExample(i)
+	}
 
-	// Check if any of the mutations resulted in a match
-	for result := range mutationResults {
-		if result {
-			fmt.Println("Successful mutation found!")
+	result, err := dense.RepairSearch(modelConfig, modelFilePathFolder+".json", []dense.RepairExample{target}, guard, dense.RepairOptions{
+		Attempts:          100,
+		NumOutputs:        10,                  // Number of output neurons (for example, for classification of MNIST digits 0-9)
+		OutputActivations: []string{"softmax"}, // Activation type for the output layer
+		Seed:              dense.DeriveSeed(modelConfig.Metadata.Seed, inputIDNumber),
+		Correct: func(output, expected map[string]float64) bool {
+			return getMaxIndex(output) == getMaxIndex(expected)
+		},
+		SaveDir: modelDir,
+		ChildID: func(child *dense.NetworkConfig) string {
+			return uuid.New().String()
+		},
+	})
+	if err != nil {
+		fmt.Println("Repair search failed:", err)
+		return
+	}
 
-			break
+	for _, child := range result.Accepted {
+		fmt.Println("Successful mutation found!")
+		fmt.Printf("Old Accuracy: %.2f%%\n", result.BaselineAccuracy*100)
+		fmt.Printf("New Accuracy: %.2f%%\n", child.Accuracy*100)
+		fmt.Println(modelDir+"Generated UUID:", child.Config.Metadata.ModelID)
+		for _, record := range child.Mutations {
+			fmt.Println("  " + dense.FormatMutationRecord(record))
 		}
 	}
 }
 
+// repairExample is the MNIST input with the given index, as a repair search target or guard.
+func repairExample(inputIDNumber int) dense.RepairExample {
+	data := mnistData[inputIDNumber]
+	return dense.RepairExample{
+		InputID: strconv.Itoa(inputIDNumber),
+		Inputs: func() map[string]interface{} {
+			return convertImageToInputs(data.FileName)
+		},
+		Expected: convertLabelToOutputMap(data.Label),
+	}
+}
+
 // EvaluateModelAccuracy evaluates the model's accuracy on the entire test dataset.
 func EvaluateModelAccuracy(modelConfig *dense.NetworkConfig, testData []dense.ImageData) float64 {
 	var correct int
@@ -580,7 +599,11 @@ func EvaluateModelAccuracy(modelConfig *dense.NetworkConfig, testData []dense.Im
 	return accuracy
 }
 
-func EvaluateModelAccuracyFromLayerState(layerStateNumber int, modelConfig *dense.NetworkConfig, testData []dense.ImageData, modelFilePath string) float64 {
+// EvaluateModelAccuracyFromLayerState evaluates a model from the shards saved at layerStateNumber. When the
+// model is a child whose mutations touched that layer or an earlier one, the evaluator resumes each input
+// from the parent's deepest shared state instead; it may be nil for unmutated models.
+func EvaluateModelAccuracyFromLayerState(layerStateNumber int, modelConfig *dense.NetworkConfig, testData []dense.ImageData, modelFilePath string, evaluator *dense.ChildEvaluator) float64 {
+	useEvaluator := evaluator != nil && (evaluator.Diff.InputChanged || evaluator.Diff.ResumeLayer < layerStateNumber)
 
 	numWorkers := 10
 	batchSize := len(testData) / numWorkers
@@ -615,12 +638,32 @@ func EvaluateModelAccuracyFromLayerState(layerStateNumber int, modelConfig *dens
 			defer wg.Done()
 			for j := start; j < end; j++ {
 				inputID := fmt.Sprintf("%d", j)
-				savedLayerData := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
-				if savedLayerData == nil {
-					fmt.Printf("No saved layer data for input ID %s. Skipping.\n", inputID)
-					continue
+				var result map[string]float64
+				if useEvaluator {
+					fileName := testData[j].FileName
+					var err error
+					result, _, err = evaluator.Evaluate(inputID, func() map[string]interface{} {
+						return convertImageToInputs(fileName)
+					})
+					if err != nil {
+						fmt.Printf("Failed to evaluate input ID %s: %v. Skipping.\n", inputID, err)
+						continue
+					}
+				} else {
+					savedLayerData, err := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
+					if err != nil {
+						fmt.Printf("No saved layer data for input ID %s: %v. Skipping.\n", inputID, err)
+						continue
+					}
+					result = dense.ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
+					if dense.VerifyLayerStates {
+						inputs := convertImageToInputs(testData[j].FileName)
+						if _, err := dense.VerifyResumedOutput(modelConfig, inputs, result, layerStateNumber, dense.VerifyTolerance); err != nil {
+							fmt.Printf("Saved layer data for input ID %s failed verification: %v. Skipping.\n", inputID, err)
+							continue
+						}
+					}
 				}
-				result := dense.ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
 
 				// Use mutex to ensure thread-safe access to shared resources
 				mu.Lock()
@@ -698,7 +741,11 @@ func TestShardedModelPerformance(modelConfig *dense.NetworkConfig, testData []de
 	savedEvalOutputs := make([]map[string]float64, len(testData))
 	for i := range testData {
 		inputID := fmt.Sprintf("%d", i)
-		savedLayerData := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
+		savedLayerData, err := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
+		if err != nil {
+			fmt.Printf("No saved layer data for input ID %s: %v\n", inputID, err)
+			continue
+		}
 		savedEvalOutputs[i] = dense.ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
 	}
 	durationSavedEval := time.Since(startSavedEval)
@@ -793,7 +840,11 @@ func TestShardedModelPerformanceMultithreaded(modelConfig *dense.NetworkConfig,
 			defer wg.Done()
 			for j := start; j < end; j++ {
 				inputID := fmt.Sprintf("%d", j)
-				savedLayerData := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
+				savedLayerData, err := dense.LoadShardedLayerState(modelFilePath, layerStateNumber, inputID)
+				if err != nil {
+					fmt.Printf("No saved layer data for input ID %s: %v\n", inputID, err)
+					continue
+				}
 				result := dense.ContinueFeedforward(modelConfig, savedLayerData, layerStateNumber)
 
 				// Use mutex to ensure thread-safe access to shared resources
@@ -1245,7 +1296,9 @@ func evaluateModelMultiThreaded(testData []dense.ImageData, modelConfig *dense.N
 
 	// Now perform the actual file writes for all shard data
 	for inputID, shardData := range shardDataBuffer {
-		dense.SaveShardedLayerState(shardData, modelFilePath, layerStateNumber, inputID)
+		if err := dense.SaveShardedLayerState(shardData, modelFilePath, layerStateNumber, inputID); err != nil {
+			fmt.Printf("Failed to save layer state for input ID %s: %v\n", inputID, err)
+		}
 	}
 
 	// Calculate accuracy as the proportion of correct predictions
@@ -3,9 +3,8 @@ package dense
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math"
 	"os"
-	"time"
 )
 
 // AIModelManager manages the lifecycle and growth of AI models.
@@ -23,6 +22,10 @@ type AIModelManager struct {
 	Config           *NetworkConfig
 	History          ProjectHistory
 	TopX             int // Number of top models to track per generation
+	Seed             int64                       // Project seed; a fresh one is picked and recorded when zero
+	SearchTrain      []SupernetSample            // Samples DNAS and NAS train the supernet weights on
+	SearchValidation []SupernetSample            // Samples the architecture is chosen on
+	SearchSpace      *SupernetSpace              // Supernet search space; built from the layer types when nil
 }
 
 // GenerationData holds information about the best models in each generation.
@@ -47,6 +50,8 @@ type ProjectHistory struct {
 	History         []GenerationData `json:"history"`
 	TotalGenerations int             `json:"total_generations"`
 	ModelConfig     *NetworkConfig   `json:"model_config"` // Store the latest network configuration
+	MutationStats   map[string]*OperatorStats `json:"mutation_stats,omitempty"` // Adaptive mutation statistics per operator
+	Seed            int64            `json:"seed"`               // Project seed, so a run can be reproduced
 }
 
 // Init initializes the manager with the project-specific parameters or loads from a save point.
@@ -86,11 +91,15 @@ func (mgr *AIModelManager) initialize() {
 	fmt.Printf("Initializing AI Model Manager for project '%s' using methods %v and layers %v...\n", mgr.ProjectName, mgr.Methods, mgr.LayerTypes)
 	fmt.Printf("Starting with %d models, cycling through all mutations: %v\n", mgr.NumModels, mgr.CycleAllMutations)
 
-	// Random seed for reproducibility
-	rand.Seed(time.Now().UnixNano())
+	// Use the configured seed, or pick one and record it so the run can be reproduced
+	if mgr.Seed == 0 {
+		mgr.Seed = NewSeed()
+	}
+	rng := NewRand(mgr.Seed)
 
 	// Create a random network configuration based on the input and output sizes
-	mgr.Config = CreateRandomNetworkConfig(mgr.InputSize, mgr.OutputSize, mgr.OutputTypes, "model-1", mgr.ProjectName)
+	mgr.Config = CreateRandomNetworkConfig(mgr.InputSize, mgr.OutputSize, mgr.OutputTypes, "model-1", mgr.ProjectName, rng)
+	mgr.Config.Metadata.Seed = mgr.Seed
 
 	// Adjust the network configuration based on the layer types
 	for _, layerType := range mgr.LayerTypes {
@@ -120,6 +129,7 @@ func (mgr *AIModelManager) initialize() {
 		NumModels:       mgr.NumModels,
 		CycleAllMutations: mgr.CycleAllMutations,
 		History:         []GenerationData{},
+		Seed:            mgr.Seed,
 	}
 
 	fmt.Println("Initialization complete. Neural network configuration created.")
@@ -193,16 +203,118 @@ func (mgr *AIModelManager) trainHillClimb() {
 	}
 }*/
 
-// trainDNAS implements DNAS logic, potentially across the entire population.
+// trainDNAS trains a supernet with continuous architecture weights and hands the model derived from the
+// strongest candidates back to the evolutionary pipeline as mgr.Config.
 func (mgr *AIModelManager) trainDNAS() {
 	fmt.Println("Performing DNAS optimization...")
-	// Add DNAS logic here
+	net, err := mgr.trainSupernet()
+	if err != nil {
+		fmt.Printf("DNAS failed: %v\n", err)
+		return
+	}
+	for i, probs := range net.Probabilities() {
+		fmt.Printf("Slot %d architecture probabilities: %v\n", i, probs)
+	}
+	mgr.useDerivedModel(net, net.StrongestChoices(), "dnas-model")
 }
 
-// trainNAS implements NAS logic, focusing on architectural search.
+// trainNAS trains the same weight-sharing supernet, then searches random discrete architectures with the
+// inherited weights on the validation samples and hands the best one to the evolutionary pipeline.
 func (mgr *AIModelManager) trainNAS() {
 	fmt.Println("Performing NAS optimization...")
-	// Add NAS logic here
+	net, err := mgr.trainSupernet()
+	if err != nil {
+		fmt.Printf("NAS failed: %v\n", err)
+		return
+	}
+	choices, fitness, err := SearchSupernet(net, mgr.SearchValidation, 50, nil, NewRand(DeriveSeed(mgr.Seed, 1)))
+	if err != nil {
+		fmt.Printf("NAS failed: %v\n", err)
+		return
+	}
+	fmt.Printf("Best architecture %v with validation fitness %.5f\n", choices, fitness)
+	mgr.useDerivedModel(net, choices, "nas-model")
+}
+
+// trainSupernet builds the supernet for the project's search space and trains it on the search samples.
+func (mgr *AIModelManager) trainSupernet() (*Supernet, error) {
+	if len(mgr.SearchTrain) == 0 || len(mgr.SearchValidation) == 0 {
+		return nil, fmt.Errorf("no search samples, set SearchTrain and SearchValidation")
+	}
+	if mgr.Seed == 0 {
+		mgr.Seed = NewSeed()
+	}
+	space, err := mgr.supernetSpace()
+	if err != nil {
+		return nil, err
+	}
+	net, err := NewSupernet(space, NewRand(mgr.Seed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build supernet: %w", err)
+	}
+	err = TrainSupernet(net, mgr.SearchTrain, mgr.SearchValidation, SupernetOptions{
+		Steps:            200,
+		BatchSize:        32,
+		Pairs:            10,
+		Sigma:            0.05,
+		WeightRate:       0.01,
+		ArchitectureRate: 0.05,
+		Seed:             mgr.Seed,
+		OnStep: func(step int, trainFitness, validationFitness float64) {
+			if step%20 == 0 {
+				fmt.Printf("Step %d: train fitness %.5f, validation fitness %.5f\n", step, trainFitness, validationFitness)
+			}
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to train supernet: %w", err)
+	}
+	return net, nil
+}
+
+// supernetSpace returns the configured search space, or one built from the layer types: CNN searches
+// kernel sizes on square images, LSTM searches cell counts on sequences, anything else dense widths.
+// Other image shapes need an explicit SearchSpace.
+func (mgr *AIModelManager) supernetSpace() (SupernetSpace, error) {
+	if mgr.SearchSpace != nil {
+		return *mgr.SearchSpace, nil
+	}
+	space := SupernetSpace{
+		InputType:         "dense",
+		InputSize:         mgr.InputSize,
+		Slots:             2,
+		DenseWidths:       []int{8, 16, 32},
+		NumOutputs:        mgr.OutputSize,
+		OutputActivations: mgr.OutputTypes,
+	}
+	for _, layerType := range mgr.LayerTypes {
+		switch layerType {
+		case "CNN":
+			side := int(math.Sqrt(float64(mgr.InputSize)))
+			if side*side != mgr.InputSize {
+				return space, fmt.Errorf("CNN search needs a square image but there are %d inputs, set SearchSpace with the image size", mgr.InputSize)
+			}
+			space.InputType, space.ImageRows, space.ImageCols = "conv", side, side
+			space.ConvKernels = []int{3, 5}
+		case "LSTM":
+			space.InputType = "lstm"
+			space.LSTMCells = []int{4, 8, 16}
+		}
+	}
+	return space, nil
+}
+
+// useDerivedModel derives the discrete model for choices and makes it the project's model.
+func (mgr *AIModelManager) useDerivedModel(net *Supernet, choices []int, modelID string) {
+	config, err := net.Derive(choices, modelID, mgr.ProjectName)
+	if err != nil {
+		fmt.Printf("Failed to derive a model from the supernet: %v\n", err)
+		return
+	}
+	config.Metadata.Seed = mgr.Seed
+	mgr.Config = config
+	mgr.History.ModelConfig = config
+	fmt.Printf("Derived model %s with %d hidden layers and %d parameters\n", modelID, len(config.Layers.Hidden), CountParameters(config))
 }
 
 // updateHistory records the best models of the current generation in the project history.
@@ -250,7 +362,32 @@ func (mgr *AIModelManager) saveProjectState() error {
 	mgr.History.ModelConfig = mgr.Config // Save the current network configuration
 
 	filePath := fmt.Sprintf("%s_save_state.json", mgr.ProjectName)
-	data, err := json.MarshalIndent(mgr.History, "", "  ")
+	if err := SaveProjectHistory(filePath, &mgr.History); err != nil {
+		return err
+	}
+
+	fmt.Printf("Project state saved successfully to %s\n", filePath)
+	return nil
+}
+
+// loadProjectState loads the saved state of the project from a JSON file.
+func (mgr *AIModelManager) loadProjectState(filePath string) error {
+	loadedHistory, err := LoadProjectHistory(filePath)
+	if err != nil {
+		return err
+	}
+
+	mgr.History = *loadedHistory
+	mgr.Config = mgr.History.ModelConfig // Restore the saved network configuration
+	mgr.Seed = mgr.History.Seed
+
+	fmt.Printf("Project state loaded successfully from %s\n", filePath)
+	return nil
+}
+
+// SaveProjectHistory writes a project history (including mutation statistics) to a JSON file.
+func SaveProjectHistory(filePath string, history *ProjectHistory) error {
+	data, err := json.MarshalIndent(history, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal project state to JSON: %w", err)
 	}
@@ -259,27 +396,20 @@ func (mgr *AIModelManager) saveProjectState() error {
 	if err != nil {
 		return fmt.Errorf("failed to write project state file: %w", err)
 	}
-
-	fmt.Printf("Project state saved successfully to %s\n", filePath)
 	return nil
 }
 
-// loadProjectState loads the saved state of the project from a JSON file.
-func (mgr *AIModelManager) loadProjectState(filePath string) error {
+// LoadProjectHistory reads a project history previously written by SaveProjectHistory.
+func LoadProjectHistory(filePath string) (*ProjectHistory, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read project state file: %w", err)
+		return nil, fmt.Errorf("failed to read project state file: %w", err)
 	}
 
-	var loadedHistory ProjectHistory
-	err = json.Unmarshal(data, &loadedHistory)
+	var history ProjectHistory
+	err = json.Unmarshal(data, &history)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal project state: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal project state: %w", err)
 	}
-
-	mgr.History = loadedHistory
-	mgr.Config = mgr.History.ModelConfig // Restore the saved network configuration
-
-	fmt.Printf("Project state loaded successfully from %s\n", filePath)
-	return nil
+	return &history, nil
 }
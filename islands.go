@@ -0,0 +1,338 @@
+package dense
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// IslandOptions configures an island-model run. Every island evolves its own generations directory
+// (Dir/island_<n>/<generation>) and periodically sends its best models to its neighbours.
+type IslandOptions struct {
+	Dir               string
+	Islands           int
+	Generations       int
+	PopulationSize    int
+	Survivors         int    // Models kept per generation before breeding, defaults to half the population
+	MigrationInterval int    // Generations between migrations, 0 disables migration
+	Topology          string // "ring" or "full"
+	Migrants          int    // Best models sent to each neighbour per migration, defaults to 1
+	Selection         string // Selection strategy name, defaults to "accuracy"
+	Policy            *MutationPolicy
+	LearningRate      float64
+	MutationRate      int
+	Seed              int64
+
+	// NewModel creates a model for an island that has no saved generation yet.
+	NewModel func(rng *rand.Rand) *NetworkConfig
+	// Evaluate returns the model's accuracy; it is stored as LastTestAccuracy before selection.
+	Evaluate func(config *NetworkConfig) float64
+	// Transport moves migrants between islands, defaults to a DirTransport on Dir.
+	Transport MigrationTransport
+}
+
+// MigrationTransport delivers migrants between islands. Islands may run in other processes or on
+// other machines, so Receive returns whatever has arrived so far without waiting.
+type MigrationTransport interface {
+	Send(from, to int, models []*NetworkConfig) error
+	Receive(island int) ([]*NetworkConfig, error)
+}
+
+// DirTransport passes migrants through an inbox folder per island, so islands sharing a file system
+// (locally or over a network mount) can exchange models.
+type DirTransport struct {
+	Dir string
+}
+
+// islandDir is the generations directory of an island.
+func islandDir(dir string, island int) string {
+	return filepath.Join(dir, "island_"+strconv.Itoa(island))
+}
+
+// Send writes the migrants into the target island's inbox. Files are renamed into place so a
+// receiver never sees a partial model.
+func (t DirTransport) Send(from, to int, models []*NetworkConfig) error {
+	inbox := filepath.Join(islandDir(t.Dir, to), "inbox")
+	if err := os.MkdirAll(inbox, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create inbox for island %d: %w", to, err)
+	}
+	for _, model := range models {
+		name := fmt.Sprintf("from%d_%s.json", from, model.Metadata.ModelID)
+		tmpPath := filepath.Join(inbox, "."+name+".tmp")
+		if err := SaveModel(tmpPath, model); err != nil {
+			return fmt.Errorf("failed to send migrant to island %d: %w", to, err)
+		}
+		if err := os.Rename(tmpPath, filepath.Join(inbox, name)); err != nil {
+			return fmt.Errorf("failed to deliver migrant to island %d: %w", to, err)
+		}
+	}
+	return nil
+}
+
+// Receive loads and removes every migrant waiting in the island's inbox.
+func (t DirTransport) Receive(island int) ([]*NetworkConfig, error) {
+	inbox := filepath.Join(islandDir(t.Dir, island), "inbox")
+	files, err := os.ReadDir(inbox)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inbox of island %d: %w", island, err)
+	}
+
+	var models []*NetworkConfig
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ".json" || name[0] == '.' {
+			continue
+		}
+		path := filepath.Join(inbox, name)
+		model, err := LoadModel(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load migrant %s: %w", name, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove migrant %s: %w", name, err)
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// IslandNeighbours returns the islands that island sends migrants to.
+func IslandNeighbours(topology string, island, islands int) ([]int, error) {
+	switch topology {
+	case "ring", "":
+		if islands < 2 {
+			return nil, nil
+		}
+		return []int{(island + 1) % islands}, nil
+	case "full":
+		var neighbours []int
+		for i := 0; i < islands; i++ {
+			if i != island {
+				neighbours = append(neighbours, i)
+			}
+		}
+		return neighbours, nil
+	default:
+		return nil, fmt.Errorf("unknown island topology %q", topology)
+	}
+}
+
+// RunIslands evolves every island in its own goroutine until all have run opts.Generations generations.
+func RunIslands(opts IslandOptions) error {
+	if opts.Islands <= 0 {
+		return fmt.Errorf("number of islands must be positive")
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, opts.Islands)
+	for i := 0; i < opts.Islands; i++ {
+		wg.Add(1)
+		go func(island int) {
+			defer wg.Done()
+			errs[island] = RunIsland(opts, island)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("island %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// RunIsland evolves a single island. Run it once per process to spread islands across machines that
+// share opts.Dir, or use a custom Transport. An island resumes from its last saved generation.
+func RunIsland(opts IslandOptions, island int) error {
+	if opts.Evaluate == nil || opts.NewModel == nil {
+		return fmt.Errorf("island model needs NewModel and Evaluate functions")
+	}
+	if opts.PopulationSize <= 0 {
+		return fmt.Errorf("population size must be positive")
+	}
+	if opts.Survivors <= 0 || opts.Survivors > opts.PopulationSize {
+		opts.Survivors = (opts.PopulationSize + 1) / 2
+	}
+	if opts.Migrants <= 0 {
+		opts.Migrants = 1
+	}
+	if opts.Policy == nil {
+		opts.Policy = DefaultMutationPolicy()
+	}
+	if opts.Transport == nil {
+		opts.Transport = DirTransport{Dir: opts.Dir}
+	}
+	if opts.Selection == "" {
+		opts.Selection = "accuracy"
+	}
+	strategy, err := GetSelectionStrategy(opts.Selection)
+	if err != nil {
+		return err
+	}
+	neighbours, err := IslandNeighbours(opts.Topology, island, opts.Islands)
+	if err != nil {
+		return err
+	}
+
+	dir := islandDir(opts.Dir, island)
+	seed := DeriveSeed(opts.Seed, island)
+	population, start, err := loadIslandPopulation(dir)
+	if err != nil {
+		return err
+	}
+	for i := len(population); i < opts.PopulationSize; i++ {
+		rng := NewRand(DeriveSeed(seed, i))
+		model := opts.NewModel(rng)
+		model.Metadata.ModelID = fmt.Sprintf("island%d_gen%d_model%d", island, start, i)
+		population = append(population, model)
+	}
+
+	for gen := start; gen < start+opts.Generations; gen++ {
+		for _, model := range population {
+			model.Metadata.LastTestAccuracy = opts.Evaluate(model)
+		}
+		survivors := strategy(population, opts.Survivors)
+		fmt.Printf("Island %d generation %d: best accuracy %.2f%%\n", island, gen, bestAccuracy(population)*100)
+
+		if opts.MigrationInterval > 0 && (gen+1-start)%opts.MigrationInterval == 0 {
+			survivors, err = migrate(opts, island, neighbours, survivors)
+			if err != nil {
+				return err
+			}
+			// Keep migrants that were taken in with this generation so the lineage stays complete
+			inPopulation := make(map[*NetworkConfig]bool, len(population))
+			for _, model := range population {
+				inPopulation[model] = true
+			}
+			for _, model := range survivors {
+				if !inPopulation[model] {
+					population = append(population, model)
+				}
+			}
+		}
+
+		// Breed the next generation from the survivors, seeding past the indices used for the initial models
+		rng := NewRand(DeriveSeed(seed, opts.PopulationSize+gen))
+		next := make([]*NetworkConfig, 0, opts.PopulationSize)
+		for i := 0; len(next) < opts.PopulationSize; i++ {
+			parent := survivors[i%len(survivors)]
+			child, childRng := SpawnChild(parent, rng.Int(), fmt.Sprintf("island%d_gen%d_model%d", island, gen+1, i))
+			MutateNetworkWithPolicy(child, opts.Policy, opts.LearningRate, opts.MutationRate, childRng)
+			LinkParentChild(parent, child)
+			next = append(next, child)
+		}
+
+		if err := saveIslandGeneration(dir, gen, population); err != nil {
+			return err
+		}
+		population = next
+	}
+	return saveIslandGeneration(dir, start+opts.Generations, population)
+}
+
+// migrate sends the best survivors to every neighbour and replaces the weakest survivors with whatever
+// migrants have arrived. Migrants arrive as copies, so their own island keeps the originals.
+func migrate(opts IslandOptions, island int, neighbours []int, survivors []*NetworkConfig) ([]*NetworkConfig, error) {
+	sorted := append([]*NetworkConfig(nil), survivors...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Metadata.LastTestAccuracy > sorted[j].Metadata.LastTestAccuracy
+	})
+
+	migrants := sorted
+	if len(migrants) > opts.Migrants {
+		migrants = migrants[:opts.Migrants]
+	}
+	for _, neighbour := range neighbours {
+		if err := opts.Transport.Send(island, neighbour, migrants); err != nil {
+			return nil, err
+		}
+	}
+
+	arrived, err := opts.Transport.Receive(island)
+	if err != nil {
+		return nil, err
+	}
+	// The best arrivals replace the worst survivors, whatever order the neighbours sent them in
+	sort.SliceStable(arrived, func(i, j int) bool {
+		return arrived[i].Metadata.LastTestAccuracy > arrived[j].Metadata.LastTestAccuracy
+	})
+	for i, migrant := range arrived {
+		slot := len(sorted) - 1 - i
+		if slot < 0 || migrant.Metadata.LastTestAccuracy <= sorted[slot].Metadata.LastTestAccuracy {
+			continue
+		}
+		sorted[slot] = migrant
+	}
+	if len(arrived) > 0 {
+		fmt.Printf("Island %d received %d migrants\n", island, len(arrived))
+	}
+	return sorted, nil
+}
+
+// loadIslandPopulation resumes an island from its highest numbered generation folder.
+func loadIslandPopulation(dir string) ([]*NetworkConfig, int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read island directory: %w", err)
+	}
+
+	last := -1
+	for _, entry := range entries {
+		if gen, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() && gen > last {
+			last = gen
+		}
+	}
+	if last < 0 {
+		return nil, 0, nil
+	}
+
+	files, err := GetFilesWithExtension(filepath.Join(dir, strconv.Itoa(last)), ".json", 100000, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list generation %d: %w", last, err)
+	}
+	sort.Strings(files)
+	var population []*NetworkConfig
+	for _, file := range files {
+		model, err := LoadModel(file)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load %s: %w", file, err)
+		}
+		population = append(population, model)
+	}
+	return population, last, nil
+}
+
+// saveIslandGeneration writes a generation's models to dir/<gen>.
+func saveIslandGeneration(dir string, gen int, population []*NetworkConfig) error {
+	genDir := filepath.Join(dir, strconv.Itoa(gen))
+	if err := os.MkdirAll(genDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create generation directory: %w", err)
+	}
+	for _, model := range population {
+		if err := SaveModel(filepath.Join(genDir, model.Metadata.ModelID+".json"), model); err != nil {
+			return fmt.Errorf("failed to save %s: %w", model.Metadata.ModelID, err)
+		}
+	}
+	return nil
+}
+
+// bestAccuracy returns the highest LastTestAccuracy in the population.
+func bestAccuracy(population []*NetworkConfig) float64 {
+	best := 0.0
+	for _, model := range population {
+		if model.Metadata.LastTestAccuracy > best {
+			best = model.Metadata.LastTestAccuracy
+		}
+	}
+	return best
+}
@@ -7,10 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"math"
 	"path/filepath"
 	"sort"
 )
 
+// activationCacheDir is the folder inside a generation directory that holds the shared layer states.
+const activationCacheDir = "activation_cache"
+
 // LayerHashInfo holds the hash and its position within the hidden layers.
 type LayerHashInfo struct {
 	Position int    `json:"position"`
@@ -132,3 +136,196 @@ func AnalyzeLayerHashes(folderPath string, topN int) ([]LayerSequenceCount, erro
 
 	return layerSequenceCounts, nil
 }
+
+// VerifyLayerStates turns on the verification mode: every output resumed from a saved layer state is
+// compared with a full Feedforward of the same input whenever the input is at hand, and a difference
+// larger than VerifyTolerance is an error. It doubles the work and is meant for checking the storage.
+var VerifyLayerStates = false
+
+// VerifyTolerance is the largest difference the verification mode accepts. float64 shards resume bit for
+// bit; float32 shards need some slack.
+var VerifyTolerance = 0.0
+
+// VerifyResumedOutput compares output, computed by resuming the model from its state after hidden layer
+// layer, with a full Feedforward of the inputs. It returns the largest absolute difference, and an error
+// if the outputs don't have the same keys or differ by more than tolerance.
+func VerifyResumedOutput(config *NetworkConfig, inputs map[string]interface{}, output map[string]float64, layer int, tolerance float64) (float64, error) {
+	expected := Feedforward(config, inputs)
+	if len(expected) != len(output) {
+		return math.Inf(1), fmt.Errorf("output resumed from layer %d has %d values, a full pass has %d", layer, len(output), len(expected))
+	}
+	maxDiff := 0.0
+	for key, want := range expected {
+		got, ok := output[key]
+		if !ok {
+			return math.Inf(1), fmt.Errorf("output resumed from layer %d is missing %s", layer, key)
+		}
+		if diff := math.Abs(got - want); diff > maxDiff || math.IsNaN(diff) {
+			maxDiff = diff
+		}
+	}
+	if maxDiff > tolerance || math.IsNaN(maxDiff) {
+		return maxDiff, fmt.Errorf("output resumed from layer %d differs from a full pass by %g", layer, maxDiff)
+	}
+	return maxDiff, nil
+}
+
+// ActivationCache is a content-addressed store of hidden layer outputs shared by all models of a
+// generation. A state is keyed by the prefix hash of the layers that produced it and the input ID, so
+// models with identical leading layers share their activations and a child that only changed later
+// layers resumes from the deepest prefix it has in common with models already processed.
+type ActivationCache struct {
+	Dir      string
+	Mapped   *MappedShards // When set, states are read through these memory mappings
+	ReadOnly bool          // When set, states computed past the deepest cached layer are not saved
+}
+
+// NewActivationCache returns the cache of a generation directory.
+func NewActivationCache(generationDir string) *ActivationCache {
+	return &ActivationCache{Dir: filepath.Join(generationDir, activationCacheDir)}
+}
+
+// LayerPrefixHashes returns, for every hidden layer index, a hash of the input layer type and all hidden
+// layers up to and including it. Two models compute the same output at index i exactly when their
+// hashes at i match. Feedforward only looks at the type of the input layer, so nothing else of it is hashed.
+func LayerPrefixHashes(config *NetworkConfig) ([]string, error) {
+	layerHashes, err := GenerateLayerHashes(config)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(layerHashes))
+	for i, lh := range layerHashes {
+		hash := md5.Sum([]byte(config.Layers.Input.LayerType + lh.Hash))
+		hashes[i] = hex.EncodeToString(hash[:])
+	}
+	return hashes, nil
+}
+
+// ShardPath is the packed shard file holding the states of a prefix hash.
+func (c *ActivationCache) ShardPath(prefixHash string) string {
+	return filepath.Join(c.Dir, prefixHash+".shard")
+}
+
+// Has reports whether the state for a prefix hash and input is cached.
+func (c *ActivationCache) Has(prefixHash, inputID string) bool {
+	has := false
+	withShardStore(c.ShardPath(prefixHash), false, func(store *ShardStore) error {
+		has = store.Has(inputID)
+		return nil
+	})
+	return has
+}
+
+// Load reads a cached state.
+func (c *ActivationCache) Load(prefixHash, inputID string) (interface{}, error) {
+	if c.Mapped != nil {
+		if state, err := c.Mapped.State(c.ShardPath(prefixHash), inputID); err == nil {
+			return state, nil
+		}
+	}
+	var state interface{}
+	err := withShardStore(c.ShardPath(prefixHash), false, func(store *ShardStore) (err error) {
+		state, err = store.Get(inputID)
+		return err
+	})
+	return state, err
+}
+
+// Save writes a state to the cache.
+func (c *ActivationCache) Save(prefixHash, inputID string, state interface{}) error {
+	return withShardStore(c.ShardPath(prefixHash), true, func(store *ShardStore) error {
+		return store.Put(inputID, state)
+	})
+}
+
+// DeepestCachedLayer returns the deepest hidden layer index up to maxLayer whose state is cached for
+// the input, or -1 if none is.
+func (c *ActivationCache) DeepestCachedLayer(hashes []string, inputID string, maxLayer int) int {
+	if maxLayer >= len(hashes) {
+		maxLayer = len(hashes) - 1
+	}
+	for i := maxLayer; i >= 0; i-- {
+		if c.Has(hashes[i], inputID) {
+			return i
+		}
+	}
+	return -1
+}
+
+// LayerState returns the output of hidden layer layer for the input. It resumes from the deepest cached
+// prefix and caches every state it computes on the way, unless the cache is read-only. loadInputs is only
+// called when nothing is cached; it may be nil, in which case a miss is an error. It also returns the
+// layer it resumed from.
+func (c *ActivationCache) LayerState(config *NetworkConfig, hashes []string, layer int, inputID string, loadInputs func() map[string]interface{}) (interface{}, int, error) {
+	start := c.DeepestCachedLayer(hashes, inputID, layer)
+	var data interface{}
+	if start >= 0 {
+		state, err := c.Load(hashes[start], inputID)
+		if err != nil {
+			return nil, start, err
+		}
+		data = state
+	} else {
+		if loadInputs == nil {
+			return nil, start, fmt.Errorf("no cached state for input %s", inputID)
+		}
+		if data = networkInput(config, loadInputs()); data == nil {
+			return nil, start, fmt.Errorf("input %s does not fit the input layer", inputID)
+		}
+	}
+
+	for i := start + 1; i <= layer; i++ {
+		data = processLayer(config.Layers.Hidden[i], data)
+		if c.ReadOnly {
+			continue
+		}
+		if err := c.Save(hashes[i], inputID, data); err != nil {
+			return nil, start, err
+		}
+	}
+	return data, start, nil
+}
+
+// Feedforward runs the model on the input through the cache: the hidden layers come from the deepest
+// cached prefix and the rest is finished with ContinueFeedforward. A read-only cache resumes straight from
+// the deepest cached state and writes nothing. It also returns the layer it resumed from, -1 when it
+// started from the input.
+func (c *ActivationCache) Feedforward(config *NetworkConfig, hashes []string, inputID string, loadInputs func() map[string]interface{}) (map[string]float64, int, error) {
+	last := GetLastHiddenLayerIndex(config)
+	if last < 0 {
+		if loadInputs == nil {
+			return nil, -1, fmt.Errorf("model has no hidden layers to cache")
+		}
+		return Feedforward(config, loadInputs()), -1, nil
+	}
+	var output map[string]float64
+	start := -1
+	if c.ReadOnly {
+		start = c.DeepestCachedLayer(hashes, inputID, last)
+		if start < 0 {
+			if loadInputs == nil {
+				return nil, start, fmt.Errorf("no cached state for input %s", inputID)
+			}
+			return Feedforward(config, loadInputs()), start, nil
+		}
+		state, err := c.Load(hashes[start], inputID)
+		if err != nil {
+			return nil, start, err
+		}
+		output = ContinueFeedforward(config, state, start)
+	} else {
+		state, resumed, err := c.LayerState(config, hashes, last, inputID, loadInputs)
+		if err != nil {
+			return nil, resumed, err
+		}
+		start = resumed
+		output = ContinueFeedforward(config, state, last)
+	}
+	if VerifyLayerStates && start >= 0 && loadInputs != nil {
+		if _, err := VerifyResumedOutput(config, loadInputs(), output, start, VerifyTolerance); err != nil {
+			return nil, start, fmt.Errorf("cached state of input %s: %w", inputID, err)
+		}
+	}
+	return output, start, nil
+}
@@ -0,0 +1,435 @@
+package dense
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layerStateEntryName matches the files and folders a model keeps per hidden layer: the packed shard and
+// its index, the reference to an activation cache shard, the legacy CSV shard folder and the folder of
+// learned/not learned results.
+var layerStateEntryName = regexp.MustCompile(`^layer_(\d+)(\.shard|\.shard\.idx|\.ref|_shards|_learnedornot)$`)
+
+// LayerStateEntry is a unit of saved layer states that is accounted and deleted as a whole: everything a
+// model keeps for one hidden layer, or one shard of a generation's activation cache.
+type LayerStateEntry struct {
+	Generation int
+	ModelID    string // Owning model, empty for activation cache shards
+	Layer      int    // Hidden layer index, -1 for activation cache shards
+	PrefixHash string // Set for activation cache shards
+	Paths      []string
+	Bytes      int64
+	LastUsed   time.Time // Latest modification time; reads mark shard files modified, see ShardUseResolution
+	Selected   bool      // The model, or a model using the cache shard, was selected into the next generation
+	Live       bool      // A model of the newest generation still reads these states, so they are never deleted
+}
+
+// ModelStateUsage is the disk space taken by the saved layer states of one model.
+type ModelStateUsage struct {
+	ModelID  string
+	Bytes    int64
+	Selected bool
+	Live     bool
+}
+
+// GenerationStateUsage is the disk space taken by the saved layer states of one generation.
+type GenerationStateUsage struct {
+	Generation           int
+	Models               []ModelStateUsage
+	ActivationCacheBytes int64
+	Bytes                int64
+}
+
+// LayerStateManager accounts for and garbage collects the layer states saved in a generations directory.
+// A model counts as selected when a model of a later generation lists it as a parent. The models of
+// the newest generation are live, and so are the parents they resume their evaluation from; the states of
+// live models are never deleted. It should not run while states are being saved.
+type LayerStateManager struct {
+	GenerationsDir string
+	Quota          int64 // Bytes of layer states EnforceQuota keeps, 0 for no limit
+	DryRun         bool  // Report what would be deleted without deleting it
+}
+
+// NewLayerStateManager returns a manager for the generations directory with the given disk quota in bytes.
+func NewLayerStateManager(generationsDir string, quota int64) *LayerStateManager {
+	return &LayerStateManager{GenerationsDir: generationsDir, Quota: quota}
+}
+
+// stateModel is a model found while scanning a generation.
+type stateModel struct {
+	generation int
+	id         string
+	folder     string
+	config     *NetworkConfig
+	hashes     []string
+	selected   bool
+	live       bool
+}
+
+// Scan lists every layer state entry in the generations directory, oldest generation first.
+func (m *LayerStateManager) Scan() ([]*LayerStateEntry, error) {
+	generations, err := numberedGenerations(m.GenerationsDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(generations) == 0 {
+		return nil, nil
+	}
+	newest := generations[len(generations)-1]
+
+	// Load the models of every generation
+	models := make(map[int][]*stateModel)
+	byID := make(map[string]*stateModel)
+	for _, gen := range generations {
+		genDir := filepath.Join(m.GenerationsDir, strconv.Itoa(gen))
+		files, err := os.ReadDir(genDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generation %d: %w", gen, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			modelPath := filepath.Join(genDir, file.Name())
+			config, err := LoadModel(modelPath)
+			if err != nil {
+				fmt.Printf("Skipping %s: %v\n", modelPath, err)
+				continue
+			}
+			model := &stateModel{generation: gen, id: config.Metadata.ModelID, folder: strings.TrimSuffix(modelPath, ".json"), config: config}
+			if model.id == "" {
+				model.id = strings.TrimSuffix(file.Name(), ".json")
+			}
+			if model.hashes, err = LayerPrefixHashes(config); err != nil {
+				return nil, fmt.Errorf("failed to hash layers of %s: %w", modelPath, err)
+			}
+			models[gen] = append(models[gen], model)
+			if _, ok := byID[model.id]; !ok {
+				byID[model.id] = model
+			}
+		}
+	}
+
+	// A model is selected when a later generation holds a child of it. The newest generation and the
+	// parents its models resume from are live.
+	for _, gen := range generations {
+		for _, model := range models[gen] {
+			for _, parentID := range model.config.Metadata.ParentModelIDs {
+				if parent, ok := byID[parentID]; ok && parent.generation < gen {
+					parent.selected = true
+					if gen == newest {
+						parent.live = true
+					}
+				}
+			}
+			if gen == newest {
+				model.live = true
+			}
+		}
+	}
+
+	var entries []*LayerStateEntry
+	for _, gen := range generations {
+		genEntries, err := m.scanGeneration(gen, models[gen])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, genEntries...)
+	}
+	return entries, nil
+}
+
+// scanGeneration lists the model layer states and the activation cache shards of a generation.
+func (m *LayerStateManager) scanGeneration(gen int, models []*stateModel) ([]*LayerStateEntry, error) {
+	genDir := filepath.Join(m.GenerationsDir, strconv.Itoa(gen))
+	byFolder := make(map[string]*stateModel)
+	selectedHashes := make(map[string]bool)
+	liveHashes := make(map[string]bool)
+	for _, model := range models {
+		byFolder[filepath.Base(model.folder)] = model
+		for _, hash := range model.hashes {
+			selectedHashes[hash] = selectedHashes[hash] || model.selected
+			liveHashes[hash] = liveHashes[hash] || model.live
+		}
+	}
+
+	files, err := os.ReadDir(genDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation %d: %w", gen, err)
+	}
+	var entries []*LayerStateEntry
+	for _, file := range files {
+		if !file.IsDir() || file.Name() == activationCacheDir {
+			continue
+		}
+		folder := filepath.Join(genDir, file.Name())
+		modelEntries, err := scanModelStates(folder)
+		if err != nil {
+			return nil, err
+		}
+
+		// Folders of models that no longer exist are neither selected nor live
+		model := byFolder[file.Name()]
+		for _, entry := range modelEntries {
+			entry.Generation = gen
+			entry.ModelID = file.Name()
+			if model != nil {
+				entry.ModelID = model.id
+				entry.Selected, entry.Live = model.selected, model.live
+			}
+			// A reference keeps the cache shard it points to
+			for _, path := range entry.Paths {
+				if strings.HasSuffix(path, ".ref") {
+					if ref, err := os.ReadFile(path); err == nil {
+						hash := strings.TrimSpace(string(ref))
+						selectedHashes[hash] = selectedHashes[hash] || entry.Selected
+						liveHashes[hash] = liveHashes[hash] || entry.Live
+					}
+				}
+			}
+		}
+		entries = append(entries, modelEntries...)
+	}
+
+	cacheFiles, err := os.ReadDir(filepath.Join(genDir, activationCacheDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read activation cache of generation %d: %w", gen, err)
+	}
+	for _, file := range cacheFiles {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".shard" {
+			continue
+		}
+		hash := strings.TrimSuffix(file.Name(), ".shard")
+		path := filepath.Join(genDir, activationCacheDir, file.Name())
+		entry := &LayerStateEntry{Generation: gen, Layer: -1, PrefixHash: hash, Paths: []string{path, path + ".idx"}, Selected: selectedHashes[hash], Live: liveHashes[hash]}
+		if err := entry.measure(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// scanModelStates groups the layer state files and folders of a model folder by layer.
+func scanModelStates(folder string) ([]*LayerStateEntry, error) {
+	files, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model folder %s: %w", folder, err)
+	}
+	byLayer := make(map[int]*LayerStateEntry)
+	var entries []*LayerStateEntry
+	for _, file := range files {
+		match := layerStateEntryName.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		layer, _ := strconv.Atoi(match[1])
+		entry, ok := byLayer[layer]
+		if !ok {
+			entry = &LayerStateEntry{Layer: layer}
+			byLayer[layer] = entry
+			entries = append(entries, entry)
+		}
+		entry.Paths = append(entry.Paths, filepath.Join(folder, file.Name()))
+	}
+	for _, entry := range entries {
+		if err := entry.measure(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// measure adds up the size of the entry's files and finds the most recent modification.
+func (e *LayerStateEntry) measure() error {
+	e.Bytes, e.LastUsed = 0, time.Time{}
+	for _, path := range e.Paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				e.Bytes += info.Size()
+			}
+			if info.ModTime().After(e.LastUsed) {
+				e.LastUsed = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to measure %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Usage returns the disk space taken by layer states per generation and model.
+func (m *LayerStateManager) Usage() ([]GenerationStateUsage, error) {
+	entries, err := m.Scan()
+	if err != nil {
+		return nil, err
+	}
+	var usage []GenerationStateUsage
+	modelIndex := make(map[string]int)
+	for _, entry := range entries {
+		if len(usage) == 0 || usage[len(usage)-1].Generation != entry.Generation {
+			usage = append(usage, GenerationStateUsage{Generation: entry.Generation})
+			modelIndex = make(map[string]int)
+		}
+		gen := &usage[len(usage)-1]
+		gen.Bytes += entry.Bytes
+		if entry.Layer < 0 {
+			gen.ActivationCacheBytes += entry.Bytes
+			continue
+		}
+		i, ok := modelIndex[entry.ModelID]
+		if !ok {
+			i = len(gen.Models)
+			modelIndex[entry.ModelID] = i
+			gen.Models = append(gen.Models, ModelStateUsage{ModelID: entry.ModelID, Selected: entry.Selected, Live: entry.Live})
+		}
+		gen.Models[i].Bytes += entry.Bytes
+	}
+	return usage, nil
+}
+
+// EvictUnselected deletes the states of models that were not selected into the next generation, and the
+// activation cache shards none of the selected models use. The newest generation is left alone since its
+// selection hasn't happened yet. It returns the number of bytes freed.
+func (m *LayerStateManager) EvictUnselected() (int64, error) {
+	entries, err := m.Scan()
+	if err != nil {
+		return 0, err
+	}
+	newest := -1
+	for _, entry := range entries {
+		if entry.Generation > newest {
+			newest = entry.Generation
+		}
+	}
+
+	var freed int64
+	for _, entry := range entries {
+		if entry.Generation == newest || entry.Selected || entry.Live {
+			continue
+		}
+		if err := m.remove(entry); err != nil {
+			return freed, err
+		}
+		freed += entry.Bytes
+	}
+	return freed, nil
+}
+
+// EnforceQuota deletes the least recently used states until all of them fit in the quota. Live states
+// are kept even if the quota can't be met without them. It returns the number of bytes freed.
+func (m *LayerStateManager) EnforceQuota() (int64, error) {
+	if m.Quota <= 0 {
+		return 0, nil
+	}
+	entries, err := m.Scan()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	var candidates []*LayerStateEntry
+	for _, entry := range entries {
+		total += entry.Bytes
+		if !entry.Live {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastUsed.Before(candidates[j].LastUsed)
+	})
+
+	var freed int64
+	for _, entry := range candidates {
+		if total-freed <= m.Quota {
+			break
+		}
+		if err := m.remove(entry); err != nil {
+			return freed, err
+		}
+		freed += entry.Bytes
+	}
+	if total-freed > m.Quota {
+		fmt.Printf("Layer states take %d bytes after eviction, over the quota of %d; the rest is still in use\n", total-freed, m.Quota)
+	}
+	return freed, nil
+}
+
+// Collect evicts the states of unselected models and then enforces the quota.
+func (m *LayerStateManager) Collect() (int64, error) {
+	freed, err := m.EvictUnselected()
+	if err != nil {
+		return freed, err
+	}
+	evicted, err := m.EnforceQuota()
+	return freed + evicted, err
+}
+
+// remove deletes an entry, closing any open handle on its shard files first, and then the model folder
+// if nothing is left in it.
+func (m *LayerStateManager) remove(entry *LayerStateEntry) error {
+	what := fmt.Sprintf("layer %d of model %s", entry.Layer, entry.ModelID)
+	if entry.Layer < 0 {
+		what = "activation cache shard " + entry.PrefixHash
+	}
+	if m.DryRun {
+		fmt.Printf("Would delete %s in generation %d (%d bytes)\n", what, entry.Generation, entry.Bytes)
+		return nil
+	}
+
+	for _, path := range entry.Paths {
+		if strings.HasSuffix(path, ".shard") {
+			if err := closeSharedShardStore(path); err != nil {
+				return fmt.Errorf("failed to close %s: %w", path, err)
+			}
+			if err := MappedLayerStates.Forget(path); err != nil {
+				return fmt.Errorf("failed to unmap %s: %w", path, err)
+			}
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	}
+	if entry.Layer >= 0 && len(entry.Paths) > 0 {
+		os.Remove(filepath.Dir(entry.Paths[0])) // Only succeeds once the folder is empty
+	}
+	fmt.Printf("Deleted %s in generation %d (%d bytes)\n", what, entry.Generation, entry.Bytes)
+	return nil
+}
+
+// numberedGenerations returns the numbers of the generation folders in a directory in ascending order.
+func numberedGenerations(generationsDir string) ([]int, error) {
+	entries, err := os.ReadDir(generationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generations directory: %w", err)
+	}
+	var generations []int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if gen, err := strconv.Atoi(entry.Name()); err == nil {
+			generations = append(generations, gen)
+		}
+	}
+	sort.Ints(generations)
+	return generations, nil
+}
@@ -0,0 +1,261 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LineageNode is one model in the family tree.
+type LineageNode struct {
+	ModelID          string   `json:"modelID"`
+	Generation       int      `json:"generation"`
+	Path             string   `json:"path,omitempty"`
+	Accuracy         float64  `json:"accuracy"` // LastTestAccuracy
+	TrainingAccuracy float64  `json:"trainingAccuracy"`
+	Parents          []string `json:"parents,omitempty"`
+	Children         []string `json:"children,omitempty"`
+	Descendants      int      `json:"descendants"`
+	Mutations        int      `json:"mutations"`         // Length of the recorded mutation lineage
+	Missing          bool     `json:"missing,omitempty"` // Referenced by another model but not found on disk
+}
+
+// LineageEdge connects a parent model to a child model.
+type LineageEdge struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// LineageGraph is the family tree of all models found in a generations directory.
+type LineageGraph struct {
+	Nodes []*LineageNode `json:"nodes"`
+	Edges []LineageEdge  `json:"edges"`
+	index map[string]*LineageNode
+}
+
+// LinkParentChild records that child was derived from parent in the metadata of both models.
+func LinkParentChild(parent, child *NetworkConfig) {
+	parentID := parent.Metadata.ModelID
+	childID := child.Metadata.ModelID
+	if !containsString(child.Metadata.ParentModelIDs, parentID) {
+		child.Metadata.ParentModelIDs = append(child.Metadata.ParentModelIDs, parentID)
+	}
+	if !containsString(parent.Metadata.ChildModelIDs, childID) {
+		parent.Metadata.ChildModelIDs = append(parent.Metadata.ChildModelIDs, childID)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildLineageGraph loads every model in the numbered generation folders of generationsDir
+// (e.g. host/generations/0, 1, ...) and links them through their parent and child IDs.
+// A model found in several generations is kept once, at the generation it first appeared in.
+func BuildLineageGraph(generationsDir string) (*LineageGraph, error) {
+	generations, err := numberedGenerations(generationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &LineageGraph{index: make(map[string]*LineageNode)}
+	for _, gen := range generations {
+		genDir := filepath.Join(generationsDir, strconv.Itoa(gen))
+		files, err := os.ReadDir(genDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generation %d: %w", gen, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			modelPath := filepath.Join(genDir, file.Name())
+			config, err := LoadModel(modelPath)
+			if err != nil {
+				fmt.Printf("Skipping %s: %v\n", modelPath, err)
+				continue
+			}
+			graph.addModel(config, gen, modelPath)
+		}
+	}
+
+	graph.link()
+	graph.countDescendants()
+	return graph, nil
+}
+
+// addModel adds a loaded model as a node, keeping the first occurrence of an ID.
+func (g *LineageGraph) addModel(config *NetworkConfig, generation int, path string) {
+	id := config.Metadata.ModelID
+	if id == "" {
+		id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if _, ok := g.index[id]; ok {
+		return
+	}
+
+	node := &LineageNode{
+		ModelID:          id,
+		Generation:       generation,
+		Path:             path,
+		Accuracy:         config.Metadata.LastTestAccuracy,
+		TrainingAccuracy: config.Metadata.LastTrainingAccuracy,
+		Parents:          append([]string(nil), config.Metadata.ParentModelIDs...),
+		Children:         append([]string(nil), config.Metadata.ChildModelIDs...),
+		Mutations:        config.Metadata.LineageDropped + len(config.Metadata.Lineage),
+	}
+	g.index[id] = node
+	g.Nodes = append(g.Nodes, node)
+}
+
+// link builds the edge list from both parent and child references, adding placeholders for missing models.
+func (g *LineageGraph) link() {
+	seen := make(map[LineageEdge]bool)
+	addEdge := func(parent, child string) {
+		edge := LineageEdge{Parent: parent, Child: child}
+		if parent == child || seen[edge] {
+			return
+		}
+		seen[edge] = true
+		g.Edges = append(g.Edges, edge)
+	}
+
+	for _, node := range append([]*LineageNode(nil), g.Nodes...) {
+		for _, parent := range node.Parents {
+			g.placeholder(parent, node.Generation-1)
+			addEdge(parent, node.ModelID)
+		}
+		for _, child := range node.Children {
+			g.placeholder(child, node.Generation+1)
+			addEdge(node.ModelID, child)
+		}
+	}
+
+	// Make both sides of every edge agree
+	for _, edge := range g.Edges {
+		parent, child := g.index[edge.Parent], g.index[edge.Child]
+		if !containsString(parent.Children, edge.Child) {
+			parent.Children = append(parent.Children, edge.Child)
+		}
+		if !containsString(child.Parents, edge.Parent) {
+			child.Parents = append(child.Parents, edge.Parent)
+		}
+	}
+}
+
+// placeholder adds a node for a model that is referenced but was not found on disk.
+func (g *LineageGraph) placeholder(id string, generation int) {
+	if _, ok := g.index[id]; ok {
+		return
+	}
+	if generation < 0 {
+		generation = 0
+	}
+	node := &LineageNode{ModelID: id, Generation: generation, Missing: true}
+	g.index[id] = node
+	g.Nodes = append(g.Nodes, node)
+}
+
+// countDescendants sets the number of distinct models descending from each node.
+func (g *LineageGraph) countDescendants() {
+	for _, node := range g.Nodes {
+		visited := map[string]bool{node.ModelID: true}
+		stack := append([]string(nil), node.Children...)
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			if child, ok := g.index[id]; ok {
+				stack = append(stack, child.Children...)
+			}
+		}
+		node.Descendants = len(visited) - 1
+	}
+}
+
+// Roots returns the models without known parents, most descendants first, so the dominant lineages come first.
+func (g *LineageGraph) Roots() []*LineageNode {
+	var roots []*LineageNode
+	for _, node := range g.Nodes {
+		if len(node.Parents) == 0 {
+			roots = append(roots, node)
+		}
+	}
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].Descendants > roots[j].Descendants
+	})
+	return roots
+}
+
+// WriteJSON writes the graph as indented JSON.
+func (g *LineageGraph) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(g); err != nil {
+		return fmt.Errorf("failed to encode lineage graph: %w", err)
+	}
+	return nil
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Nodes are grouped by generation, coloured from
+// red (low accuracy) to green (high accuracy) and drawn thicker the more descendants they have.
+func (g *LineageGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph lineage {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+
+	byGeneration := make(map[int][]*LineageNode)
+	var generations []int
+	for _, node := range g.Nodes {
+		if _, ok := byGeneration[node.Generation]; !ok {
+			generations = append(generations, node.Generation)
+		}
+		byGeneration[node.Generation] = append(byGeneration[node.Generation], node)
+	}
+	sort.Ints(generations)
+
+	for _, gen := range generations {
+		fmt.Fprintf(&b, "  subgraph cluster_gen_%d {\n", gen)
+		fmt.Fprintf(&b, "    label=\"Generation %d\";\n", gen)
+		for _, node := range byGeneration[gen] {
+			penWidth := 1 + math.Log2(1+float64(node.Descendants))
+			if node.Missing {
+				fmt.Fprintf(&b, "    %q [label=\"%s\\nmissing\", fillcolor=\"lightgrey\", style=\"filled,dashed\"];\n", node.ModelID, node.ModelID)
+				continue
+			}
+			fmt.Fprintf(&b, "    %q [label=\"%s\\naccuracy %.2f%%\\n%d descendants\", fillcolor=\"%.3f 0.6 1.0\", penwidth=%.2f];\n",
+				node.ModelID, node.ModelID, node.Accuracy*100, node.Descendants, accuracyHue(node.Accuracy), penWidth)
+		}
+		b.WriteString("  }\n")
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q;\n", edge.Parent, edge.Child)
+	}
+	b.WriteString("}\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("failed to write DOT graph: %w", err)
+	}
+	return nil
+}
+
+// accuracyHue maps an accuracy in [0, 1] to an HSV hue between red and green.
+func accuracyHue(accuracy float64) float64 {
+	return math.Max(0, math.Min(1, accuracy)) * 0.333
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"dense"
+)
+
+func main() {
+	// Setup command-line flags
+	generationsDir := flag.String("dir", "./host/generations", "Directory containing the numbered generation folders")
+	dotPath := flag.String("dot", "lineage.dot", "Output path for the Graphviz DOT file")
+	jsonPath := flag.String("json", "lineage.json", "Output path for the JSON file")
+	top := flag.Int("top", 5, "Number of dominant lineages to print")
+	flag.Parse()
+
+	graph, err := dense.BuildLineageGraph(*generationsDir)
+	if err != nil {
+		fmt.Println("Error building lineage graph:", err)
+		return
+	}
+	fmt.Printf("Found %d models and %d parent/child links\n", len(graph.Nodes), len(graph.Edges))
+
+	if err := writeFile(*dotPath, graph.WriteDOT); err != nil {
+		fmt.Println("Error writing DOT file:", err)
+		return
+	}
+	fmt.Printf("Saved DOT graph to %s (render with: dot -Tsvg %s -o lineage.svg)\n", *dotPath, *dotPath)
+
+	if err := writeFile(*jsonPath, graph.WriteJSON); err != nil {
+		fmt.Println("Error writing JSON file:", err)
+		return
+	}
+	fmt.Printf("Saved JSON graph to %s\n", *jsonPath)
+
+	// Show which lineages dominate
+	roots := graph.Roots()
+	if len(roots) > *top {
+		roots = roots[:*top]
+	}
+	fmt.Println("Dominant lineages:")
+	for _, root := range roots {
+		fmt.Printf("  %s (generation %d, accuracy %.2f%%): %d descendants\n", root.ModelID, root.Generation, root.Accuracy*100, root.Descendants)
+	}
+}
+
+// writeFile creates the file at path and lets write fill it.
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return write(file)
+}
@@ -3,45 +3,45 @@ package main
 import (
 	"fmt"
 	"math/rand"
-	"time"
 
 	"dense" // Assuming dense is in the same directory or properly imported
 )
 
 func main() {
-	// Seed the random number generator
-	rand.Seed(time.Now().UnixNano())
+	seed := dense.NewSeed()
+	fmt.Printf("Using seed %d\n", seed)
+	rng := dense.NewRand(seed)
 
 	// Test 1: FFNN Only
 	fmt.Println("Test 1: FFNN Only")
-	ffnnConfig := createFFNNModel()
+	ffnnConfig := createFFNNModel(rng)
 	testFFNN(ffnnConfig)
 
 	// Test 2: FFNN with LSTM
 	fmt.Println("\nTest 2: FFNN with LSTM")
-	ffnnLSTMConfig := createFFNNLSTMModel()
+	ffnnLSTMConfig := createFFNNLSTMModel(rng)
 	testFFNNLSTM(ffnnLSTMConfig)
 
 	// Test 3: FFNN with CNN
 	fmt.Println("\nTest 3: FFNN with CNN")
-	ffnnCNNConfig := createFFNNCNNModel()
+	ffnnCNNConfig := createFFNNCNNModel(rng)
 	testFFNNCNN(ffnnCNNConfig)
 
 	// Test 4: FFNN with CNN and LSTM
 	fmt.Println("\nTest 4: FFNN with CNN and LSTM")
-	fullModelConfig := createFullModel()
+	fullModelConfig := createFullModel(rng)
 	testFullModel(fullModelConfig)
 }
 
 // Test 1: Create a simple FFNN model
-func createFFNNModel() *dense.NetworkConfig {
+func createFFNNModel(rng *rand.Rand) *dense.NetworkConfig {
 	numInputs := 3
 	numOutputs := 1
 	outputActivationTypes := []string{"sigmoid"}
 	modelID := "ffnn_model"
 	projectName := "FFNN Test"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to be dense
 	config.Layers.Input.LayerType = "dense"
@@ -56,12 +56,12 @@ func createFFNNModel() *dense.NetworkConfig {
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
 							for j := 0; j < numInputs; j++ {
 								inputID := fmt.Sprintf("input%d", j)
-								connections[inputID] = dense.Connection{Weight: rand.Float64()}
+								connections[inputID] = dense.Connection{Weight: rng.Float64()}
 							}
 							return connections
 						}(),
@@ -79,12 +79,12 @@ func createFFNNModel() *dense.NetworkConfig {
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "sigmoid",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
 				for j := 0; j < 4; j++ {
 					hiddenID := fmt.Sprintf("hidden%d", j)
-					connections[hiddenID] = dense.Connection{Weight: rand.Float64()}
+					connections[hiddenID] = dense.Connection{Weight: rng.Float64()}
 				}
 				return connections
 			}(),
@@ -110,14 +110,14 @@ func testFFNN(config *dense.NetworkConfig) {
 }
 
 // Test 2: Create an FFNN model with an LSTM layer
-func createFFNNLSTMModel() *dense.NetworkConfig {
+func createFFNNLSTMModel(rng *rand.Rand) *dense.NetworkConfig {
 	numInputs := 3
 	numOutputs := 1
 	outputActivationTypes := []string{"sigmoid"}
 	modelID := "ffnn_lstm_model"
 	projectName := "FFNN LSTM Test"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to be dense
 	config.Layers.Input.LayerType = "dense"
@@ -132,12 +132,12 @@ func createFFNNLSTMModel() *dense.NetworkConfig {
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
 							for j := 0; j < numInputs; j++ {
 								inputID := fmt.Sprintf("input%d", j)
-								connections[inputID] = dense.Connection{Weight: rand.Float64()}
+								connections[inputID] = dense.Connection{Weight: rng.Float64()}
 							}
 							return connections
 						}(),
@@ -150,11 +150,11 @@ func createFFNNLSTMModel() *dense.NetworkConfig {
 			LayerType: "lstm",
 			LSTMCells: []dense.LSTMCell{
 				{
-					InputWeights:  randomSlice(4),
-					ForgetWeights: randomSlice(4),
-					OutputWeights: randomSlice(4),
-					CellWeights:   randomSlice(4),
-					Bias:          rand.Float64(),
+					InputWeights:  randomSlice(4, rng),
+					ForgetWeights: randomSlice(4, rng),
+					OutputWeights: randomSlice(4, rng),
+					CellWeights:   randomSlice(4, rng),
+					Bias:          rng.Float64(),
 				},
 			},
 		},
@@ -167,10 +167,10 @@ func createFFNNLSTMModel() *dense.NetworkConfig {
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "sigmoid",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
-				connections["lstm0"] = dense.Connection{Weight: rand.Float64()}
+				connections["lstm0"] = dense.Connection{Weight: rng.Float64()}
 				return connections
 			}(),
 		}
@@ -195,14 +195,14 @@ func testFFNNLSTM(config *dense.NetworkConfig) {
 }
 
 // Test 3: Create an FFNN model with a CNN layer
-func createFFNNCNNModel() *dense.NetworkConfig {
+func createFFNNCNNModel(rng *rand.Rand) *dense.NetworkConfig {
 	numInputs := 3
 	numOutputs := 1
 	outputActivationTypes := []string{"sigmoid"}
 	modelID := "ffnn_cnn_model"
 	projectName := "FFNN CNN Test"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to be convolutional
 	config.Layers.Input = dense.Layer{
@@ -216,11 +216,11 @@ func createFFNNCNNModel() *dense.NetworkConfig {
 			Filters: []dense.Filter{
 				{
 					Weights: [][]float64{
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
 					},
-					Bias: rand.Float64(),
+					Bias: rng.Float64(),
 				},
 			},
 			Stride:  1,
@@ -235,12 +235,12 @@ func createFFNNCNNModel() *dense.NetworkConfig {
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
 							for j := 0; j < 9; j++ {
 								inputID := fmt.Sprintf("conv_output%d", j)
-								connections[inputID] = dense.Connection{Weight: rand.Float64()}
+								connections[inputID] = dense.Connection{Weight: rng.Float64()}
 							}
 							return connections
 						}(),
@@ -258,12 +258,12 @@ func createFFNNCNNModel() *dense.NetworkConfig {
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "sigmoid",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
 				for j := 0; j < 4; j++ {
 					hiddenID := fmt.Sprintf("hidden%d", j)
-					connections[hiddenID] = dense.Connection{Weight: rand.Float64()}
+					connections[hiddenID] = dense.Connection{Weight: rng.Float64()}
 				}
 				return connections
 			}(),
@@ -293,14 +293,14 @@ func testFFNNCNN(config *dense.NetworkConfig) {
 }
 
 // Test 4: Create a model with FFNN, CNN, and LSTM layers
-func createFullModel() *dense.NetworkConfig {
+func createFullModel(rng *rand.Rand) *dense.NetworkConfig {
 	numInputs := 3
 	numOutputs := 1
 	outputActivationTypes := []string{"sigmoid"}
 	modelID := "full_model"
 	projectName := "Full Model Test"
 
-	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName)
+	config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, outputActivationTypes, modelID, projectName, rng)
 
 	// Adjust input layer to be convolutional
 	config.Layers.Input = dense.Layer{
@@ -314,11 +314,11 @@ func createFullModel() *dense.NetworkConfig {
 			Filters: []dense.Filter{
 				{
 					Weights: [][]float64{
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
-						{rand.Float64(), rand.Float64(), rand.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
+						{rng.Float64(), rng.Float64(), rng.Float64()},
 					},
-					Bias: rand.Float64(),
+					Bias: rng.Float64(),
 				},
 			},
 			Stride:  1,
@@ -328,11 +328,11 @@ func createFullModel() *dense.NetworkConfig {
 			LayerType: "lstm",
 			LSTMCells: []dense.LSTMCell{
 				{
-					InputWeights:  randomSlice(9), // Assuming output from CNN is flattened to length 9
-					ForgetWeights: randomSlice(9),
-					OutputWeights: randomSlice(9),
-					CellWeights:   randomSlice(9),
-					Bias:          rand.Float64(),
+					InputWeights:  randomSlice(9, rng), // Assuming output from CNN is flattened to length 9
+					ForgetWeights: randomSlice(9, rng),
+					OutputWeights: randomSlice(9, rng),
+					CellWeights:   randomSlice(9, rng),
+					Bias:          rng.Float64(),
 				},
 			},
 		},
@@ -344,10 +344,10 @@ func createFullModel() *dense.NetworkConfig {
 					neuronID := fmt.Sprintf("hidden%d", i)
 					neurons[neuronID] = dense.Neuron{
 						ActivationType: "relu",
-						Bias:           rand.Float64(),
+						Bias:           rng.Float64(),
 						Connections: func() map[string]dense.Connection {
 							connections := make(map[string]dense.Connection)
-							connections["lstm0"] = dense.Connection{Weight: rand.Float64()}
+							connections["lstm0"] = dense.Connection{Weight: rng.Float64()}
 							return connections
 						}(),
 					}
@@ -364,12 +364,12 @@ func createFullModel() *dense.NetworkConfig {
 		neuronID := fmt.Sprintf("output%d", i)
 		config.Layers.Output.Neurons[neuronID] = dense.Neuron{
 			ActivationType: "sigmoid",
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 			Connections: func() map[string]dense.Connection {
 				connections := make(map[string]dense.Connection)
 				for j := 0; j < 4; j++ {
 					hiddenID := fmt.Sprintf("hidden%d", j)
-					connections[hiddenID] = dense.Connection{Weight: rand.Float64()}
+					connections[hiddenID] = dense.Connection{Weight: rng.Float64()}
 				}
 				return connections
 			}(),
@@ -399,10 +399,10 @@ func testFullModel(config *dense.NetworkConfig) {
 }
 
 // Helper function to create random slice of floats
-func randomSlice(length int) []float64 {
+func randomSlice(length int, rng *rand.Rand) []float64 {
 	slice := make([]float64, length)
 	for i := range slice {
-		slice[i] = rand.Float64()
+		slice[i] = rng.Float64()
 	}
 	return slice
 }
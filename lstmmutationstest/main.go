@@ -3,37 +3,37 @@ package main
 import (
 	"fmt"
 	"math/rand"
-	"time"
 
 	"dense" // Ensure the "dense" import path is correct for your project
 )
 
 func main() {
-    // Seed the random number generator
-    rand.Seed(time.Now().UnixNano())
+    seed := dense.NewSeed()
+    fmt.Printf("Using seed %d\n", seed)
+    rng := dense.NewRand(seed)
 
     // Create models for testing
     fmt.Println("Test 1: LSTM Only Model")
-    lstmOnlyModel := createLSTMOnlyModel()
-    testMutations(lstmOnlyModel)
+    lstmOnlyModel := createLSTMOnlyModel(rng)
+    testMutations(lstmOnlyModel, rng)
 
     fmt.Println("\nTest 2: LSTM + FFNN Model")
-    lstmFFNNModel := createLSTMFFNNModel()
-    testMutations(lstmFFNNModel)
+    lstmFFNNModel := createLSTMFFNNModel(rng)
+    testMutations(lstmFFNNModel, rng)
 
     fmt.Println("\nTest 3: LSTM + FFNN + CNN Model")
-    lstmFFNNCNNModel := createLSTMFFNNCNNModel()
-    testMutations(lstmFFNNCNNModel)
+    lstmFFNNCNNModel := createLSTMFFNNCNNModel(rng)
+    testMutations(lstmFFNNCNNModel, rng)
 }
 
 // Create an LSTM-only model
-func createLSTMOnlyModel() *dense.NetworkConfig {
+func createLSTMOnlyModel(rng *rand.Rand) *dense.NetworkConfig {
     modelID := "lstm_only_model"
     projectName := "LSTM Only Test"
     numInputs := 3
     numOutputs := 1
 
-    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName)
+    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName, rng)
 
     // Define input layer (Dense input to LSTM)
     config.Layers.Input.LayerType = "dense"
@@ -44,11 +44,11 @@ func createLSTMOnlyModel() *dense.NetworkConfig {
             LayerType: "lstm",
             LSTMCells: []dense.LSTMCell{
                 {
-                    InputWeights:  dense.RandomSlice(3),
-                    ForgetWeights: dense.RandomSlice(3),
-                    OutputWeights: dense.RandomSlice(3),
-                    CellWeights:   dense.RandomSlice(3),
-                    Bias:          rand.Float64(),
+                    InputWeights:  dense.RandomSlice(3, rng),
+                    ForgetWeights: dense.RandomSlice(3, rng),
+                    OutputWeights: dense.RandomSlice(3, rng),
+                    CellWeights:   dense.RandomSlice(3, rng),
+                    Bias:          rng.Float64(),
                 },
             },
         },
@@ -58,13 +58,13 @@ func createLSTMOnlyModel() *dense.NetworkConfig {
 }
 
 // Create a model with LSTM and FFNN layers
-func createLSTMFFNNModel() *dense.NetworkConfig {
+func createLSTMFFNNModel(rng *rand.Rand) *dense.NetworkConfig {
     modelID := "lstm_ffnn_model"
     projectName := "LSTM FFNN Test"
     numInputs := 3
     numOutputs := 1
 
-    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName)
+    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName, rng)
 
     // Define input layer (Dense input to LSTM)
     config.Layers.Input.LayerType = "dense"
@@ -75,11 +75,11 @@ func createLSTMFFNNModel() *dense.NetworkConfig {
             LayerType: "lstm",
             LSTMCells: []dense.LSTMCell{
                 {
-                    InputWeights:  dense.RandomSlice(3),
-                    ForgetWeights: dense.RandomSlice(3),
-                    OutputWeights: dense.RandomSlice(3),
-                    CellWeights:   dense.RandomSlice(3),
-                    Bias:          rand.Float64(),
+                    InputWeights:  dense.RandomSlice(3, rng),
+                    ForgetWeights: dense.RandomSlice(3, rng),
+                    OutputWeights: dense.RandomSlice(3, rng),
+                    CellWeights:   dense.RandomSlice(3, rng),
+                    Bias:          rng.Float64(),
                 },
             },
         },
@@ -88,10 +88,10 @@ func createLSTMFFNNModel() *dense.NetworkConfig {
             Neurons: map[string]dense.Neuron{
                 "hidden1": {
                     ActivationType: "relu",
-                    Bias:           rand.Float64(),
+                    Bias:           rng.Float64(),
                     Connections: func() map[string]dense.Connection {
                         connections := make(map[string]dense.Connection)
-                        connections["lstm_output"] = dense.Connection{Weight: rand.Float64()}
+                        connections["lstm_output"] = dense.Connection{Weight: rng.Float64()}
                         return connections
                     }(),
                 },
@@ -103,13 +103,13 @@ func createLSTMFFNNModel() *dense.NetworkConfig {
 }
 
 // Create a model with LSTM, FFNN, and CNN layers
-func createLSTMFFNNCNNModel() *dense.NetworkConfig {
+func createLSTMFFNNCNNModel(rng *rand.Rand) *dense.NetworkConfig {
     modelID := "lstm_ffnn_cnn_model"
     projectName := "LSTM FFNN CNN Test"
     numInputs := 3
     numOutputs := 1
 
-    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName)
+    config := dense.CreateRandomNetworkConfig(numInputs, numOutputs, []string{"sigmoid"}, modelID, projectName, rng)
 
     // Define input layer (Dense input to LSTM)
     config.Layers.Input.LayerType = "dense"
@@ -120,11 +120,11 @@ func createLSTMFFNNCNNModel() *dense.NetworkConfig {
             LayerType: "lstm",
             LSTMCells: []dense.LSTMCell{
                 {
-                    InputWeights:  dense.RandomSlice(3),
-                    ForgetWeights: dense.RandomSlice(3),
-                    OutputWeights: dense.RandomSlice(3),
-                    CellWeights:   dense.RandomSlice(3),
-                    Bias:          rand.Float64(),
+                    InputWeights:  dense.RandomSlice(3, rng),
+                    ForgetWeights: dense.RandomSlice(3, rng),
+                    OutputWeights: dense.RandomSlice(3, rng),
+                    CellWeights:   dense.RandomSlice(3, rng),
+                    Bias:          rng.Float64(),
                 },
             },
         },
@@ -133,10 +133,10 @@ func createLSTMFFNNCNNModel() *dense.NetworkConfig {
             Neurons: map[string]dense.Neuron{
                 "hidden1": {
                     ActivationType: "relu",
-                    Bias:           rand.Float64(),
+                    Bias:           rng.Float64(),
                     Connections: func() map[string]dense.Connection {
                         connections := make(map[string]dense.Connection)
-                        connections["lstm_output"] = dense.Connection{Weight: rand.Float64()}
+                        connections["lstm_output"] = dense.Connection{Weight: rng.Float64()}
                         return connections
                     }(),
                 },
@@ -147,11 +147,11 @@ func createLSTMFFNNCNNModel() *dense.NetworkConfig {
             Filters: []dense.Filter{
                 {
                     Weights: [][]float64{
-                        {rand.Float64(), rand.Float64(), rand.Float64()},
-                        {rand.Float64(), rand.Float64(), rand.Float64()},
-                        {rand.Float64(), rand.Float64(), rand.Float64()},
+                        {rng.Float64(), rng.Float64(), rng.Float64()},
+                        {rng.Float64(), rng.Float64(), rng.Float64()},
+                        {rng.Float64(), rng.Float64(), rng.Float64()},
                     },
-                    Bias: rand.Float64(),
+                    Bias: rng.Float64(),
                 },
             },
             Stride:  1,
@@ -163,25 +163,25 @@ func createLSTMFFNNCNNModel() *dense.NetworkConfig {
 }
 
 // Test all mutations for LSTM layers
-func testMutations(config *dense.NetworkConfig) {
+func testMutations(config *dense.NetworkConfig, rng *rand.Rand) {
     fmt.Println("\nApplying MutateLSTMWeights...")
-    dense.MutateLSTMWeights(config, 0.01, 50)
+    dense.MutateLSTMWeights(config, 0.01, 50, rng)
     printLSTMDetails(config)
 
     fmt.Println("\nApplying MutateLSTMBiases...")
-    dense.MutateLSTMBiases(config, 50, 0.01)
+    dense.MutateLSTMBiases(config, 50, 0.01, rng)
     printLSTMDetails(config)
 
     fmt.Println("\nApplying RandomizeLSTMWeights...")
-    dense.RandomizeLSTMWeights(config, 50)
+    dense.RandomizeLSTMWeights(config, 50, rng)
     printLSTMDetails(config)
 
     fmt.Println("\nApplying InvertLSTMWeights...")
-    dense.InvertLSTMWeights(config, 50)
+    dense.InvertLSTMWeights(config, 50, rng)
     printLSTMDetails(config)
 
     fmt.Println("\nApplying AddLSTMLayerAtRandomPosition...")
-    dense.AddLSTMLayerAtRandomPosition(config, 50)
+    dense.AddLSTMLayerAtRandomPosition(config, 50, rng)
     printLSTMDetails(config)
 }
 
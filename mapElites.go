@@ -0,0 +1,352 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// eliteIndexFile is the name of the index written next to the archived models.
+const eliteIndexFile = "index.json"
+
+// EliteDescriptor is one axis of the MAP-Elites grid: a named descriptor split into Bins cells.
+type EliteDescriptor struct {
+	Name string `json:"name"` // Key into the descriptor registry
+	Bins int    `json:"bins"`
+}
+
+// DescriptorFunc maps a model onto a cell along one axis, in [0, bins).
+type DescriptorFunc func(config *NetworkConfig, bins int) int
+
+// descriptorRegistry maps descriptor names to their implementations.
+var descriptorRegistry = map[string]DescriptorFunc{
+	"depth": func(c *NetworkConfig, bins int) int {
+		return clampBin(len(c.Layers.Hidden), bins)
+	},
+	"neurons": func(c *NetworkConfig, bins int) int {
+		neurons := 0
+		for _, layer := range c.Layers.Hidden {
+			neurons += len(layer.Neurons) + len(layer.Filters) + len(layer.LSTMCells)
+		}
+		return clampBin(int(math.Log2(1+float64(neurons))), bins)
+	},
+	"convFraction": func(c *NetworkConfig, bins int) int {
+		return fractionBin(c, "conv", bins)
+	},
+	"lstmFraction": func(c *NetworkConfig, bins int) int {
+		return fractionBin(c, "lstm", bins)
+	},
+	"params": func(c *NetworkConfig, bins int) int {
+		return clampBin(int(math.Log2(1+float64(CountParameters(c)))), bins)
+	},
+}
+
+// RegisterDescriptor adds or replaces a named MAP-Elites descriptor.
+func RegisterDescriptor(name string, fn DescriptorFunc) {
+	descriptorRegistry[name] = fn
+}
+
+// clampBin keeps a bin index inside [0, bins).
+func clampBin(bin, bins int) int {
+	if bin < 0 {
+		return 0
+	}
+	if bin >= bins {
+		return bins - 1
+	}
+	return bin
+}
+
+// fractionBin bins the fraction of hidden layers of the given type.
+func fractionBin(config *NetworkConfig, layerType string, bins int) int {
+	if len(config.Layers.Hidden) == 0 {
+		return 0
+	}
+	count := 0
+	for _, layer := range config.Layers.Hidden {
+		if layer.LayerType == layerType {
+			count++
+		}
+	}
+	return clampBin(int(float64(count)/float64(len(config.Layers.Hidden))*float64(bins)), bins)
+}
+
+// EliteCell is the best model found so far for one combination of descriptor bins.
+type EliteCell struct {
+	Key     string  `json:"key"`
+	Bins    []int   `json:"bins"`
+	ModelID string  `json:"modelID"`
+	File    string  `json:"file"` // Relative to the archive directory
+	Fitness float64 `json:"fitness"`
+}
+
+// MapElitesArchive stores the best model per cell as a directory of model files plus an index JSON.
+type MapElitesArchive struct {
+	Dir         string                `json:"-"`
+	Descriptors []EliteDescriptor     `json:"descriptors"`
+	Cells       map[string]*EliteCell `json:"cells"`
+	Insertions  int                   `json:"insertions"` // Models that took over a cell
+	mu          sync.Mutex
+}
+
+// NewMapElitesArchive creates an empty archive in dir over the given descriptors.
+func NewMapElitesArchive(dir string, descriptors []EliteDescriptor) (*MapElitesArchive, error) {
+	if err := validateDescriptors(descriptors); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &MapElitesArchive{Dir: dir, Descriptors: descriptors, Cells: make(map[string]*EliteCell)}, nil
+}
+
+// validateDescriptors checks that every descriptor is registered and has bins.
+func validateDescriptors(descriptors []EliteDescriptor) error {
+	for _, descriptor := range descriptors {
+		if _, ok := descriptorRegistry[descriptor.Name]; !ok {
+			return fmt.Errorf("unknown descriptor %q", descriptor.Name)
+		}
+		if descriptor.Bins <= 0 {
+			return fmt.Errorf("descriptor %q needs at least one bin", descriptor.Name)
+		}
+	}
+	return nil
+}
+
+// LoadMapElitesArchive reads the archive index from dir.
+func LoadMapElitesArchive(dir string) (*MapElitesArchive, error) {
+	data, err := os.ReadFile(filepath.Join(dir, eliteIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive index: %w", err)
+	}
+
+	archive := &MapElitesArchive{}
+	if err := json.Unmarshal(data, archive); err != nil {
+		return nil, fmt.Errorf("failed to decode archive index: %w", err)
+	}
+	// Custom descriptors have to be registered again before the archive is loaded
+	if err := validateDescriptors(archive.Descriptors); err != nil {
+		return nil, fmt.Errorf("invalid archive index: %w", err)
+	}
+	archive.Dir = dir
+	if archive.Cells == nil {
+		archive.Cells = make(map[string]*EliteCell)
+	}
+	return archive, nil
+}
+
+// Save writes the archive index. Models are written as they are inserted.
+func (a *MapElitesArchive) Save() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive index: %w", err)
+	}
+	return os.WriteFile(filepath.Join(a.Dir, eliteIndexFile), data, 0644)
+}
+
+// CellOf returns the cell key and bins a model falls into, e.g. "depth=2,params=9".
+func (a *MapElitesArchive) CellOf(config *NetworkConfig) (string, []int) {
+	bins := make([]int, len(a.Descriptors))
+	parts := make([]string, len(a.Descriptors))
+	for i, descriptor := range a.Descriptors {
+		bins[i] = descriptorRegistry[descriptor.Name](config, descriptor.Bins)
+		parts[i] = descriptor.Name + "=" + strconv.Itoa(bins[i])
+	}
+	return strings.Join(parts, ","), bins
+}
+
+// Insert stores the model if its cell is empty or it beats the current elite, replacing the
+// elite's model file. Parents of a kept model that are still elites list it as their child and are
+// saved again. It reports whether the model was kept.
+func (a *MapElitesArchive) Insert(config *NetworkConfig, fitness float64) (bool, error) {
+	key, bins := a.CellOf(config)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	current, ok := a.Cells[key]
+	if ok && current.Fitness >= fitness {
+		return false, nil
+	}
+
+	file := eliteFile(key)
+	if err := SaveModel(filepath.Join(a.Dir, file), config); err != nil {
+		return false, fmt.Errorf("failed to save elite for cell %s: %w", key, err)
+	}
+	if ok && current.File != file {
+		if err := os.Remove(filepath.Join(a.Dir, current.File)); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Failed to remove replaced elite %s: %v\n", current.File, err)
+		}
+	}
+
+	a.Cells[key] = &EliteCell{Key: key, Bins: bins, ModelID: config.Metadata.ModelID, File: file, Fitness: fitness}
+	a.Insertions++
+	for _, parentID := range config.Metadata.ParentModelIDs {
+		if err := a.linkParent(parentID, config); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// linkParent records a kept child on its parent's model file if the parent is still an elite. The
+// caller holds a.mu.
+func (a *MapElitesArchive) linkParent(parentID string, child *NetworkConfig) error {
+	for _, cell := range a.Cells {
+		if cell.ModelID != parentID || cell.ModelID == child.Metadata.ModelID {
+			continue
+		}
+		path := filepath.Join(a.Dir, cell.File)
+		parent, err := LoadModel(path)
+		if err != nil {
+			return fmt.Errorf("failed to load parent elite %s: %w", parentID, err)
+		}
+		LinkParentChild(parent, child)
+		if err := SaveModel(path, parent); err != nil {
+			return fmt.Errorf("failed to save parent elite %s: %w", parentID, err)
+		}
+	}
+	return nil
+}
+
+// eliteFile names the model file of a cell after its key, e.g. "depth-2_params-9.json", so every cell has
+// its own file whatever the elite's model ID.
+func eliteFile(key string) string {
+	return strings.NewReplacer("=", "-", ",", "_").Replace(key) + ".json"
+}
+
+// Elites returns the occupied cells, best first.
+func (a *MapElitesArchive) Elites() []*EliteCell {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cells := make([]*EliteCell, 0, len(a.Cells))
+	for _, cell := range a.Cells {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Fitness != cells[j].Fitness {
+			return cells[i].Fitness > cells[j].Fitness
+		}
+		return cells[i].Key < cells[j].Key
+	})
+	return cells
+}
+
+// Coverage is the fraction of grid cells that hold an elite.
+func (a *MapElitesArchive) Coverage() float64 {
+	total := 1
+	for _, descriptor := range a.Descriptors {
+		total *= descriptor.Bins
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return float64(len(a.Cells)) / float64(total)
+}
+
+// SampleParent loads the elite of a uniformly chosen occupied cell.
+func (a *MapElitesArchive) SampleParent(rng *rand.Rand) (*NetworkConfig, error) {
+	a.mu.Lock()
+	keys := sortedKeys(a.Cells)
+	if len(keys) == 0 {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("archive is empty")
+	}
+	cell := a.Cells[keys[rng.Intn(len(keys))]]
+	a.mu.Unlock()
+
+	config, err := LoadModel(filepath.Join(a.Dir, cell.File))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load elite %s: %w", cell.ModelID, err)
+	}
+	return config, nil
+}
+
+// MapElitesOptions configures RunMapElites.
+type MapElitesOptions struct {
+	Iterations   int                                 // Batches of children to evaluate
+	BatchSize    int                                 // Children per batch, evaluated concurrently
+	Evaluate     func(config *NetworkConfig) float64 // Fitness, higher is better
+	Policy       *MutationPolicy                     // Defaults to DefaultMutationPolicy
+	LearningRate float64
+	MutationRate int
+	Mutations    int   // Operators applied per child, at least 1
+	Seed         int64 // Drives parent sampling; children get seeds derived from their parents
+}
+
+// RunMapElites inserts the initial models, then repeatedly samples parents from the archive,
+// mutates copies of them and inserts the children back. The index is saved after every batch.
+func RunMapElites(archive *MapElitesArchive, initial []*NetworkConfig, opts MapElitesOptions) error {
+	if opts.Evaluate == nil {
+		return fmt.Errorf("MAP-Elites needs an evaluation function")
+	}
+	if opts.Policy == nil {
+		opts.Policy = DefaultMutationPolicy()
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.Mutations <= 0 {
+		opts.Mutations = 1
+	}
+
+	for _, config := range initial {
+		if _, err := archive.Insert(config, opts.Evaluate(config)); err != nil {
+			return err
+		}
+	}
+	if err := archive.Save(); err != nil {
+		return err
+	}
+
+	rng := NewRand(opts.Seed)
+	for iteration := 0; iteration < opts.Iterations; iteration++ {
+		children := make([]*NetworkConfig, opts.BatchSize)
+		childRngs := make([]*rand.Rand, opts.BatchSize)
+		for i := range children {
+			parent, err := archive.SampleParent(rng)
+			if err != nil {
+				return err
+			}
+			children[i], childRngs[i] = SpawnChild(parent, iteration*opts.BatchSize+i, "")
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(children))
+		for i := range children {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				child := children[i]
+				for m := 0; m < opts.Mutations; m++ {
+					MutateNetworkWithPolicy(child, opts.Policy, opts.LearningRate, opts.MutationRate, childRngs[i])
+				}
+				fitness := opts.Evaluate(child)
+				_, errs[i] = archive.Insert(child, fitness)
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		if err := archive.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("MAP-Elites iteration %d: %d cells filled (%.1f%% coverage), %d insertions\n",
+			iteration, len(archive.Cells), archive.Coverage()*100, archive.Insertions)
+	}
+	return nil
+}
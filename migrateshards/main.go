@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"dense"
+)
+
+// layerShardFolder matches the per-input CSV shard folders, layer_<n>_shards.
+var layerShardFolder = regexp.MustCompile(`^layer_(\d+)_shards$`)
+
+func main() {
+	// Setup command-line flags
+	dir := flag.String("dir", "./host/generations", "Folder searched recursively for layer_<n>_shards folders")
+	precision := flag.Int("precision", 64, "Bits per stored value, 32 or 64")
+	remove := flag.Bool("remove", false, "Delete each CSV shard folder once all of its shards are migrated")
+	flag.Parse()
+
+	shardPrecision := dense.ShardFloat64
+	switch *precision {
+	case 64:
+	case 32:
+		shardPrecision = dense.ShardFloat32
+	default:
+		fmt.Println("Precision must be 32 or 64")
+		os.Exit(1)
+	}
+
+	var folders []string
+	err := filepath.WalkDir(*dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && layerShardFolder.MatchString(d.Name()) {
+			folders = append(folders, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error searching for shard folders:", err)
+		os.Exit(1)
+	}
+
+	total := 0
+	for _, folder := range folders {
+		layer := layerShardFolder.FindStringSubmatch(filepath.Base(folder))[1]
+		storePath := filepath.Join(filepath.Dir(folder), fmt.Sprintf("layer_%s.shard", layer))
+
+		// The model tells whether tensor shards are single images, which is all CSV shards can hold
+		modelPath := filepath.Dir(folder) + ".json"
+		config, err := dense.LoadModel(modelPath)
+		if err != nil {
+			fmt.Printf("No model %s for %s, tensor shards will be skipped: %v\n", modelPath, folder, err)
+			config = nil
+		}
+		layerIndex, _ := strconv.Atoi(layer)
+
+		migrated, err := dense.MigrateCSVShards(folder, storePath, shardPrecision, config, layerIndex)
+		if err != nil {
+			fmt.Printf("Error migrating %s: %v\n", folder, err)
+			continue
+		}
+		fmt.Printf("Migrated %d shards from %s to %s\n", migrated, folder, storePath)
+		total += migrated
+
+		csvShards, _ := filepath.Glob(filepath.Join(folder, "input_*.csv"))
+		if *remove && migrated < len(csvShards) {
+			fmt.Printf("Keeping %s, %d shards could not be migrated\n", folder, len(csvShards)-migrated)
+		} else if *remove {
+			if err := os.RemoveAll(folder); err != nil {
+				fmt.Printf("Error removing %s: %v\n", folder, err)
+			}
+		}
+	}
+	fmt.Printf("Migrated %d shards from %d folders\n", total, len(folders))
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package dense
+
+import "os"
+
+// mapFile reads the first size bytes of the file on platforms without mmap. The values are still shared
+// between readers, they just aren't backed by the page cache.
+func mapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, 0); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package dense
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of the file read-only and returns the function that unmaps them.
+func mapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,129 @@
+package dense
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ModelDiff describes how far a child shares its computation with its parent.
+type ModelDiff struct {
+	InputChanged bool // The input layer differs, so no parent state can be reused
+	FirstChanged int  // First hidden layer that differs; the child's hidden layer count if only the output changed
+	ResumeLayer  int  // Deepest hidden layer whose parent state the child can reuse, -1 for none
+}
+
+// DiffModels compares a child with its parent layer by layer using the prefix hashes, so a layer counts
+// as changed when it or anything before it differs.
+func DiffModels(parent, child *NetworkConfig) (ModelDiff, error) {
+	diff := ModelDiff{InputChanged: inputLayerChanged(parent.Layers.Input, child.Layers.Input)}
+	if diff.InputChanged {
+		diff.ResumeLayer = -1
+		return diff, nil
+	}
+
+	parentHashes, err := LayerPrefixHashes(parent)
+	if err != nil {
+		return diff, fmt.Errorf("failed to hash parent layers: %w", err)
+	}
+	childHashes, err := LayerPrefixHashes(child)
+	if err != nil {
+		return diff, fmt.Errorf("failed to hash child layers: %w", err)
+	}
+
+	diff.FirstChanged = len(childHashes)
+	for i := range childHashes {
+		if i >= len(parentHashes) || childHashes[i] != parentHashes[i] {
+			diff.FirstChanged = i
+			break
+		}
+	}
+	diff.ResumeLayer = diff.FirstChanged - 1
+	return diff, nil
+}
+
+// inputLayerChanged reports whether two input layers take different inputs.
+func inputLayerChanged(a, b Layer) bool {
+	if a.LayerType != b.LayerType || len(a.Neurons) != len(b.Neurons) {
+		return true
+	}
+	for id := range a.Neurons {
+		if _, ok := b.Neurons[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ChildEvaluator runs a mutated child on single inputs, reusing the parent's saved state at the deepest
+// hidden layer both models still share. The diff and the parent's hashes are computed once, so it is
+// cheap to call for every input of a test set.
+type ChildEvaluator struct {
+	Child          *NetworkConfig
+	Diff           ModelDiff
+	parentFilePath string
+	parentHashes   []string
+	parentLast     int
+	cache          *ActivationCache
+}
+
+// NewChildEvaluator prepares the evaluation of child from the states saved for the parent stored at
+// parentFilePath: the generation's activation cache and the parent's per-model shards.
+func NewChildEvaluator(parent, child *NetworkConfig, parentFilePath string) (*ChildEvaluator, error) {
+	diff, err := DiffModels(parent, child)
+	if err != nil {
+		return nil, err
+	}
+	parentHashes, err := LayerPrefixHashes(parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash parent layers: %w", err)
+	}
+	return &ChildEvaluator{
+		Child:          child,
+		Diff:           diff,
+		parentFilePath: parentFilePath,
+		parentHashes:   parentHashes,
+		parentLast:     GetLastHiddenLayerIndex(parent),
+		cache:          NewActivationCache(filepath.Dir(parentFilePath)),
+	}, nil
+}
+
+// Evaluate returns the child's output for one input and the layer it resumed from. When the input layer
+// changed or no shared state is saved it runs a full Feedforward on loadInputs() and returns -1;
+// loadInputs may be nil, in which case that is an error.
+func (e *ChildEvaluator) Evaluate(inputID string, loadInputs func() map[string]interface{}) (map[string]float64, int, error) {
+	if !e.Diff.InputChanged && e.Diff.ResumeLayer >= 0 {
+		if state, layer := e.parentState(inputID); state != nil {
+			output := ContinueFeedforward(e.Child, state, layer)
+			if VerifyLayerStates && loadInputs != nil {
+				if _, err := VerifyResumedOutput(e.Child, loadInputs(), output, layer, VerifyTolerance); err != nil {
+					return nil, layer, fmt.Errorf("parent state of input %s: %w", inputID, err)
+				}
+			}
+			return output, layer, nil
+		}
+	}
+
+	if loadInputs == nil {
+		return nil, -1, fmt.Errorf("no reusable parent state for input %s", inputID)
+	}
+	return Feedforward(e.Child, loadInputs()), -1, nil
+}
+
+// parentState loads the parent's deepest saved state at or before the resume layer, or returns nil.
+func (e *ChildEvaluator) parentState(inputID string) (interface{}, int) {
+	cached := e.cache.DeepestCachedLayer(e.parentHashes, inputID, e.Diff.ResumeLayer)
+
+	// The parent's last hidden layer may also be saved in its own shard
+	if layer := e.parentLast; layer > cached && layer <= e.Diff.ResumeLayer {
+		if state, err := LoadShardedLayerState(e.parentFilePath, layer, inputID); err == nil {
+			return state, layer
+		}
+	}
+
+	if cached >= 0 {
+		if state, err := e.cache.Load(e.parentHashes[cached], inputID); err == nil {
+			return state, cached
+		}
+	}
+	return nil, -1
+}
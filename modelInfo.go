@@ -1,5 +1,17 @@
 package dense
 
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// bytesPerValue is the size of a weight or activation; everything is stored as float64.
+const bytesPerValue = 8
+
 // CountLayers returns the total number of layers in the model, including input, hidden, and output layers.
 func CountLayers(config *NetworkConfig) int {
     // Input layer is considered as 1 layer
@@ -13,3 +25,269 @@ func CountLayers(config *NetworkConfig) int {
 
     return layerCount
 }
+
+// InputShape describes the data fed into a model: Values for dense inputs, Rows x Cols for an image
+// (conv input) or a sequence of Rows time steps with Cols features (lstm input).
+type InputShape struct {
+	Values int `json:"values,omitempty"`
+	Rows   int `json:"rows,omitempty"`
+	Cols   int `json:"cols,omitempty"`
+}
+
+// InputShapeOf derives the input shape from a sample input as passed to Feedforward.
+func InputShapeOf(inputValues map[string]interface{}) InputShape {
+	for _, key := range []string{"image", "sequence"} {
+		if grid, ok := inputValues[key].([][]float64); ok && len(grid) > 0 {
+			return InputShape{Rows: len(grid), Cols: len(grid[0])}
+		}
+	}
+	return InputShape{Values: len(inputValues)}
+}
+
+// LayerSummary breaks down the size and cost of a single layer.
+type LayerSummary struct {
+	Name          string `json:"name"`
+	LayerType     string `json:"layerType"`
+	Units         int    `json:"units"` // Neurons, filters or LSTM cells
+	Connections   int    `json:"connections"`
+	Biases        int    `json:"biases"`
+	FilterWeights int    `json:"filterWeights"`
+	LSTMWeights   int    `json:"lstmWeights"`
+	Params        int    `json:"params"`
+	MACs          int64  `json:"macs"`         // Estimated multiply-accumulates per sample
+	OutputValues  int    `json:"outputValues"` // Number of values the layer emits (0 if unknown)
+	Bytes         int64  `json:"bytes"`        // Parameter memory
+}
+
+// ModelSummary reports parameter counts, compute cost, activation types and memory for a model.
+type ModelSummary struct {
+	ModelID             string         `json:"modelID"`
+	InputShape          InputShape     `json:"inputShape"`
+	Layers              []LayerSummary `json:"layers"`
+	TotalParams         int            `json:"totalParams"`
+	TotalMACs           int64          `json:"totalMACs"`
+	Activations         map[string]int `json:"activations"` // Neuron activation type histogram
+	ParameterBytes      int64          `json:"parameterBytes"`
+	PeakActivationBytes int64          `json:"peakActivationBytes"` // Largest layer output
+}
+
+// CountParameters returns the number of trainable parameters (weights and biases) in the hidden and output layers.
+func CountParameters(config *NetworkConfig) int {
+	total := 0
+	for _, layer := range config.Layers.Hidden {
+		total += summarizeLayerParameters(layer).Params
+	}
+	total += summarizeLayerParameters(config.Layers.Output).Params
+	return total
+}
+
+// SummarizeModel builds the summary for a model fed inputs of the given shape. MACs follow what Feedforward
+// actually computes: untyped layers pass data through, and a layer that can't take its input costs nothing.
+func SummarizeModel(config *NetworkConfig, shape InputShape) *ModelSummary {
+	summary := &ModelSummary{
+		ModelID:     config.Metadata.ModelID,
+		InputShape:  shape,
+		Activations: make(map[string]int),
+	}
+
+	current := shape
+	if config.Layers.Input.LayerType == "dense" {
+		current = InputShape{Values: shape.Values}
+	}
+
+	layers := make([]Layer, 0, len(config.Layers.Hidden)+1)
+	layers = append(layers, config.Layers.Hidden...)
+	layers = append(layers, config.Layers.Output)
+
+	for i, layer := range layers {
+		layerSummary := summarizeLayerParameters(layer)
+		if i < len(config.Layers.Hidden) {
+			layerSummary.Name = fmt.Sprintf("hidden %d", i)
+		} else {
+			layerSummary.Name = "output"
+		}
+
+		layerSummary.MACs, current = layerCost(layer, current)
+		layerSummary.OutputValues = current.Values
+		if current.Values == 0 {
+			layerSummary.OutputValues = current.Rows * current.Cols
+		}
+
+		for _, neuron := range layer.Neurons {
+			activation := neuron.ActivationType
+			if activation == "" {
+				activation = "linear"
+			}
+			summary.Activations[activation]++
+		}
+
+		summary.TotalParams += layerSummary.Params
+		summary.TotalMACs += layerSummary.MACs
+		summary.ParameterBytes += layerSummary.Bytes
+		if activationBytes := int64(layerSummary.OutputValues) * bytesPerValue; activationBytes > summary.PeakActivationBytes {
+			summary.PeakActivationBytes = activationBytes
+		}
+		summary.Layers = append(summary.Layers, layerSummary)
+	}
+
+	return summary
+}
+
+// summarizeLayerParameters counts the parameters of a layer by kind.
+func summarizeLayerParameters(layer Layer) LayerSummary {
+	summary := LayerSummary{LayerType: layer.LayerType}
+	if summary.LayerType == "" {
+		summary.LayerType = "untyped"
+	}
+
+	for _, neuron := range layer.Neurons {
+		summary.Units++
+		summary.Connections += len(neuron.Connections)
+		summary.Biases++
+	}
+	for _, filter := range layer.Filters {
+		summary.Units++
+		for _, row := range filter.Weights {
+			summary.FilterWeights += len(row)
+		}
+		summary.Biases++
+	}
+	for _, cell := range layer.LSTMCells {
+		summary.Units++
+		summary.LSTMWeights += len(cell.InputWeights) + len(cell.ForgetWeights) + len(cell.OutputWeights) + len(cell.CellWeights)
+		summary.Biases++
+	}
+
+	summary.Params = summary.Connections + summary.FilterWeights + summary.LSTMWeights + summary.Biases
+	summary.Bytes = int64(summary.Params) * bytesPerValue
+	return summary
+}
+
+// layerCost estimates the multiply-accumulates of a layer and the shape of its output.
+func layerCost(layer Layer, in InputShape) (int64, InputShape) {
+	switch layer.LayerType {
+	case "dense":
+		var macs int64
+		for _, neuron := range layer.Neurons {
+			macs += int64(len(neuron.Connections))
+		}
+		return macs, InputShape{Values: len(layer.Neurons)}
+
+	case "conv":
+		// Conv layers only take an image; anything else makes Feedforward return nil
+		if in.Values != 0 || in.Rows == 0 || in.Cols == 0 || layer.Stride <= 0 {
+			return 0, InputShape{}
+		}
+		var macs int64
+		outputs := 0
+		for _, filter := range layer.Filters {
+			if len(filter.Weights) == 0 || len(filter.Weights[0]) == 0 {
+				continue
+			}
+			kernelRows, kernelCols := len(filter.Weights), len(filter.Weights[0])
+			outRows := (in.Rows+2*layer.Padding-kernelRows)/layer.Stride + 1
+			outCols := (in.Cols+2*layer.Padding-kernelCols)/layer.Stride + 1
+			if outRows <= 0 || outCols <= 0 {
+				continue
+			}
+			macs += int64(outRows * outCols * kernelRows * kernelCols)
+			outputs += outRows * outCols
+		}
+		return macs, InputShape{Values: outputs}
+
+	case "lstm":
+		steps, features := in.Rows, in.Cols
+		if in.Values != 0 {
+			steps, features = 1, in.Values
+		}
+		var macs int64
+		for _, cell := range layer.LSTMCells {
+			// dotProduct skips gates whose weights don't match the input width
+			for _, weights := range [][]float64{cell.InputWeights, cell.ForgetWeights, cell.OutputWeights, cell.CellWeights} {
+				if len(weights) == features {
+					macs += int64(features)
+				}
+			}
+		}
+		return macs * int64(steps), InputShape{Values: len(layer.LSTMCells)}
+
+	default:
+		// Untyped layers are passed through
+		return 0, in
+	}
+}
+
+// Print writes the summary as a table.
+func (s *ModelSummary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Model %s\n", s.ModelID)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Layer\tType\tUnits\tConnections\tBiases\tFilter W\tLSTM W\tParams\tMACs\tOutputs\tBytes\t")
+	for _, layer := range s.Layers {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			layer.Name, layer.LayerType, layer.Units, layer.Connections, layer.Biases, layer.FilterWeights,
+			layer.LSTMWeights, layer.Params, layer.MACs, layer.OutputValues, layer.Bytes)
+	}
+	fmt.Fprintf(tw, "Total\t\t\t\t\t\t\t%d\t%d\t\t%d\t\n", s.TotalParams, s.TotalMACs, s.ParameterBytes)
+	tw.Flush()
+
+	activations := make([]string, 0, len(s.Activations))
+	for activation := range s.Activations {
+		activations = append(activations, activation)
+	}
+	sort.Strings(activations)
+	fmt.Fprint(w, "Activations:")
+	for _, activation := range activations {
+		fmt.Fprintf(w, " %s=%d", activation, s.Activations[activation])
+	}
+	fmt.Fprintf(w, "\nParameter memory: %s, peak activation memory: %s\n", formatBytes(s.ParameterBytes), formatBytes(s.PeakActivationBytes))
+}
+
+// SummarizeGeneration summarizes every model in a generation folder, largest first.
+func SummarizeGeneration(generationDir string, shape InputShape) ([]*ModelSummary, error) {
+	files, err := os.ReadDir(generationDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation directory: %w", err)
+	}
+
+	var summaries []*ModelSummary
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		config, err := LoadModel(filepath.Join(generationDir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", file.Name(), err)
+		}
+		summaries = append(summaries, SummarizeModel(config, shape))
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].TotalParams > summaries[j].TotalParams
+	})
+	return summaries, nil
+}
+
+// PrintSummaryComparison writes one row per model so generations can be compared at a glance.
+func PrintSummaryComparison(w io.Writer, summaries []*ModelSummary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Model\tLayers\tParams\tMACs\tParam memory\tPeak activations\t")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t\n", s.ModelID, len(s.Layers), s.TotalParams, s.TotalMACs,
+			formatBytes(s.ParameterBytes), formatBytes(s.PeakActivationBytes))
+	}
+	tw.Flush()
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
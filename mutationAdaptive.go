@@ -0,0 +1,214 @@
+package dense
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// OperatorStats tracks how a mutation operator has performed and how it is currently tuned.
+type OperatorStats struct {
+	Attempts        int     `json:"attempts"`
+	Successes       int     `json:"successes"`
+	Quality         float64 `json:"quality"`     // Running average of the success reward
+	Probability     float64 `json:"probability"` // Current selection probability
+	StepSize        float64 `json:"step_size"`   // Multiplier applied to the learning rate; structural operators ignore it
+	WindowAttempts  int     `json:"window_attempts"`
+	WindowSuccesses int     `json:"window_successes"`
+}
+
+// AdaptiveMutationController picks operators from a policy and adapts their probabilities
+// (probability matching) and step sizes (Rechenberg's 1/5th success rule) from observed results.
+// The step size scales the learning rate, so it only tunes operators that use one, such as MutateWeights
+// and MutateBiases; structural operators only have their probability adapted. Operators with a weight
+// of zero are never selected, as with MutationPolicy.Select.
+type AdaptiveMutationController struct {
+	Policy         *MutationPolicy
+	Stats          map[string]*OperatorStats
+	Window         int     // Attempts of an operator between step size adjustments
+	StepFactor     float64 // Step size is divided by this on success ratio > 1/5, multiplied below it
+	MinStepSize    float64
+	MaxStepSize    float64
+	MinProbability float64 // Floor so no operator is starved completely
+	Adaptation     float64 // How quickly the quality estimate follows new results
+
+	mu sync.Mutex
+}
+
+// NewAdaptiveMutationController creates a controller whose initial probabilities follow the policy weights.
+func NewAdaptiveMutationController(policy *MutationPolicy) *AdaptiveMutationController {
+	c := &AdaptiveMutationController{
+		Policy:         policy,
+		Stats:          make(map[string]*OperatorStats),
+		Window:         10,
+		StepFactor:     0.82,
+		MinStepSize:    0.01,
+		MaxStepSize:    10,
+		MinProbability: 0.01,
+		Adaptation:     0.1,
+	}
+
+	totalWeight := 0.0
+	for _, op := range policy.Operators {
+		totalWeight += op.Weight
+	}
+	for _, op := range policy.Operators {
+		probability := 0.0
+		if totalWeight > 0 {
+			probability = op.Weight / totalWeight
+		}
+		c.Stats[op.Name] = &OperatorStats{
+			Quality:     probability,
+			Probability: probability,
+			StepSize:    1,
+		}
+	}
+
+	return c
+}
+
+// LoadStats restores previously persisted statistics, e.g. from ProjectHistory.MutationStats.
+// Operators that are no longer part of the policy are ignored.
+func (c *AdaptiveMutationController) LoadStats(stats map[string]*OperatorStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, saved := range stats {
+		if _, ok := c.Stats[name]; ok && saved != nil {
+			restored := *saved
+			c.Stats[name] = &restored
+		}
+	}
+}
+
+// Snapshot returns a copy of the statistics that is safe to serialize.
+func (c *AdaptiveMutationController) Snapshot() map[string]*OperatorStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]*OperatorStats, len(c.Stats))
+	for name, stats := range c.Stats {
+		copied := *stats
+		snapshot[name] = &copied
+	}
+	return snapshot
+}
+
+// selectOperator picks an applicable operator according to the adapted probabilities.
+func (c *AdaptiveMutationController) selectOperator(config *NetworkConfig, rng *rand.Rand) (MutationOperator, float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := 0.0
+	for _, op := range c.Policy.Operators {
+		if op.Weight > 0 && op.Applicable(config) {
+			total += c.Stats[op.Name].Probability
+		}
+	}
+	if total == 0 {
+		return MutationOperator{}, 0, false
+	}
+
+	pick := rng.Float64() * total
+	var last MutationOperator
+	for _, op := range c.Policy.Operators {
+		if op.Weight <= 0 || !op.Applicable(config) {
+			continue
+		}
+		last = op
+		pick -= c.Stats[op.Name].Probability
+		if pick < 0 {
+			return op, c.Stats[op.Name].StepSize, true
+		}
+	}
+	return last, c.Stats[last.Name].StepSize, true
+}
+
+// Mutate applies one adaptively selected operator, scaling the learning rate by the operator's step size.
+// It returns the operator name so the caller can report the outcome with Record.
+func (c *AdaptiveMutationController) Mutate(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) string {
+	op, stepSize, ok := c.selectOperator(config, rng)
+	if !ok {
+		return ""
+	}
+
+	rate := mutationRate
+	if op.Rate > 0 {
+		rate = op.Rate
+	}
+	if _, err := ApplyMutation(config, op.Name, learningRate*stepSize, rate, rng); err != nil {
+		return ""
+	}
+
+	config.Metadata.MutationPolicy = c.Policy
+	return op.Name
+}
+
+// Record reports whether a child produced by the operator beat its parent and updates the controller.
+func (c *AdaptiveMutationController) Record(operator string, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.Stats[operator]
+	if !ok {
+		return
+	}
+
+	reward := 0.0
+	if success {
+		reward = 1.0
+		stats.Successes++
+		stats.WindowSuccesses++
+	}
+	stats.Attempts++
+	stats.WindowAttempts++
+
+	// Probability matching: quality follows the reward, probabilities follow quality
+	stats.Quality += c.Adaptation * (reward - stats.Quality)
+	c.updateProbabilities()
+
+	// 1/5th success rule on the step size once the window is full
+	if stats.WindowAttempts >= c.Window {
+		successRatio := float64(stats.WindowSuccesses) / float64(stats.WindowAttempts)
+		if successRatio > 0.2 {
+			stats.StepSize /= c.StepFactor
+		} else if successRatio < 0.2 {
+			stats.StepSize *= c.StepFactor
+		}
+		if stats.StepSize < c.MinStepSize {
+			stats.StepSize = c.MinStepSize
+		} else if stats.StepSize > c.MaxStepSize {
+			stats.StepSize = c.MaxStepSize
+		}
+		stats.WindowAttempts = 0
+		stats.WindowSuccesses = 0
+	}
+}
+
+// updateProbabilities recomputes selection probabilities from the quality estimates. Operators with a
+// weight of zero keep a probability of zero. Caller holds the lock.
+func (c *AdaptiveMutationController) updateProbabilities() {
+	enabled := make(map[string]*OperatorStats, len(c.Stats))
+	for _, op := range c.Policy.Operators {
+		if stats, ok := c.Stats[op.Name]; ok {
+			if op.Weight > 0 {
+				enabled[op.Name] = stats
+			} else {
+				stats.Probability = 0
+			}
+		}
+	}
+
+	totalQuality := 0.0
+	for _, stats := range enabled {
+		totalQuality += stats.Quality
+	}
+
+	numOperators := float64(len(enabled))
+	for _, stats := range enabled {
+		if totalQuality == 0 || numOperators*c.MinProbability >= 1 {
+			stats.Probability = 1 / numOperators
+			continue
+		}
+		stats.Probability = c.MinProbability + (1-numOperators*c.MinProbability)*stats.Quality/totalQuality
+	}
+}
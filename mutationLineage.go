@@ -0,0 +1,309 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+// maxRecordedNeuronIDs caps how many changed neuron IDs a single record keeps, so weight-wide
+// mutations don't blow up the lineage. NeuronsChanged still holds the full count.
+const maxRecordedNeuronIDs = 32
+
+// MaxLineageLength caps the records kept in a model's lineage. Older records are dropped and counted in
+// Metadata.LineageDropped, so a long-lived model's metadata stays small; mutations before the kept records
+// can no longer be replayed.
+var MaxLineageLength = 256
+
+// MutationSummary is a coarse snapshot of a network taken before and after a mutation.
+type MutationSummary struct {
+	HiddenLayers int     `json:"hiddenLayers"`
+	Neurons      int     `json:"neurons"`
+	Connections  int     `json:"connections"`
+	Filters      int     `json:"filters,omitempty"`
+	LSTMCells    int     `json:"lstmCells,omitempty"`
+	MeanWeight   float64 `json:"meanWeight"`
+	MeanBias     float64 `json:"meanBias"`
+}
+
+// MutationRecord describes one mutation applied to a model. Operator, Seed, LearningRate, Rate,
+// Args and Activations are everything needed to replay it; the rest describes what changed.
+type MutationRecord struct {
+	Operator       string          `json:"operator"`
+	Seed           int64           `json:"seed"` // Seed of the random source the operator ran with
+	LearningRate   float64         `json:"learningRate,omitempty"`
+	Rate           int             `json:"rate,omitempty"`
+	Args           []int           `json:"args,omitempty"`        // Extra arguments for operators that take them
+	Activations    []string        `json:"activations,omitempty"` // Output activations for output layer operators
+	Layers         []int           `json:"layers,omitempty"`      // Hidden layer indices that changed
+	OutputChanged  bool            `json:"outputChanged,omitempty"`
+	NeuronIDs      []string        `json:"neuronIDs,omitempty"` // Neurons added, removed or modified
+	NeuronsChanged int             `json:"neuronsChanged,omitempty"`
+	Before         MutationSummary `json:"before"`
+	After          MutationSummary `json:"after"`
+}
+
+// StepFunc applies a mutation step that needs more than a learning rate and a mutation rate.
+type StepFunc func(config *NetworkConfig, step MutationRecord, rng *rand.Rand) error
+
+// stepRegistry holds operators that read their arguments from the record. Everything in
+// mutationRegistry can be applied as a step as well.
+var stepRegistry = map[string]StepFunc{
+	"AppendNewLayerFullConnections": func(c *NetworkConfig, step MutationRecord, rng *rand.Rand) error {
+		if len(step.Args) < 1 {
+			return fmt.Errorf("AppendNewLayerFullConnections needs the number of neurons as its argument")
+		}
+		AppendNewLayerFullConnections(c, step.Args[0], rng)
+		return nil
+	},
+	"AppendMultipleLayers": func(c *NetworkConfig, step MutationRecord, rng *rand.Rand) error {
+		if len(step.Args) < 2 {
+			return fmt.Errorf("AppendMultipleLayers needs the number of layers and neurons as its arguments")
+		}
+		AppendMultipleLayers(c, step.Args[0], step.Args[1], rng)
+		return nil
+	},
+	"ReattachOutputLayer": func(c *NetworkConfig, step MutationRecord, rng *rand.Rand) error {
+		if len(step.Args) < 1 {
+			return fmt.Errorf("ReattachOutputLayer needs the number of outputs as its argument")
+		}
+		ReattachOutputLayer(c, step.Args[0], step.Activations, rng)
+		return nil
+	},
+}
+
+// RegisterStep adds or replaces an argument-taking operator so it can be recorded and replayed.
+func RegisterStep(name string, fn StepFunc) {
+	stepRegistry[name] = fn
+}
+
+// ApplyMutation runs a registered operator with its own seed drawn from rng and appends the
+// resulting record to the model's lineage.
+func ApplyMutation(config *NetworkConfig, operator string, learningRate float64, mutationRate int, rng *rand.Rand) (MutationRecord, error) {
+	return ApplyMutationStep(config, MutationRecord{
+		Operator:     operator,
+		Seed:         rng.Int63(),
+		LearningRate: learningRate,
+		Rate:         mutationRate,
+	})
+}
+
+// ApplyMutationStep runs the operator described by step with a random source seeded from step.Seed,
+// fills in what changed and appends the record to config.Metadata.Lineage.
+func ApplyMutationStep(config *NetworkConfig, step MutationRecord) (MutationRecord, error) {
+	// Only the layers are compared afterwards; operators don't change the input layer or the metadata
+	before := layerSnapshot{hidden: make([]Layer, len(config.Layers.Hidden)), output: deepCopyLayer(config.Layers.Output), summary: summarizeNetwork(config)}
+	for i, layer := range config.Layers.Hidden {
+		before.hidden[i] = deepCopyLayer(layer)
+	}
+	rng := NewRand(step.Seed)
+
+	if fn, ok := mutationRegistry[step.Operator]; ok {
+		fn(config, step.LearningRate, step.Rate, rng)
+	} else if fn, ok := stepRegistry[step.Operator]; ok {
+		if err := fn(config, step, rng); err != nil {
+			return step, fmt.Errorf("failed to apply %s: %w", step.Operator, err)
+		}
+	} else {
+		return step, fmt.Errorf("unknown mutation operator %q", step.Operator)
+	}
+
+	record := diffMutation(before, config, step)
+	appendLineage(config, record)
+	return record, nil
+}
+
+// appendLineage adds a record to the lineage, dropping the oldest ones beyond MaxLineageLength.
+func appendLineage(config *NetworkConfig, record MutationRecord) {
+	lineage := append(config.Metadata.Lineage, record)
+	if excess := len(lineage) - MaxLineageLength; MaxLineageLength > 0 && excess > 0 {
+		lineage = append([]MutationRecord(nil), lineage[excess:]...)
+		config.Metadata.LineageDropped += excess
+	}
+	config.Metadata.Lineage = lineage
+}
+
+// layerSnapshot is what diffMutation needs of the network before a step.
+type layerSnapshot struct {
+	hidden  []Layer
+	output  Layer
+	summary MutationSummary
+}
+
+// ReplayLineage applies the given records to a copy of the parent, reproducing the child they were recorded on.
+func ReplayLineage(parent *NetworkConfig, records []MutationRecord) (*NetworkConfig, error) {
+	child := DeepCopy(parent)
+	for i, record := range records {
+		if _, err := ApplyMutationStep(child, record); err != nil {
+			return nil, fmt.Errorf("failed to replay mutation %d: %w", i, err)
+		}
+	}
+	return child, nil
+}
+
+// ChildLineage returns the records the child gained on top of the parent's lineage. Records are matched
+// by their position in the full lineage, so it works when either model dropped old records, as long as
+// the child still holds every record after the parent's last one.
+func ChildLineage(parent, child *NetworkConfig) ([]MutationRecord, error) {
+	parentLineage, parentDropped := parent.Metadata.Lineage, parent.Metadata.LineageDropped
+	childLineage, childDropped := child.Metadata.Lineage, child.Metadata.LineageDropped
+	parentEnd := parentDropped + len(parentLineage)
+	if childDropped+len(childLineage) < parentEnd {
+		return nil, fmt.Errorf("child %s has a shorter lineage than parent %s", child.Metadata.ModelID, parent.Metadata.ModelID)
+	}
+	if childDropped > parentEnd {
+		return nil, fmt.Errorf("child %s dropped mutations it gained after parent %s", child.Metadata.ModelID, parent.Metadata.ModelID)
+	}
+	start := parentDropped
+	if childDropped > start {
+		start = childDropped
+	}
+	for i := start; i < parentEnd; i++ {
+		p, c := parentLineage[i-parentDropped], childLineage[i-childDropped]
+		if p.Operator != c.Operator || p.Seed != c.Seed {
+			return nil, fmt.Errorf("lineage of %s diverges from %s at mutation %d", child.Metadata.ModelID, parent.Metadata.ModelID, i)
+		}
+	}
+	return childLineage[parentEnd-childDropped:], nil
+}
+
+// ReconstructChild rebuilds a child from its parent by replaying the mutations recorded after the parent's lineage.
+func ReconstructChild(parent, child *NetworkConfig) (*NetworkConfig, error) {
+	records, err := ChildLineage(parent, child)
+	if err != nil {
+		return nil, err
+	}
+	return ReplayLineage(parent, records)
+}
+
+// diffMutation fills the descriptive part of a record by comparing the network before and after the step.
+func diffMutation(before layerSnapshot, after *NetworkConfig, step MutationRecord) MutationRecord {
+	record := step
+	record.Layers = nil
+	record.NeuronIDs = nil
+	record.NeuronsChanged = 0
+	record.Before = before.summary
+	record.After = summarizeNetwork(after)
+
+	changed := make(map[string]bool)
+	numLayers := len(before.hidden)
+	if len(after.Layers.Hidden) > numLayers {
+		numLayers = len(after.Layers.Hidden)
+	}
+	for i := 0; i < numLayers; i++ {
+		var oldLayer, newLayer Layer
+		if i < len(before.hidden) {
+			oldLayer = before.hidden[i]
+		}
+		if i < len(after.Layers.Hidden) {
+			newLayer = after.Layers.Hidden[i]
+		}
+		if diffLayer(oldLayer, newLayer, changed) {
+			record.Layers = append(record.Layers, i)
+		}
+	}
+	record.OutputChanged = diffLayer(before.output, after.Layers.Output, changed)
+
+	record.NeuronsChanged = len(changed)
+	ids := make([]string, 0, len(changed))
+	for id := range changed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) > maxRecordedNeuronIDs {
+		ids = ids[:maxRecordedNeuronIDs]
+	}
+	record.NeuronIDs = ids
+	return record
+}
+
+// diffLayer reports whether two layers differ and collects the IDs of neurons that were added, removed or changed.
+func diffLayer(oldLayer, newLayer Layer, changed map[string]bool) bool {
+	different := oldLayer.LayerType != newLayer.LayerType ||
+		oldLayer.Stride != newLayer.Stride || oldLayer.Padding != newLayer.Padding ||
+		!reflect.DeepEqual(oldLayer.Filters, newLayer.Filters) ||
+		!reflect.DeepEqual(oldLayer.LSTMCells, newLayer.LSTMCells)
+
+	for id, neuron := range newLayer.Neurons {
+		if oldNeuron, ok := oldLayer.Neurons[id]; !ok || !reflect.DeepEqual(oldNeuron, neuron) {
+			changed[id] = true
+			different = true
+		}
+	}
+	for id := range oldLayer.Neurons {
+		if _, ok := newLayer.Neurons[id]; !ok {
+			changed[id] = true
+			different = true
+		}
+	}
+	return different
+}
+
+// summarizeNetwork counts the structure of the hidden and output layers and averages their parameters.
+func summarizeNetwork(config *NetworkConfig) MutationSummary {
+	summary := MutationSummary{HiddenLayers: len(config.Layers.Hidden)}
+	weightSum, biasSum := 0.0, 0.0
+	numWeights, numBiases := 0, 0
+
+	layers := append(append([]Layer{}, config.Layers.Hidden...), config.Layers.Output)
+	for _, layer := range layers {
+		for _, neuron := range layer.Neurons {
+			summary.Neurons++
+			biasSum += neuron.Bias
+			numBiases++
+			for _, conn := range neuron.Connections {
+				summary.Connections++
+				weightSum += conn.Weight
+				numWeights++
+			}
+		}
+		for _, filter := range layer.Filters {
+			summary.Filters++
+			biasSum += filter.Bias
+			numBiases++
+			for _, row := range filter.Weights {
+				for _, w := range row {
+					weightSum += w
+					numWeights++
+				}
+			}
+		}
+		for _, cell := range layer.LSTMCells {
+			summary.LSTMCells++
+			biasSum += cell.Bias
+			numBiases++
+			for _, weights := range [][]float64{cell.InputWeights, cell.ForgetWeights, cell.OutputWeights, cell.CellWeights} {
+				for _, w := range weights {
+					weightSum += w
+					numWeights++
+				}
+			}
+		}
+	}
+
+	if numWeights > 0 {
+		summary.MeanWeight = weightSum / float64(numWeights)
+	}
+	if numBiases > 0 {
+		summary.MeanBias = biasSum / float64(numBiases)
+	}
+	// NaN would make the metadata unencodable
+	if math.IsNaN(summary.MeanWeight) || math.IsInf(summary.MeanWeight, 0) {
+		summary.MeanWeight = 0
+	}
+	if math.IsNaN(summary.MeanBias) || math.IsInf(summary.MeanBias, 0) {
+		summary.MeanBias = 0
+	}
+	return summary
+}
+
+// FormatMutationRecord renders a record as a single line for logging.
+func FormatMutationRecord(record MutationRecord) string {
+	return fmt.Sprintf("%s (seed %d) layers %v, %d neurons changed, hidden layers %d -> %d, neurons %d -> %d, connections %d -> %d",
+		record.Operator, record.Seed, record.Layers, record.NeuronsChanged,
+		record.Before.HiddenLayers, record.After.HiddenLayers,
+		record.Before.Neurons, record.After.Neurons,
+		record.Before.Connections, record.After.Connections)
+}
@@ -0,0 +1,261 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// MutationFunc is the common signature every registered mutation operator is adapted to.
+type MutationFunc func(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand)
+
+// MutationOperator describes how a named mutation is picked by a MutationPolicy.
+type MutationOperator struct {
+	Name       string   `json:"name"`                 // Key into the mutation registry
+	Weight     float64  `json:"weight"`               // Relative selection weight
+	Rate       int      `json:"rate,omitempty"`       // Overrides the caller's mutation rate when > 0
+	LayerTypes []string `json:"layerTypes,omitempty"` // Only applicable if the model has one of these layer types (empty = always)
+}
+
+// MutationPolicy is a weighted set of mutation operators that MutateNetworkWithPolicy samples from.
+type MutationPolicy struct {
+	Name      string             `json:"name"`
+	Operators []MutationOperator `json:"operators"`
+}
+
+// mutationRegistry maps operator names to their implementations.
+var mutationRegistry = map[string]MutationFunc{
+	// FFNN mutations
+	"MutateWeights":             MutateWeights,
+	"AddNeuron":                 func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddNeuron(c, rate, rng) },
+	"AddLayerFullConnections":   func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddLayerFullConnections(c, rate, rng) },
+	"AddLayer":                  func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddLayer(c, rate, rng) },
+	"AddLayerRandomPosition":    func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddLayerRandomPosition(c, rate, rng) },
+	"MutateActivationFunctions": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateActivationFunctions(c, rate, rng) },
+	"RemoveNeuron":              func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { RemoveNeuron(c, rate, rng) },
+	"RemoveLayer":               func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { RemoveLayer(c, rate, rng) },
+	"DuplicateNeuron":           func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { DuplicateNeuron(c, rate, rng) },
+	"MutateBiases":              func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateBiases(c, rate, lr, rng) },
+	"RandomizeWeights":          func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { RandomizeWeights(c, rate, rng) },
+	"SplitNeuron":               func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { SplitNeuron(c, rate, rng) },
+	"SwapLayerActivations":      func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { SwapLayerActivations(c, rate, rng) },
+	"ShuffleLayerConnections":   func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { ShuffleLayerConnections(c, rate, rng) },
+	"ShuffleLayers":             func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { ShuffleLayers(c, rate, rng) },
+	"AddMultipleLayers":         func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddMultipleLayers(c, rate, rng) },
+	"DoubleLayers":              func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { DoubleLayers(c, rate, rng) },
+	"MirrorLayersTopToBottom":   func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MirrorLayersTopToBottom(c, rate, rng) },
+	"MirrorEdgesSideToSide":     func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MirrorEdgesSideToSide(c, rate, rng) },
+	"InvertWeights":             func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertWeights(c, rate, rng) },
+	"InvertBiases":              func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertBiases(c, rate, rng) },
+	"InvertActivationFunctions": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertActivationFunctions(c, rate, rng) },
+	"InvertConnections":         func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertConnections(c, rate, rng) },
+	"Net2WiderNeurons":          func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { Net2WiderNeurons(c, rate, rng) },
+	"Net2DeeperLayer":           func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { Net2DeeperLayer(c, rate, rng) },
+	"PruneWeakConnections":      func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { PruneWeakConnections(c, rate, rng) },
+
+	// LSTM mutations
+	"MutateLSTMCells": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateLSTMCells(c, rate, rng) },
+	"AddLSTMLayerAtRandomPosition": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) {
+		AddLSTMLayerAtRandomPosition(c, rate, rng)
+	},
+	"InvertLSTMWeights":    func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertLSTMWeights(c, rate, rng) },
+	"RandomizeLSTMWeights": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { RandomizeLSTMWeights(c, rate, rng) },
+	"MutateLSTMBiases":     func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateLSTMBiases(c, rate, lr, rng) },
+	"MutateLSTMWeights":    MutateLSTMWeights,
+
+	// CNN mutations
+	"MutateCNNWeights":    MutateCNNWeights,
+	"MutateCNNBiases":     func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateCNNBiases(c, rate, lr, rng) },
+	"RandomizeCNNWeights": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { RandomizeCNNWeights(c, rate, rng) },
+	"InvertCNNWeights":    func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { InvertCNNWeights(c, rate, rng) },
+	"AddCNNLayerAtRandomPosition": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) {
+		AddCNNLayerAtRandomPosition(c, rate, rng)
+	},
+	"MutateCNNFilterSize":       func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateCNNFilterSize(c, rate, rng) },
+	"MutateCNNStrideAndPadding": func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { MutateCNNStrideAndPadding(c, rate, rng) },
+	"DuplicateCNNLayer":         func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { DuplicateCNNLayer(c, rate, rng) },
+	"AddMultipleCNNLayers":      func(c *NetworkConfig, lr float64, rate int, rng *rand.Rand) { AddMultipleCNNLayers(c, rate, 3, rng) },
+}
+
+// RegisterMutation adds (or replaces) a named mutation operator so policies can reference it.
+func RegisterMutation(name string, fn MutationFunc) {
+	mutationRegistry[name] = fn
+}
+
+// GetMutation returns the registered implementation for the given operator name.
+func GetMutation(name string) (MutationFunc, bool) {
+	fn, ok := mutationRegistry[name]
+	return fn, ok
+}
+
+// DefaultMutationPolicy returns a policy with every built-in operator at equal weight.
+// Operators that add CNN or LSTM layers apply to any model, so dense models can grow them; operators that
+// modify such layers only apply to models that already contain one.
+func DefaultMutationPolicy() *MutationPolicy {
+	denseLayers := []string{"dense"}
+	lstm := []string{"lstm"}
+	conv := []string{"conv"}
+
+	return &MutationPolicy{
+		Name: "default",
+		Operators: []MutationOperator{
+			{Name: "MutateWeights", Weight: 1},
+			{Name: "AddNeuron", Weight: 1, LayerTypes: denseLayers},
+			{Name: "AddLayerFullConnections", Weight: 1},
+			{Name: "AddLayer", Weight: 1},
+			{Name: "AddLayerRandomPosition", Weight: 1},
+			{Name: "MutateActivationFunctions", Weight: 1},
+			{Name: "RemoveNeuron", Weight: 1, LayerTypes: denseLayers},
+			{Name: "RemoveLayer", Weight: 1},
+			{Name: "DuplicateNeuron", Weight: 1, LayerTypes: denseLayers},
+			{Name: "MutateBiases", Weight: 1},
+			{Name: "RandomizeWeights", Weight: 1},
+			{Name: "SplitNeuron", Weight: 1, LayerTypes: denseLayers},
+			{Name: "SwapLayerActivations", Weight: 1, LayerTypes: denseLayers},
+			{Name: "ShuffleLayerConnections", Weight: 1, LayerTypes: denseLayers},
+			{Name: "ShuffleLayers", Weight: 1},
+			{Name: "AddMultipleLayers", Weight: 1},
+			{Name: "DoubleLayers", Weight: 1},
+			{Name: "MirrorLayersTopToBottom", Weight: 1},
+			{Name: "MirrorEdgesSideToSide", Weight: 1, LayerTypes: denseLayers},
+			{Name: "InvertWeights", Weight: 1},
+			{Name: "InvertBiases", Weight: 1},
+			{Name: "InvertActivationFunctions", Weight: 1},
+			{Name: "InvertConnections", Weight: 1},
+			{Name: "Net2WiderNeurons", Weight: 1, LayerTypes: denseLayers},
+			{Name: "Net2DeeperLayer", Weight: 1},
+			{Name: "PruneWeakConnections", Weight: 1, LayerTypes: denseLayers},
+
+			{Name: "MutateLSTMCells", Weight: 1, LayerTypes: lstm},
+			{Name: "AddLSTMLayerAtRandomPosition", Weight: 1},
+			{Name: "InvertLSTMWeights", Weight: 1, LayerTypes: lstm},
+			{Name: "RandomizeLSTMWeights", Weight: 1, LayerTypes: lstm},
+			{Name: "MutateLSTMBiases", Weight: 1, LayerTypes: lstm},
+			{Name: "MutateLSTMWeights", Weight: 1, LayerTypes: lstm},
+
+			{Name: "MutateCNNWeights", Weight: 1, LayerTypes: conv},
+			{Name: "MutateCNNBiases", Weight: 1, LayerTypes: conv},
+			{Name: "RandomizeCNNWeights", Weight: 1, LayerTypes: conv},
+			{Name: "InvertCNNWeights", Weight: 1, LayerTypes: conv},
+			{Name: "AddCNNLayerAtRandomPosition", Weight: 1},
+			{Name: "MutateCNNFilterSize", Weight: 1, LayerTypes: conv},
+			{Name: "MutateCNNStrideAndPadding", Weight: 1, LayerTypes: conv},
+			{Name: "DuplicateCNNLayer", Weight: 1, LayerTypes: conv},
+			{Name: "AddMultipleCNNLayers", Weight: 1},
+		},
+	}
+}
+
+// Validate checks that every operator in the policy is registered and has a usable weight.
+func (p *MutationPolicy) Validate() error {
+	if len(p.Operators) == 0 {
+		return fmt.Errorf("mutation policy %q has no operators", p.Name)
+	}
+	for _, op := range p.Operators {
+		if _, ok := mutationRegistry[op.Name]; !ok {
+			return fmt.Errorf("mutation policy %q references unknown operator %q", p.Name, op.Name)
+		}
+		if op.Weight < 0 {
+			return fmt.Errorf("operator %q has negative weight %f", op.Name, op.Weight)
+		}
+		if op.Rate < 0 || op.Rate > 100 {
+			return fmt.Errorf("operator %q has rate %d outside 0-100", op.Name, op.Rate)
+		}
+	}
+	return nil
+}
+
+// Applicable reports whether the operator can act on the given model.
+// The input layer counts as well, so CNN operators can seed the first conv layer of an image model.
+func (op MutationOperator) Applicable(config *NetworkConfig) bool {
+	if len(op.LayerTypes) == 0 {
+		return true
+	}
+	for _, layerType := range op.LayerTypes {
+		if config.Layers.Input.LayerType == layerType {
+			return true
+		}
+		for _, layer := range config.Layers.Hidden {
+			if layer.LayerType == layerType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Select picks an applicable operator with probability proportional to its weight.
+// It returns false if no operator applies to the model.
+func (p *MutationPolicy) Select(config *NetworkConfig, rng *rand.Rand) (MutationOperator, bool) {
+	totalWeight := 0.0
+	for _, op := range p.Operators {
+		if op.Weight > 0 && op.Applicable(config) {
+			totalWeight += op.Weight
+		}
+	}
+	if totalWeight == 0 {
+		return MutationOperator{}, false
+	}
+
+	pick := rng.Float64() * totalWeight
+	var last MutationOperator
+	for _, op := range p.Operators {
+		if op.Weight <= 0 || !op.Applicable(config) {
+			continue
+		}
+		last = op
+		pick -= op.Weight
+		if pick < 0 {
+			return op, true
+		}
+	}
+	return last, true // Guard against floating point rounding
+}
+
+// MutateNetworkWithPolicy applies one operator sampled from the policy and records the policy and the mutation in the model metadata.
+// It returns the name of the applied operator, or an empty string if nothing was applicable.
+func MutateNetworkWithPolicy(config *NetworkConfig, policy *MutationPolicy, learningRate float64, mutationRate int, rng *rand.Rand) string {
+	op, ok := policy.Select(config, rng)
+	if !ok {
+		return ""
+	}
+
+	rate := mutationRate
+	if op.Rate > 0 {
+		rate = op.Rate
+	}
+	if _, err := ApplyMutation(config, op.Name, learningRate, rate, rng); err != nil {
+		return ""
+	}
+
+	config.Metadata.MutationPolicy = policy
+	return op.Name
+}
+
+// LoadMutationPolicy reads a mutation policy from a JSON file and validates it.
+func LoadMutationPolicy(filePath string) (*MutationPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mutation policy: %w", err)
+	}
+
+	var policy MutationPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode mutation policy: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SaveMutationPolicy writes the mutation policy to a JSON file.
+func SaveMutationPolicy(filePath string, policy *MutationPolicy) error {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode mutation policy: %w", err)
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
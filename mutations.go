@@ -3,7 +3,6 @@ package dense
 import (
 	"fmt"
 	"math/rand"
-	"time"
 )
 
 // MutationType defines the types of mutations available
@@ -25,102 +24,27 @@ const (
     ShuffleLayerConnectionsMutation
     ShuffleLayersMutation // New mutation type to shuffle layers
 )
-// Example usage in MutateNetwork
-func MutateNetwork(config *NetworkConfig, learningRate float64, mutationRate int) {
-    rand.Seed(time.Now().UnixNano())
-
-    // Randomly select the mutation type to apply
-    switch rand.Intn(23) { // Updated to include the new mutation types
-    case int(MutateWeight):
-        MutateWeights(config, learningRate, mutationRate)
-    case int(AddNeuronMutation):
-        AddNeuron(config, mutationRate)
-    case int(AddLayerFullConnectionMutation):
-        AddLayerFullConnections(config, mutationRate)
-    case int(AddLayerSparseMutation):
-        AddLayer(config, mutationRate)
-    case int(AddLayerRandomPositionMutation):
-        AddLayerRandomPosition(config, mutationRate)
-    case int(MutateActivationFunction):
-        MutateActivationFunctions(config, mutationRate)
-    case int(RemoveNeuronMutation):
-        RemoveNeuron(config, mutationRate)
-    case int(RemoveLayerMutation):
-        RemoveLayer(config, mutationRate)
-    case int(DuplicateNeuronMutation):
-        DuplicateNeuron(config, mutationRate)
-    case int(MutateBiasMutation):
-        MutateBiases(config, mutationRate, learningRate)
-    case int(RandomizeWeightsMutation):
-        RandomizeWeights(config, mutationRate)
-    case int(SplitNeuronMutation):
-        SplitNeuron(config, mutationRate)
-    case int(SwapLayerActivationsMutation):
-        SwapLayerActivations(config, mutationRate)
-    case int(ShuffleLayerConnectionsMutation):
-        ShuffleLayerConnections(config, mutationRate)
-    case int(ShuffleLayersMutation):
-        ShuffleLayers(config, mutationRate)
-    case 15: // Add multiple random layers
-        AddMultipleLayers(config, mutationRate)
-    case 16: // Double the number of layers
-        DoubleLayers(config, mutationRate)
-    case 17: // Mirror layers from top to bottom
-        MirrorLayersTopToBottom(config, mutationRate)
-    case 18: // Mirror edges from side to side
-        MirrorEdgesSideToSide(config, mutationRate)
-    case 19: // Invert weights
-        InvertWeights(config, mutationRate)
-    case 20: // Invert biases
-        InvertBiases(config, mutationRate)
-    case 21: // Invert activation functions
-        InvertActivationFunctions(config, mutationRate)
-    case 22: // Invert connections
-        InvertConnections(config, mutationRate)
-
-    // LSTM mutations
-    case 23: 
-        MutateLSTMCells(config, mutationRate)
-    case 24: 
-        AddLSTMLayerAtRandomPosition(config, mutationRate)
-    case 25:
-        InvertLSTMWeights(config, mutationRate)
-    case 26:
-        RandomizeLSTMWeights(config, mutationRate)
-    case 27:
-        MutateLSTMBiases(config, mutationRate, learningRate) // Fixed argument mismatch
-    case 28:
-        MutateLSTMWeights(config, learningRate, mutationRate) // Fixed argument mismatch
-
-    // CNN mutations
-    case 29:
-        MutateCNNWeights(config, learningRate, mutationRate) // Fixed argument mismatch
-    case 30:
-        MutateCNNBiases(config, mutationRate, learningRate)  // Fixed argument mismatch
-    case 31:
-        RandomizeCNNWeights(config, mutationRate) // Fixed argument mismatch
-    case 32:
-        InvertCNNWeights(config, mutationRate)
-
-    case 33:
-        AddCNNLayerAtRandomPosition(config, mutationRate)
-    }
 
-    // restoreInputAndOutputLayers(config, savedInputLayer, savedOutputLayer)
+// MutateNetwork applies a single operator sampled from the default mutation policy.
+// Use MutateNetworkWithPolicy to control which operators are picked and how often.
+func MutateNetwork(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
+    MutateNetworkWithPolicy(config, DefaultMutationPolicy(), learningRate, mutationRate, rng)
 }
 
 
 
 // InvertWeights inverts a percentage of the network's weights based on the mutation rate
-func InvertWeights(config *NetworkConfig, mutationRate int) {
+func InvertWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
-            for connID, conn := range neuron.Connections {
-                if rand.Intn(100) < mutationRate {
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
+            for _, connID := range sortedKeys(neuron.Connections) {
+                conn := neuron.Connections[connID]
+                if rng.Intn(100) < mutationRate {
                     conn.Weight = -conn.Weight // Invert the weight
                     neuron.Connections[connID] = conn
                 }
@@ -129,9 +53,11 @@ func InvertWeights(config *NetworkConfig, mutationRate int) {
         }
     }
 
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        for connID, conn := range neuron.Connections {
-            if rand.Intn(100) < mutationRate {
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        for _, connID := range sortedKeys(neuron.Connections) {
+            conn := neuron.Connections[connID]
+            if rng.Intn(100) < mutationRate {
                 conn.Weight = -conn.Weight // Invert the weight
                 neuron.Connections[connID] = conn
             }
@@ -143,22 +69,24 @@ func InvertWeights(config *NetworkConfig, mutationRate int) {
 }
 
 // InvertBiases inverts a percentage of the neuron biases based on the mutation rate
-func InvertBiases(config *NetworkConfig, mutationRate int) {
+func InvertBiases(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
-            if rand.Intn(100) < mutationRate {
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
+            if rng.Intn(100) < mutationRate {
                 neuron.Bias = -neuron.Bias // Invert the bias
                 layer.Neurons[neuronID] = neuron
             }
         }
     }
 
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        if rand.Intn(100) < mutationRate {
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        if rng.Intn(100) < mutationRate {
             neuron.Bias = -neuron.Bias // Invert the bias
             config.Layers.Output.Neurons[neuronID] = neuron
         }
@@ -168,7 +96,7 @@ func InvertBiases(config *NetworkConfig, mutationRate int) {
 }
 
 // InvertActivationFunctions inverts the activation functions based on mutation rate
-func InvertActivationFunctions(config *NetworkConfig, mutationRate int) {
+func InvertActivationFunctions(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
@@ -182,8 +110,9 @@ func InvertActivationFunctions(config *NetworkConfig, mutationRate int) {
 
     // Randomly mutate activation functions for neurons in hidden layers
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
-            if rand.Intn(100) < mutationRate {
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
+            if rng.Intn(100) < mutationRate {
                 invertedActivation := activationInversionMap[neuron.ActivationType]
                 neuron.ActivationType = invertedActivation
                 layer.Neurons[neuronID] = neuron
@@ -192,8 +121,9 @@ func InvertActivationFunctions(config *NetworkConfig, mutationRate int) {
     }
 
     // Randomly mutate activation functions for neurons in output layer
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        if rand.Intn(100) < mutationRate {
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        if rng.Intn(100) < mutationRate {
             invertedActivation := activationInversionMap[neuron.ActivationType]
             neuron.ActivationType = invertedActivation
             config.Layers.Output.Neurons[neuronID] = neuron
@@ -204,16 +134,18 @@ func InvertActivationFunctions(config *NetworkConfig, mutationRate int) {
 }
 
 // InvertConnections inverts a percentage of connections between neurons based on mutation rate
-func InvertConnections(config *NetworkConfig, mutationRate int) {
+func InvertConnections(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
             invertedConnections := make(map[string]Connection)
-            for connID, conn := range neuron.Connections {
-                if rand.Intn(100) < mutationRate {
+            for _, connID := range sortedKeys(neuron.Connections) {
+                conn := neuron.Connections[connID]
+                if rng.Intn(100) < mutationRate {
                     invertedConnections[connID] = Connection{Weight: -conn.Weight} // Invert the connection weight
                 } else {
                     invertedConnections[connID] = conn
@@ -224,10 +156,12 @@ func InvertConnections(config *NetworkConfig, mutationRate int) {
         }
     }
 
-    for neuronID, neuron := range config.Layers.Output.Neurons {
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
         invertedConnections := make(map[string]Connection)
-        for connID, conn := range neuron.Connections {
-            if rand.Intn(100) < mutationRate {
+        for _, connID := range sortedKeys(neuron.Connections) {
+            conn := neuron.Connections[connID]
+            if rng.Intn(100) < mutationRate {
                 invertedConnections[connID] = Connection{Weight: -conn.Weight} // Invert the connection weight
             } else {
                 invertedConnections[connID] = conn
@@ -242,24 +176,23 @@ func InvertConnections(config *NetworkConfig, mutationRate int) {
 
 
 // AddMultipleLayers adds a random number of layers to the network
-func AddMultipleLayers(config *NetworkConfig, mutationRate int) {
-    rand.Seed(time.Now().UnixNano())
+func AddMultipleLayers(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
 
-    if rand.Intn(100) < mutationRate {
-        numNewLayers := rand.Intn(5) + 1 // Add 1 to 5 layers randomly
+    if rng.Intn(100) < mutationRate {
+        numNewLayers := rng.Intn(5) + 1 // Add 1 to 5 layers randomly
         for i := 0; i < numNewLayers; i++ {
             newLayer := Layer{
                 Neurons: make(map[string]Neuron),
             }
 
             // Add 1 to 3 neurons to each new layer
-            numNewNeurons := rand.Intn(3) + 1
+            numNewNeurons := rng.Intn(3) + 1
             for j := 0; j < numNewNeurons; j++ {
                 neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
                 newNeuron := Neuron{
-                    ActivationType: randomActivationType(),
+                    ActivationType: randomActivationType(rng),
                     Connections:    make(map[string]Connection),
-                    Bias:           rand.NormFloat64(),
+                    Bias:           rng.NormFloat64(),
                 }
 
                 // Connect the new neuron to the previous layer's neurons
@@ -269,8 +202,8 @@ func AddMultipleLayers(config *NetworkConfig, mutationRate int) {
                 } else {
                     previousLayerNeurons = config.Layers.Hidden[len(config.Layers.Hidden)-1].Neurons
                 }
-                for prevNeuronID := range previousLayerNeurons {
-                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+                for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
                 }
 
                 // Add the new neuron to the layer
@@ -285,9 +218,8 @@ func AddMultipleLayers(config *NetworkConfig, mutationRate int) {
     }
 }
 
-func AppendMultipleLayers(config *NetworkConfig, numNewLayers int, numNewNeurons int) {
-    rand.Seed(time.Now().UnixNano())
-        //numNewLayers := rand.Intn(5) + 1 // Add 1 to 5 layers randomly
+func AppendMultipleLayers(config *NetworkConfig, numNewLayers int, numNewNeurons int, rng *rand.Rand) {
+        //numNewLayers := rng.Intn(5) + 1 // Add 1 to 5 layers randomly
         for i := 0; i < numNewLayers; i++ {
             newLayer := Layer{
                 Neurons: make(map[string]Neuron),
@@ -296,9 +228,9 @@ func AppendMultipleLayers(config *NetworkConfig, numNewLayers int, numNewNeurons
             for j := 0; j < numNewNeurons; j++ {
                 neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
                 newNeuron := Neuron{
-                    ActivationType: randomActivationType(),
+                    ActivationType: randomActivationType(rng),
                     Connections:    make(map[string]Connection),
-                    Bias:           rand.NormFloat64(),
+                    Bias:           rng.NormFloat64(),
                 }
 
                 // Connect the new neuron to the previous layer's neurons
@@ -308,8 +240,8 @@ func AppendMultipleLayers(config *NetworkConfig, numNewLayers int, numNewNeurons
                 } else {
                     previousLayerNeurons = config.Layers.Hidden[len(config.Layers.Hidden)-1].Neurons
                 }
-                for prevNeuronID := range previousLayerNeurons {
-                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+                for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
                 }
 
                 // Add the new neuron to the layer
@@ -322,8 +254,8 @@ func AppendMultipleLayers(config *NetworkConfig, numNewLayers int, numNewNeurons
 }
 
 // DoubleLayers duplicates the current layers in the network
-func DoubleLayers(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func DoubleLayers(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         currentLayers := len(config.Layers.Hidden)
         for i := 0; i < currentLayers; i++ {
             newLayer := Layer{
@@ -345,8 +277,8 @@ func DoubleLayers(config *NetworkConfig, mutationRate int) {
 }
 
 // MirrorLayersTopToBottom mirrors the layers from top to bottom (reverse the order)
-func MirrorLayersTopToBottom(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func MirrorLayersTopToBottom(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         mirroredLayers := make([]Layer, len(config.Layers.Hidden))
         for i := range config.Layers.Hidden {
             mirroredLayers[len(config.Layers.Hidden)-1-i] = config.Layers.Hidden[i]
@@ -359,8 +291,8 @@ func MirrorLayersTopToBottom(config *NetworkConfig, mutationRate int) {
 }
 
 // MirrorEdgesSideToSide mirrors the connections in each layer from side to side (reverse the connections)
-func MirrorEdgesSideToSide(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func MirrorEdgesSideToSide(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         for _, layer := range config.Layers.Hidden {
             for neuronID, neuron := range layer.Neurons {
                 mirroredConnections := make(map[string]Connection)
@@ -382,7 +314,7 @@ func MirrorEdgesSideToSide(config *NetworkConfig, mutationRate int) {
 }
 
 // ShuffleLayers shuffles the order of hidden layers based on the mutation rate.
-func ShuffleLayers(config *NetworkConfig, mutationRate int) {
+func ShuffleLayers(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if len(config.Layers.Hidden) == 0 || mutationRate <= 0 {
         return
     }
@@ -395,7 +327,7 @@ func ShuffleLayers(config *NetworkConfig, mutationRate int) {
     }
 
     // Generate shuffled indices and reorder the hidden layers.
-    indices := rand.Perm(len(config.Layers.Hidden))
+    indices := rng.Perm(len(config.Layers.Hidden))
     shuffledLayers := make([]Layer, len(config.Layers.Hidden))
 
     for i := 0; i < numLayersToShuffle; i++ {
@@ -412,8 +344,7 @@ func ShuffleLayers(config *NetworkConfig, mutationRate int) {
 
 
 // MutateWeights randomly mutates the network's weights with a given mutation rate
-func OLDMutateWeights(config *NetworkConfig, learningRate float64, mutationRate int) {
-    rand.Seed(time.Now().UnixNano())
+func OLDMutateWeights(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
 
     // Ensure mutationRate is within bounds
     if mutationRate < 0 {
@@ -441,15 +372,16 @@ func OLDMutateWeights(config *NetworkConfig, learningRate float64, mutationRate
     // Step 3: Randomly choose which weights to mutate
     mutatedCount := 0
     for _, layer := range config.Layers.Hidden {
-        for _, neuron := range layer.Neurons {
-            for connID := range neuron.Connections {
+        for _, key := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[key]
+            for _, connID := range sortedKeys(neuron.Connections) {
                 if mutatedCount >= weightsToMutate {
                     break
                 }
                 // Randomly decide if we mutate this connection (weight)
-                if rand.Float64() < float64(weightsToMutate-mutatedCount)/float64(totalWeights-mutatedCount) {
+                if rng.Float64() < float64(weightsToMutate-mutatedCount)/float64(totalWeights-mutatedCount) {
                     neuron.Connections[connID] = Connection{
-                        Weight: neuron.Connections[connID].Weight + rand.NormFloat64()*learningRate,
+                        Weight: neuron.Connections[connID].Weight + rng.NormFloat64()*learningRate,
                     }
                     mutatedCount++
                 }
@@ -458,31 +390,31 @@ func OLDMutateWeights(config *NetworkConfig, learningRate float64, mutationRate
                 break
             }
             // Randomly decide if we mutate this neuron's bias
-            if mutatedCount < weightsToMutate && rand.Float64() < float64(weightsToMutate-mutatedCount)/float64(totalWeights-mutatedCount) {
-                neuron.Bias += rand.NormFloat64() * learningRate
+            if mutatedCount < weightsToMutate && rng.Float64() < float64(weightsToMutate-mutatedCount)/float64(totalWeights-mutatedCount) {
+                neuron.Bias += rng.NormFloat64() * learningRate
                 mutatedCount++
             }
         }
     }
 
     // Mutate output layer weights and biases
-    for _, neuron := range config.Layers.Output.Neurons {
-        for connID := range neuron.Connections {
-            if rand.Float64() < float64(mutationRate)/100.0 {
+    for _, key := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[key]
+        for _, connID := range sortedKeys(neuron.Connections) {
+            if rng.Float64() < float64(mutationRate)/100.0 {
                 neuron.Connections[connID] = Connection{
-                    Weight: neuron.Connections[connID].Weight + rand.NormFloat64()*learningRate,
+                    Weight: neuron.Connections[connID].Weight + rng.NormFloat64()*learningRate,
                 }
             }
         }
         // Mutate output neuron bias
-        if rand.Float64() < float64(mutationRate)/100.0 {
-            neuron.Bias += rand.NormFloat64() * learningRate
+        if rng.Float64() < float64(mutationRate)/100.0 {
+            neuron.Bias += rng.NormFloat64() * learningRate
         }
     }
 }
 
-func MutateWeights(config *NetworkConfig, learningRate float64, mutationRate int) {
-    rand.Seed(time.Now().UnixNano())
+func MutateWeights(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
 
     if mutationRate <= 0 {
         return
@@ -491,15 +423,16 @@ func MutateWeights(config *NetworkConfig, learningRate float64, mutationRate int
     // Mutate only dense (FFNN) or convolutional (CNN) layers
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "dense" { // FFNN layer
-            for neuronID, neuron := range layer.Neurons {
-                for connID := range neuron.Connections {
-                    if rand.Intn(100) < mutationRate {
+            for _, neuronID := range sortedKeys(layer.Neurons) {
+                neuron := layer.Neurons[neuronID]
+                for _, connID := range sortedKeys(neuron.Connections) {
+                    if rng.Intn(100) < mutationRate {
                         neuron.Connections[connID] = Connection{
-                            Weight: neuron.Connections[connID].Weight + rand.NormFloat64()*learningRate,
+                            Weight: neuron.Connections[connID].Weight + rng.NormFloat64()*learningRate,
                         }
                     }
                 }
-                neuron.Bias += rand.NormFloat64() * learningRate
+                neuron.Bias += rng.NormFloat64() * learningRate
                 layer.Neurons[neuronID] = neuron
             }
         } else if layer.LayerType == "conv" { // CNN layer
@@ -507,27 +440,28 @@ func MutateWeights(config *NetworkConfig, learningRate float64, mutationRate int
                 filter := &layer.Filters[i]
                 for x := range filter.Weights {
                     for y := range filter.Weights[x] {
-                        if rand.Intn(100) < mutationRate {
-                            filter.Weights[x][y] += rand.NormFloat64() * learningRate
+                        if rng.Intn(100) < mutationRate {
+                            filter.Weights[x][y] += rng.NormFloat64() * learningRate
                         }
                     }
                 }
-                filter.Bias += rand.NormFloat64() * learningRate
+                filter.Bias += rng.NormFloat64() * learningRate
             }
         }
     }
 
     // Also mutate the output layer (which should be FFNN)
     if config.Layers.Output.LayerType == "dense" {
-        for neuronID, neuron := range config.Layers.Output.Neurons {
-            for connID := range neuron.Connections {
-                if rand.Intn(100) < mutationRate {
+        for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+            neuron := config.Layers.Output.Neurons[neuronID]
+            for _, connID := range sortedKeys(neuron.Connections) {
+                if rng.Intn(100) < mutationRate {
                     neuron.Connections[connID] = Connection{
-                        Weight: neuron.Connections[connID].Weight + rand.NormFloat64()*learningRate,
+                        Weight: neuron.Connections[connID].Weight + rng.NormFloat64()*learningRate,
                     }
                 }
             }
-            neuron.Bias += rand.NormFloat64() * learningRate
+            neuron.Bias += rng.NormFloat64() * learningRate
             config.Layers.Output.Neurons[neuronID] = neuron
         }
     }
@@ -535,7 +469,7 @@ func MutateWeights(config *NetworkConfig, learningRate float64, mutationRate int
 
 
 // AddNeuron adds a new neuron to a random hidden layer based on the mutation rate
-func OLDAddNeuron(config *NetworkConfig, mutationRate int) {
+func OLDAddNeuron(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     // Ensure mutationRate is within bounds
     if mutationRate < 0 {
         mutationRate = 0
@@ -546,22 +480,22 @@ func OLDAddNeuron(config *NetworkConfig, mutationRate int) {
     // Check if there are any hidden layers to add a neuron to
     if len(config.Layers.Hidden) == 0 {
        //  fmt.Println("No hidden layers found. Adding a new layer first.")
-        AddLayer(config, mutationRate) // Add a new layer if there are none
+        AddLayer(config, mutationRate, rng) // Add a new layer if there are none
         return
     }
 
     // Randomly decide if we should add a neuron based on the mutation rate
-    if rand.Intn(100) < mutationRate {
+    if rng.Intn(100) < mutationRate {
         // Randomly pick an existing hidden layer to add the neuron to
-        layerIdx := rand.Intn(len(config.Layers.Hidden))
+        layerIdx := rng.Intn(len(config.Layers.Hidden))
         layer := &config.Layers.Hidden[layerIdx]
 
         // Add the new neuron
         neuronID := fmt.Sprintf("neuron%d", len(layer.Neurons)+1)
         newNeuron := Neuron{
-            ActivationType: randomActivationType(),
+            ActivationType: randomActivationType(rng),
             Connections:    make(map[string]Connection),
-            Bias:           rand.NormFloat64(),
+            Bias:           rng.NormFloat64(),
         }
 
         // Connect the new neuron to the previous layer
@@ -571,20 +505,20 @@ func OLDAddNeuron(config *NetworkConfig, mutationRate int) {
         } else {
             previousLayerNeurons = config.Layers.Hidden[layerIdx-1].Neurons
         }
-        for prevNeuronID := range previousLayerNeurons {
-            newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+        for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+            newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
         }
 
         // Connect the new neuron to the next layer (if it exists)
         if layerIdx < len(config.Layers.Hidden)-1 {
             nextLayer := &config.Layers.Hidden[layerIdx+1]
-            for nextNeuronID := range nextLayer.Neurons {
-                nextLayer.Neurons[nextNeuronID].Connections[neuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, nextNeuronID := range sortedKeys(nextLayer.Neurons) {
+                nextLayer.Neurons[nextNeuronID].Connections[neuronID] = Connection{Weight: rng.NormFloat64()}
             }
         } else {
             // Connect the new neuron to the output layer
-            for outputNeuronID := range config.Layers.Output.Neurons {
-                config.Layers.Output.Neurons[outputNeuronID].Connections[neuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, outputNeuronID := range sortedKeys(config.Layers.Output.Neurons) {
+                config.Layers.Output.Neurons[outputNeuronID].Connections[neuronID] = Connection{Weight: rng.NormFloat64()}
             }
         }
 
@@ -595,19 +529,19 @@ func OLDAddNeuron(config *NetworkConfig, mutationRate int) {
     }
 }
 
-func AddNeuron(config *NetworkConfig, mutationRate int) {
+func AddNeuron(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     // Only add neurons to dense (FFNN) layers
     for i, layer := range config.Layers.Hidden {
-        if layer.LayerType == "dense" && rand.Intn(100) < mutationRate {
+        if layer.LayerType == "dense" && rng.Intn(100) < mutationRate {
             neuronID := fmt.Sprintf("neuron%d", len(layer.Neurons)+1)
             newNeuron := Neuron{
-                ActivationType: randomActivationType(),
+                ActivationType: randomActivationType(rng),
                 Connections:    make(map[string]Connection),
-                Bias:           rand.NormFloat64(),
+                Bias:           rng.NormFloat64(),
             }
 
             // Connect the new neuron to the previous layer
@@ -618,8 +552,8 @@ func AddNeuron(config *NetworkConfig, mutationRate int) {
                 previousLayerNeurons = config.Layers.Hidden[i-1].Neurons
             }
 
-            for prevNeuronID := range previousLayerNeurons {
-                newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
             }
 
             // Add the neuron to the current layer
@@ -632,20 +566,20 @@ func AddNeuron(config *NetworkConfig, mutationRate int) {
 
 
 // AddLayer adds a new hidden layer with random neurons to the network
-func AddLayerFullConnections(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func AddLayerFullConnections(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         newLayer := Layer{
             Neurons: make(map[string]Neuron),
         }
 
         // Add 1 to 3 neurons to this new layer
-        numNewNeurons := rand.Intn(3) + 1
+        numNewNeurons := rng.Intn(3) + 1
         for i := 0; i < numNewNeurons; i++ {
             neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
             newNeuron := Neuron{
-                ActivationType: randomActivationType(),
+                ActivationType: randomActivationType(rng),
                 Connections:    make(map[string]Connection),
-                Bias:           rand.NormFloat64(),
+                Bias:           rng.NormFloat64(),
             }
 
             // Connect the new neuron to the previous layer's neurons
@@ -655,8 +589,8 @@ func AddLayerFullConnections(config *NetworkConfig, mutationRate int) {
             } else {
                 previousLayerNeurons = config.Layers.Hidden[len(config.Layers.Hidden)-1].Neurons
             }
-            for prevNeuronID := range previousLayerNeurons {
-                newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
             }
 
             // Add the new neuron to the layer
@@ -669,9 +603,10 @@ func AddLayerFullConnections(config *NetworkConfig, mutationRate int) {
            //  fmt.Println("Connecting new layer to the output layer directly")
         }
         //for outputNeuronID, outputNeuron := range config.Layers.Output.Neurons {
-        for _, outputNeuron := range config.Layers.Output.Neurons {
-            for newNeuronID := range newLayer.Neurons {
-                outputNeuron.Connections[newNeuronID] = Connection{Weight: rand.NormFloat64()}
+        for _, key := range sortedKeys(config.Layers.Output.Neurons) {
+            outputNeuron := config.Layers.Output.Neurons[key]
+            for _, newNeuronID := range sortedKeys(newLayer.Neurons) {
+                outputNeuron.Connections[newNeuronID] = Connection{Weight: rng.NormFloat64()}
                //  fmt.Printf("Connecting new neuron %s to output neuron %s\n", newNeuronID, outputNeuronID)
             }
         }
@@ -683,7 +618,7 @@ func AddLayerFullConnections(config *NetworkConfig, mutationRate int) {
 }
 
 // AddLayer adds a new hidden layer with random neurons to the network
-func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int) {
+func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int, rng *rand.Rand) {
         newLayer := Layer{
             Neurons: make(map[string]Neuron),
         }
@@ -691,9 +626,9 @@ func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int) {
         for i := 0; i < numNewNeurons; i++ {
             neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
             newNeuron := Neuron{
-                ActivationType: randomActivationType(),
+                ActivationType: randomActivationType(rng),
                 Connections:    make(map[string]Connection),
-                Bias:           rand.NormFloat64(),
+                Bias:           rng.NormFloat64(),
             }
 
             // Connect the new neuron to the previous layer's neurons
@@ -703,8 +638,8 @@ func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int) {
             } else {
                 previousLayerNeurons = config.Layers.Hidden[len(config.Layers.Hidden)-1].Neurons
             }
-            for prevNeuronID := range previousLayerNeurons {
-                newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
             }
 
             // Add the new neuron to the layer
@@ -717,9 +652,10 @@ func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int) {
            //  fmt.Println("Connecting new layer to the output layer directly")
         }
         //for outputNeuronID, outputNeuron := range config.Layers.Output.Neurons {
-        for _, outputNeuron := range config.Layers.Output.Neurons {
-            for newNeuronID := range newLayer.Neurons {
-                outputNeuron.Connections[newNeuronID] = Connection{Weight: rand.NormFloat64()}
+        for _, key := range sortedKeys(config.Layers.Output.Neurons) {
+            outputNeuron := config.Layers.Output.Neurons[key]
+            for _, newNeuronID := range sortedKeys(newLayer.Neurons) {
+                outputNeuron.Connections[newNeuronID] = Connection{Weight: rng.NormFloat64()}
                //  fmt.Printf("Connecting new neuron %s to output neuron %s\n", newNeuronID, outputNeuronID)
             }
         }
@@ -732,20 +668,20 @@ func AppendNewLayerFullConnections(config *NetworkConfig, numNewNeurons int) {
 
 
 // AddLayer adds a new hidden layer with random sparse connections
-func OLDAddLayer(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func OLDAddLayer(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         newLayer := Layer{
             Neurons: make(map[string]Neuron),
         }
 
         // Add 1 to 3 neurons to this new layer
-        numNewNeurons := rand.Intn(3) + 1
+        numNewNeurons := rng.Intn(3) + 1
         for i := 0; i < numNewNeurons; i++ {
             neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
             newNeuron := Neuron{
-                ActivationType: randomActivationType(),
+                ActivationType: randomActivationType(rng),
                 Connections:    make(map[string]Connection),
-                Bias:           rand.NormFloat64(),
+                Bias:           rng.NormFloat64(),
             }
 
             // Connect the new neuron to a random subset of the previous layer's neurons
@@ -757,12 +693,12 @@ func OLDAddLayer(config *NetworkConfig, mutationRate int) {
             }
 
             // Generate a random connection ratio between 0 and 1 for sparse connections
-            connectionRatio := rand.Float64()
+            connectionRatio := rng.Float64()
 
             // Create sparse connections based on random connectionRatio
-            for prevNeuronID := range previousLayerNeurons {
-                if rand.Float64() < connectionRatio {  // Random connection
-                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                if rng.Float64() < connectionRatio {  // Random connection
+                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
                 }
             }
 
@@ -776,9 +712,10 @@ func OLDAddLayer(config *NetworkConfig, mutationRate int) {
            //  fmt.Println("Connecting new layer to the output layer directly")
         }
         //for outputNeuronID, outputNeuron := range config.Layers.Output.Neurons {
-        for _, outputNeuron := range config.Layers.Output.Neurons {
-            for newNeuronID := range newLayer.Neurons {
-                outputNeuron.Connections[newNeuronID] = Connection{Weight: rand.NormFloat64()}
+        for _, key := range sortedKeys(config.Layers.Output.Neurons) {
+            outputNeuron := config.Layers.Output.Neurons[key]
+            for _, newNeuronID := range sortedKeys(newLayer.Neurons) {
+                outputNeuron.Connections[newNeuronID] = Connection{Weight: rng.NormFloat64()}
                //  fmt.Printf("Connecting new neuron %s to output neuron %s\n", newNeuronID, outputNeuronID)
             }
         }
@@ -789,28 +726,28 @@ func OLDAddLayer(config *NetworkConfig, mutationRate int) {
     }
 }
 
-func AddLayer(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func AddLayer(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         newLayer := Layer{
             Neurons: make(map[string]Neuron),
         }
 
         // Only add FFNN or CNN layers
-        if rand.Intn(2) == 0 {
+        if rng.Intn(2) == 0 {
             newLayer.LayerType = "dense" // FFNN
-            for i := 0; i < rand.Intn(3)+1; i++ {
+            for i := 0; i < rng.Intn(3)+1; i++ {
                 neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
                 newLayer.Neurons[neuronID] = Neuron{
-                    ActivationType: randomActivationType(),
-                    Bias:           rand.Float64(),
+                    ActivationType: randomActivationType(rng),
+                    Bias:           rng.Float64(),
                     Connections:    make(map[string]Connection),
                 }
             }
         } else {
             newLayer.LayerType = "conv" // CNN
             newLayer.Filters = append(newLayer.Filters, Filter{
-                Weights: Random2DSlice(3, 3),
-                Bias:    rand.Float64(),
+                Weights: Random2DSlice(3, 3, rng),
+                Bias:    rng.Float64(),
             })
         }
 
@@ -822,20 +759,20 @@ func AddLayer(config *NetworkConfig, mutationRate int) {
 
 
 // AddLayer adds a new hidden layer with random sparse connections at a random position
-func AddLayerRandomPosition(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func AddLayerRandomPosition(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         newLayer := Layer{
             Neurons: make(map[string]Neuron),
         }
 
         // Add 1 to 3 neurons to this new layer
-        numNewNeurons := rand.Intn(3) + 1
+        numNewNeurons := rng.Intn(3) + 1
         for i := 0; i < numNewNeurons; i++ {
             neuronID := fmt.Sprintf("neuron%d", len(newLayer.Neurons)+1)
             newNeuron := Neuron{
-                ActivationType: randomActivationType(),
+                ActivationType: randomActivationType(rng),
                 Connections:    make(map[string]Connection),
-                Bias:           rand.NormFloat64(),
+                Bias:           rng.NormFloat64(),
             }
 
             // Connect the new neuron to a random subset of previous layer's neurons
@@ -847,12 +784,12 @@ func AddLayerRandomPosition(config *NetworkConfig, mutationRate int) {
             }
 
             // Generate a random connection ratio between 0 and 1 for sparse connections
-            connectionRatio := rand.Float64()
+            connectionRatio := rng.Float64()
 
             // Create sparse connections based on random connectionRatio
-            for prevNeuronID := range previousLayerNeurons {
-                if rand.Float64() < connectionRatio {
-                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rand.NormFloat64()}
+            for _, prevNeuronID := range sortedKeys(previousLayerNeurons) {
+                if rng.Float64() < connectionRatio {
+                    newNeuron.Connections[prevNeuronID] = Connection{Weight: rng.NormFloat64()}
                 }
             }
 
@@ -862,7 +799,7 @@ func AddLayerRandomPosition(config *NetworkConfig, mutationRate int) {
         }
 
         // Randomly choose a position to insert the new layer
-        insertPosition := rand.Intn(len(config.Layers.Hidden) + 1)
+        insertPosition := rng.Intn(len(config.Layers.Hidden) + 1)
 
         // Insert the new layer at the randomly chosen position
         config.Layers.Hidden = append(config.Layers.Hidden[:insertPosition], append([]Layer{newLayer}, config.Layers.Hidden[insertPosition:]...)...)
@@ -871,17 +808,18 @@ func AddLayerRandomPosition(config *NetworkConfig, mutationRate int) {
 }
 
 // MutateActivationFunctions randomizes the activation functions for all neurons based on the mutation rate
-func OLDMutateActivationFunctions(config *NetworkConfig, mutationRate int) {
+func OLDMutateActivationFunctions(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     // Randomly mutate activation functions for neurons in hidden layers
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
             // Randomly decide if we mutate this neuron's activation function
-            if rand.Intn(100) < mutationRate {
-                newActivation := randomActivationType()
+            if rng.Intn(100) < mutationRate {
+                newActivation := randomActivationType(rng)
                 neuron.ActivationType = newActivation
                 layer.Neurons[neuronID] = neuron // Apply the mutation
                //  fmt.Printf("Mutated activation function of neuron %s to %s\n", neuronID, newActivation)
@@ -890,9 +828,10 @@ func OLDMutateActivationFunctions(config *NetworkConfig, mutationRate int) {
     }
 
     // Randomly mutate activation functions for neurons in output layer
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        if rand.Intn(100) < mutationRate {
-            newActivation := randomActivationType()
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        if rng.Intn(100) < mutationRate {
+            newActivation := randomActivationType(rng)
             neuron.ActivationType = newActivation
             config.Layers.Output.Neurons[neuronID] = neuron // Apply the mutation
            //  fmt.Printf("Mutated activation function of output neuron %s to %s\n", neuronID, newActivation)
@@ -900,7 +839,7 @@ func OLDMutateActivationFunctions(config *NetworkConfig, mutationRate int) {
     }
 }
 
-func MutateActivationFunctions(config *NetworkConfig, mutationRate int) {
+func MutateActivationFunctions(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
@@ -908,9 +847,10 @@ func MutateActivationFunctions(config *NetworkConfig, mutationRate int) {
     // Mutate only dense (FFNN) layers
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "dense" {
-            for neuronID, neuron := range layer.Neurons {
-                if rand.Intn(100) < mutationRate {
-                    neuron.ActivationType = randomActivationType()
+            for _, neuronID := range sortedKeys(layer.Neurons) {
+                neuron := layer.Neurons[neuronID]
+                if rng.Intn(100) < mutationRate {
+                    neuron.ActivationType = randomActivationType(rng)
                     layer.Neurons[neuronID] = neuron
                 }
             }
@@ -919,9 +859,10 @@ func MutateActivationFunctions(config *NetworkConfig, mutationRate int) {
 
     // Also mutate the output layer (which is likely FFNN)
     if config.Layers.Output.LayerType == "dense" {
-        for neuronID, neuron := range config.Layers.Output.Neurons {
-            if rand.Intn(100) < mutationRate {
-                neuron.ActivationType = randomActivationType()
+        for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+            neuron := config.Layers.Output.Neurons[neuronID]
+            if rng.Intn(100) < mutationRate {
+                neuron.ActivationType = randomActivationType(rng)
                 config.Layers.Output.Neurons[neuronID] = neuron
             }
         }
@@ -933,95 +874,99 @@ func MutateActivationFunctions(config *NetworkConfig, mutationRate int) {
 
 
 // Helper function to choose a random activation function
-func randomActivationType() string {
+func randomActivationType(rng *rand.Rand) string {
     activationTypes := []string{"relu", "sigmoid", "tanh", "leaky_relu"}
-    return activationTypes[rand.Intn(len(activationTypes))]
+    return activationTypes[rng.Intn(len(activationTypes))]
 }
 
 
 
-func RemoveNeuron(config *NetworkConfig, mutationRate int) {
+func RemoveNeuron(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if len(config.Layers.Hidden) == 0 || mutationRate <= 0 {
         return
     }
     for layerIdx := range config.Layers.Hidden {
-        if rand.Intn(100) < mutationRate && len(config.Layers.Hidden[layerIdx].Neurons) > 1 {
+        if rng.Intn(100) < mutationRate && len(config.Layers.Hidden[layerIdx].Neurons) > 1 {
             // Randomly select a neuron to remove
-            for neuronID := range config.Layers.Hidden[layerIdx].Neurons {
-                delete(config.Layers.Hidden[layerIdx].Neurons, neuronID)
-               //  fmt.Printf("Removed neuron %s from hidden layer %d\n", neuronID, layerIdx+1)
-                break
-            }
+            neuronIDs := sortedKeys(config.Layers.Hidden[layerIdx].Neurons)
+            neuronID := neuronIDs[rng.Intn(len(neuronIDs))]
+            delete(config.Layers.Hidden[layerIdx].Neurons, neuronID)
+           //  fmt.Printf("Removed neuron %s from hidden layer %d\n", neuronID, layerIdx+1)
             break
         }
     }
 }
 
-func RemoveLayer(config *NetworkConfig, mutationRate int) {
+func RemoveLayer(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if len(config.Layers.Hidden) == 0 || mutationRate <= 0 {
         return
     }
-    if rand.Intn(100) < mutationRate {
-        layerIdx := rand.Intn(len(config.Layers.Hidden))
+    if rng.Intn(100) < mutationRate {
+        layerIdx := rng.Intn(len(config.Layers.Hidden))
         config.Layers.Hidden = append(config.Layers.Hidden[:layerIdx], config.Layers.Hidden[layerIdx+1:]...)
        //  fmt.Printf("Removed hidden layer at position %d\n", layerIdx+1)
     }
 }
 
 
-func DuplicateNeuron(config *NetworkConfig, mutationRate int) {
+func DuplicateNeuron(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if len(config.Layers.Hidden) == 0 || mutationRate <= 0 {
         return
     }
     for layerIdx := range config.Layers.Hidden {
-        if rand.Intn(100) < mutationRate {
+        if rng.Intn(100) < mutationRate {
             // Randomly select a neuron to duplicate
-            for neuronID, neuron := range config.Layers.Hidden[layerIdx].Neurons {
-                newNeuronID := fmt.Sprintf("%s_dup", neuronID)
-                config.Layers.Hidden[layerIdx].Neurons[newNeuronID] = neuron
-               //  fmt.Printf("Duplicated neuron %s as %s in hidden layer %d\n", neuronID, newNeuronID, layerIdx+1)
+            neuronIDs := sortedKeys(config.Layers.Hidden[layerIdx].Neurons)
+            if len(neuronIDs) == 0 {
                 break
             }
+            neuronID := neuronIDs[rng.Intn(len(neuronIDs))]
+            newNeuronID := fmt.Sprintf("%s_dup", neuronID)
+            config.Layers.Hidden[layerIdx].Neurons[newNeuronID] = config.Layers.Hidden[layerIdx].Neurons[neuronID]
+           //  fmt.Printf("Duplicated neuron %s as %s in hidden layer %d\n", neuronID, newNeuronID, layerIdx+1)
             break
         }
     }
 }
 
 
-func MutateBiases(config *NetworkConfig, mutationRate int, learningRate float64) {
+func MutateBiases(config *NetworkConfig, mutationRate int, learningRate float64, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
-            if rand.Intn(100) < mutationRate {
-                neuron.Bias += rand.NormFloat64() * learningRate
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
+            if rng.Intn(100) < mutationRate {
+                neuron.Bias += rng.NormFloat64() * learningRate
                 layer.Neurons[neuronID] = neuron
                //  fmt.Printf("Mutated bias of neuron %s to %.4f\n", neuronID, neuron.Bias)
             }
         }
     }
 
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        if rand.Intn(100) < mutationRate {
-            neuron.Bias += rand.NormFloat64() * learningRate
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        if rng.Intn(100) < mutationRate {
+            neuron.Bias += rng.NormFloat64() * learningRate
             config.Layers.Output.Neurons[neuronID] = neuron
            //  fmt.Printf("Mutated bias of output neuron %s to %.4f\n", neuronID, neuron.Bias)
         }
     }
 }
 
-func RandomizeWeights(config *NetworkConfig, mutationRate int) {
+func RandomizeWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
 
     for _, layer := range config.Layers.Hidden {
-        for neuronID, neuron := range layer.Neurons {
-            for connID := range neuron.Connections {
-                if rand.Intn(100) < mutationRate {
-                    neuron.Connections[connID] = Connection{Weight: rand.NormFloat64()}
+        for _, neuronID := range sortedKeys(layer.Neurons) {
+            neuron := layer.Neurons[neuronID]
+            for _, connID := range sortedKeys(neuron.Connections) {
+                if rng.Intn(100) < mutationRate {
+                    neuron.Connections[connID] = Connection{Weight: rng.NormFloat64()}
                    //  fmt.Printf("Randomized weight of connection %s for neuron %s\n", connID, neuronID)
                 }
             }
@@ -1029,10 +974,11 @@ func RandomizeWeights(config *NetworkConfig, mutationRate int) {
         }
     }
 
-    for neuronID, neuron := range config.Layers.Output.Neurons {
-        for connID := range neuron.Connections {
-            if rand.Intn(100) < mutationRate {
-                neuron.Connections[connID] = Connection{Weight: rand.NormFloat64()}
+    for _, neuronID := range sortedKeys(config.Layers.Output.Neurons) {
+        neuron := config.Layers.Output.Neurons[neuronID]
+        for _, connID := range sortedKeys(neuron.Connections) {
+            if rng.Intn(100) < mutationRate {
+                neuron.Connections[connID] = Connection{Weight: rng.NormFloat64()}
                //  fmt.Printf("Randomized weight of connection %s for output neuron %s\n", connID, neuronID)
             }
         }
@@ -1041,19 +987,20 @@ func RandomizeWeights(config *NetworkConfig, mutationRate int) {
 }
 
 
-func SplitNeuron(config *NetworkConfig, mutationRate int) {
+func SplitNeuron(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if len(config.Layers.Hidden) == 0 || mutationRate <= 0 {
         return
     }
     for layerIdx := range config.Layers.Hidden {
-        if rand.Intn(100) < mutationRate {
-            for neuronID, neuron := range config.Layers.Hidden[layerIdx].Neurons {
+        if rng.Intn(100) < mutationRate {
+            for _, neuronID := range sortedKeys(config.Layers.Hidden[layerIdx].Neurons) {
+                neuron := config.Layers.Hidden[layerIdx].Neurons[neuronID]
                 // Create two new neurons with a split of the connections
                 newNeuron1 := neuron
                 newNeuron2 := neuron
                 halfConnections := len(neuron.Connections) / 2
 
-                for connID := range neuron.Connections {
+                for _, connID := range sortedKeys(neuron.Connections) {
                     if halfConnections > 0 {
                         delete(newNeuron2.Connections, connID)
                         halfConnections--
@@ -1078,11 +1025,11 @@ func SplitNeuron(config *NetworkConfig, mutationRate int) {
 
 
 
-func SwapLayerActivations(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate && len(config.Layers.Hidden) > 1 {
+func SwapLayerActivations(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate && len(config.Layers.Hidden) > 1 {
         // Randomly select two layers to swap activations
-        idx1 := rand.Intn(len(config.Layers.Hidden))
-        idx2 := rand.Intn(len(config.Layers.Hidden))
+        idx1 := rng.Intn(len(config.Layers.Hidden))
+        idx2 := rng.Intn(len(config.Layers.Hidden))
         
         if idx1 != idx2 {
             layer1 := config.Layers.Hidden[idx1]
@@ -1110,15 +1057,12 @@ func SwapLayerActivations(config *NetworkConfig, mutationRate int) {
 
 
 
-func ShuffleLayerConnections(config *NetworkConfig, mutationRate int) {
+func ShuffleLayerConnections(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     //for layerIdx, layer := range config.Layers.Hidden {
     for _, layer := range config.Layers.Hidden {
-        if rand.Intn(100) < mutationRate {
-            neuronIDs := make([]string, 0, len(layer.Neurons))
-            for neuronID := range layer.Neurons {
-                neuronIDs = append(neuronIDs, neuronID)
-            }
-            rand.Shuffle(len(neuronIDs), func(i, j int) { neuronIDs[i], neuronIDs[j] = neuronIDs[j], neuronIDs[i] })
+        if rng.Intn(100) < mutationRate {
+            neuronIDs := sortedKeys(layer.Neurons)
+            rng.Shuffle(len(neuronIDs), func(i, j int) { neuronIDs[i], neuronIDs[j] = neuronIDs[j], neuronIDs[i] })
             
             // Shuffle the connections by copying and reassigning modified neurons
             for i, neuronID := range neuronIDs {
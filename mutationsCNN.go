@@ -5,14 +5,14 @@ import (
 )
 
 
-func MutateCNNWeights(config *NetworkConfig, learningRate float64, mutationRate int) {
+func MutateCNNWeights(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "conv" {
             for i := range layer.Filters {
-                if rand.Intn(100) < mutationRate {
+                if rng.Intn(100) < mutationRate {
                     for j := range layer.Filters[i].Weights {
                         for k := range layer.Filters[i].Weights[j] {
-                            layer.Filters[i].Weights[j][k] += rand.NormFloat64() * learningRate
+                            layer.Filters[i].Weights[j][k] += rng.NormFloat64() * learningRate
                         }
                     }
                 }
@@ -21,43 +21,43 @@ func MutateCNNWeights(config *NetworkConfig, learningRate float64, mutationRate
     }
 }
 
-func MutateCNNBiases(config *NetworkConfig, mutationRate int, learningRate float64) {
+func MutateCNNBiases(config *NetworkConfig, mutationRate int, learningRate float64, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "conv" {
             for i := range layer.Filters {
-                if rand.Intn(100) < mutationRate {
-                    layer.Filters[i].Bias += rand.NormFloat64() * learningRate
+                if rng.Intn(100) < mutationRate {
+                    layer.Filters[i].Bias += rng.NormFloat64() * learningRate
                 }
             }
         }
     }
 }
 
-func RandomizeCNNWeights(config *NetworkConfig, mutationRate int) {
+func RandomizeCNNWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "conv" {
             for i := range layer.Filters {
-                if rand.Intn(100) < mutationRate {
-                    layer.Filters[i].Weights = Random2DSlice(len(layer.Filters[i].Weights), len(layer.Filters[i].Weights[0]))
+                if rng.Intn(100) < mutationRate {
+                    layer.Filters[i].Weights = Random2DSlice(len(layer.Filters[i].Weights), len(layer.Filters[i].Weights[0]), rng)
                 }
             }
         }
     }
 }
 
-func Random2DSlice(rows, cols int) [][]float64 {
+func Random2DSlice(rows, cols int, rng *rand.Rand) [][]float64 {
     slice := make([][]float64, rows)
     for i := range slice {
-        slice[i] = RandomSlice(cols)
+        slice[i] = RandomSlice(cols, rng)
     }
     return slice
 }
 
-func InvertCNNWeights(config *NetworkConfig, mutationRate int) {
+func InvertCNNWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "conv" {
             for i := range layer.Filters {
-                if rand.Intn(100) < mutationRate {
+                if rng.Intn(100) < mutationRate {
                     for j := range layer.Filters[i].Weights {
                         for k := range layer.Filters[i].Weights[j] {
                             layer.Filters[i].Weights[j][k] = -layer.Filters[i].Weights[j][k]
@@ -70,21 +70,21 @@ func InvertCNNWeights(config *NetworkConfig, mutationRate int) {
 }
 
 // AddCNNLayerAtRandomPosition adds a new CNN layer with a random filter size at a random position.
-func AddCNNLayerAtRandomPosition(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func AddCNNLayerAtRandomPosition(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         // Define possible filter sizes (e.g., 3x3, 5x5, 7x7, etc.)
         //filterSizes := []int{3, 5, 7, 11, 13}
 
         // Randomly select a filter size from the list
-        //randomFilterSize := filterSizes[rand.Intn(len(filterSizes))]
-        randomFilterSize := 3 + rand.Intn(1022)
+        //randomFilterSize := filterSizes[rng.Intn(len(filterSizes))]
+        randomFilterSize := 3 + rng.Intn(1022)
 
         newLayer := Layer{
             LayerType: "conv",
             Filters: []Filter{
                 {
-                    Weights: Random2DSlice(randomFilterSize, randomFilterSize),
-                    Bias:    rand.Float64(),
+                    Weights: Random2DSlice(randomFilterSize, randomFilterSize, rng),
+                    Bias:    rng.Float64(),
                 },
             },
             Stride:  1,
@@ -92,7 +92,7 @@ func AddCNNLayerAtRandomPosition(config *NetworkConfig, mutationRate int) {
         }
 
         // Insert at a random position in the hidden layers
-        pos := rand.Intn(len(config.Layers.Hidden) + 1)
+        pos := rng.Intn(len(config.Layers.Hidden) + 1)
         config.Layers.Hidden = append(config.Layers.Hidden[:pos], append([]Layer{newLayer}, config.Layers.Hidden[pos:]...)...)
 
         //fmt.Printf("Added CNN layer with %dx%d filters at position %d.\n", randomFilterSize, randomFilterSize, pos)
@@ -102,13 +102,13 @@ func AddCNNLayerAtRandomPosition(config *NetworkConfig, mutationRate int) {
 
 
 // MutateCNNFilterSize mutates the size of convolution filters.
-func MutateCNNFilterSize(config *NetworkConfig, mutationRate int) {
+func MutateCNNFilterSize(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "conv" {
             for i := range layer.Filters {
-                if rand.Intn(100) < mutationRate {
-                    newSize := rand.Intn(3) + 3 // Random size between 3 and 5
-                    layer.Filters[i].Weights = Random2DSlice(newSize, newSize)
+                if rng.Intn(100) < mutationRate {
+                    newSize := rng.Intn(3) + 3 // Random size between 3 and 5
+                    layer.Filters[i].Weights = Random2DSlice(newSize, newSize, rng)
                 }
             }
         }
@@ -116,19 +116,19 @@ func MutateCNNFilterSize(config *NetworkConfig, mutationRate int) {
 }
 
 // MutateCNNStrideAndPadding mutates the stride and padding values of CNN layers.
-func MutateCNNStrideAndPadding(config *NetworkConfig, mutationRate int) {
+func MutateCNNStrideAndPadding(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
-        if layer.LayerType == "conv" && rand.Intn(100) < mutationRate {
-            layer.Stride = rand.Intn(3) + 1  // Random stride between 1 and 3
-            layer.Padding = rand.Intn(2)     // Random padding between 0 and 1
+        if layer.LayerType == "conv" && rng.Intn(100) < mutationRate {
+            layer.Stride = rng.Intn(3) + 1  // Random stride between 1 and 3
+            layer.Padding = rng.Intn(2)     // Random padding between 0 and 1
         }
     }
 }
 
 // DuplicateCNNLayer duplicates a random convolutional layer.
-func DuplicateCNNLayer(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate && len(config.Layers.Hidden) > 0 {
-        pos := rand.Intn(len(config.Layers.Hidden))
+func DuplicateCNNLayer(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate && len(config.Layers.Hidden) > 0 {
+        pos := rng.Intn(len(config.Layers.Hidden))
         layerToDuplicate := config.Layers.Hidden[pos]
         newLayer := layerToDuplicate // Shallow copy of the layer
 
@@ -139,27 +139,27 @@ func DuplicateCNNLayer(config *NetworkConfig, mutationRate int) {
 
 
 // AddMultipleCNNLayers adds a random number of new convolutional layers with random filter size, stride, and padding.
-func AddMultipleCNNLayers(config *NetworkConfig, mutationRate int, maxLayers int) {
-    if rand.Intn(100) < mutationRate {
+func AddMultipleCNNLayers(config *NetworkConfig, mutationRate int, maxLayers int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         // Randomize the number of layers to add, between 1 and maxLayers
-        numLayers := rand.Intn(maxLayers) + 1 
+        numLayers := rng.Intn(maxLayers) + 1 
 
         // Possible filter sizes to choose from
         //filterSizes := []int{3, 5, 7, 11, 13}
         
         for i := 0; i < numLayers; i++ {
-            randomFilterSize := 3 + rand.Intn(1022)
+            randomFilterSize := 3 + rng.Intn(1022)
             // Randomize filter size, stride, and padding for each layer
-            //randomFilterSize := filterSizes[rand.Intn(len(filterSizes))]
-            randomStride := rand.Intn(3) + 1   // Random stride between 1 and 3
-            randomPadding := rand.Intn(2)      // Random padding between 0 and 1
+            //randomFilterSize := filterSizes[rng.Intn(len(filterSizes))]
+            randomStride := rng.Intn(3) + 1   // Random stride between 1 and 3
+            randomPadding := rng.Intn(2)      // Random padding between 0 and 1
 
             newLayer := Layer{
                 LayerType: "conv",
                 Filters: []Filter{
                     {
-                        Weights: Random2DSlice(randomFilterSize, randomFilterSize),
-                        Bias:    rand.Float64(),
+                        Weights: Random2DSlice(randomFilterSize, randomFilterSize, rng),
+                        Bias:    rng.Float64(),
                     },
                 },
                 Stride:  randomStride,
@@ -167,7 +167,7 @@ func AddMultipleCNNLayers(config *NetworkConfig, mutationRate int, maxLayers int
             }
 
             // Insert the new layer at a random position
-            pos := rand.Intn(len(config.Layers.Hidden) + 1)
+            pos := rng.Intn(len(config.Layers.Hidden) + 1)
             config.Layers.Hidden = append(config.Layers.Hidden[:pos], append([]Layer{newLayer}, config.Layers.Hidden[pos:]...)...)
 
             //fmt.Printf("Added CNN layer with %dx%d filters, stride %d, padding %d at position %d.\n", randomFilterSize, randomFilterSize, randomStride, randomPadding, pos)
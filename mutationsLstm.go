@@ -3,22 +3,22 @@ package dense
 import "math/rand"
 
 
-func MutateLSTMWeights(config *NetworkConfig, learningRate float64, mutationRate int) {
+func MutateLSTMWeights(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "lstm" {
             for i := range layer.LSTMCells {
-                if rand.Intn(100) < mutationRate {
+                if rng.Intn(100) < mutationRate {
                     for j := range layer.LSTMCells[i].InputWeights {
-                        layer.LSTMCells[i].InputWeights[j] += rand.NormFloat64() * learningRate
+                        layer.LSTMCells[i].InputWeights[j] += rng.NormFloat64() * learningRate
                     }
                     for j := range layer.LSTMCells[i].ForgetWeights {
-                        layer.LSTMCells[i].ForgetWeights[j] += rand.NormFloat64() * learningRate
+                        layer.LSTMCells[i].ForgetWeights[j] += rng.NormFloat64() * learningRate
                     }
                     for j := range layer.LSTMCells[i].OutputWeights {
-                        layer.LSTMCells[i].OutputWeights[j] += rand.NormFloat64() * learningRate
+                        layer.LSTMCells[i].OutputWeights[j] += rng.NormFloat64() * learningRate
                     }
                     for j := range layer.LSTMCells[i].CellWeights {
-                        layer.LSTMCells[i].CellWeights[j] += rand.NormFloat64() * learningRate
+                        layer.LSTMCells[i].CellWeights[j] += rng.NormFloat64() * learningRate
                     }
                 }
             }
@@ -26,12 +26,12 @@ func MutateLSTMWeights(config *NetworkConfig, learningRate float64, mutationRate
     }
 }
 
-func MutateLSTMBiases(config *NetworkConfig, mutationRate int, learningRate float64) {
+func MutateLSTMBiases(config *NetworkConfig, mutationRate int, learningRate float64, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "lstm" {
             for i := range layer.LSTMCells {
-                if rand.Intn(100) < mutationRate {
-                    layer.LSTMCells[i].Bias += rand.NormFloat64() * learningRate
+                if rng.Intn(100) < mutationRate {
+                    layer.LSTMCells[i].Bias += rng.NormFloat64() * learningRate
                 }
             }
         }
@@ -39,26 +39,26 @@ func MutateLSTMBiases(config *NetworkConfig, mutationRate int, learningRate floa
 }
 
 
-func RandomizeLSTMWeights(config *NetworkConfig, mutationRate int) {
+func RandomizeLSTMWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "lstm" {
             for i := range layer.LSTMCells {
-                if rand.Intn(100) < mutationRate {
-                    layer.LSTMCells[i].InputWeights = RandomSlice(len(layer.LSTMCells[i].InputWeights))
-                    layer.LSTMCells[i].ForgetWeights = RandomSlice(len(layer.LSTMCells[i].ForgetWeights))
-                    layer.LSTMCells[i].OutputWeights = RandomSlice(len(layer.LSTMCells[i].OutputWeights))
-                    layer.LSTMCells[i].CellWeights = RandomSlice(len(layer.LSTMCells[i].CellWeights))
+                if rng.Intn(100) < mutationRate {
+                    layer.LSTMCells[i].InputWeights = RandomSlice(len(layer.LSTMCells[i].InputWeights), rng)
+                    layer.LSTMCells[i].ForgetWeights = RandomSlice(len(layer.LSTMCells[i].ForgetWeights), rng)
+                    layer.LSTMCells[i].OutputWeights = RandomSlice(len(layer.LSTMCells[i].OutputWeights), rng)
+                    layer.LSTMCells[i].CellWeights = RandomSlice(len(layer.LSTMCells[i].CellWeights), rng)
                 }
             }
         }
     }
 }
 
-func InvertLSTMWeights(config *NetworkConfig, mutationRate int) {
+func InvertLSTMWeights(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     for _, layer := range config.Layers.Hidden {
         if layer.LayerType == "lstm" {
             for i := range layer.LSTMCells {
-                if rand.Intn(100) < mutationRate {
+                if rng.Intn(100) < mutationRate {
                     for j := range layer.LSTMCells[i].InputWeights {
                         layer.LSTMCells[i].InputWeights[j] = -layer.LSTMCells[i].InputWeights[j]
                     }
@@ -77,30 +77,30 @@ func InvertLSTMWeights(config *NetworkConfig, mutationRate int) {
     }
 }
 
-func AddLSTMLayerAtRandomPosition(config *NetworkConfig, mutationRate int) {
-    if rand.Intn(100) < mutationRate {
+func AddLSTMLayerAtRandomPosition(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+    if rng.Intn(100) < mutationRate {
         newLayer := Layer{
             LayerType: "lstm",
             LSTMCells: []LSTMCell{
                 {
-                    InputWeights:  RandomSlice(10),
-                    ForgetWeights: RandomSlice(10),
-                    OutputWeights: RandomSlice(10),
-                    CellWeights:   RandomSlice(10),
-                    Bias:          rand.Float64(),
+                    InputWeights:  RandomSlice(10, rng),
+                    ForgetWeights: RandomSlice(10, rng),
+                    OutputWeights: RandomSlice(10, rng),
+                    CellWeights:   RandomSlice(10, rng),
+                    Bias:          rng.Float64(),
                 },
             },
         }
 
         // Insert at a random position
-        pos := rand.Intn(len(config.Layers.Hidden) + 1)
+        pos := rng.Intn(len(config.Layers.Hidden) + 1)
         config.Layers.Hidden = append(config.Layers.Hidden[:pos], append([]Layer{newLayer}, config.Layers.Hidden[pos:]...)...)
     }
 }
 
 
 // MutateLSTMCells mutates the weights and biases of LSTM cells based on the mutation rate
-func MutateLSTMCells(config *NetworkConfig, mutationRate int) {
+func MutateLSTMCells(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
     if mutationRate <= 0 {
         return
     }
@@ -113,29 +113,29 @@ func MutateLSTMCells(config *NetworkConfig, mutationRate int) {
             for i, cell := range layer.LSTMCells {
                 // Mutate the input, forget, output, and cell weights
                 for j := range cell.InputWeights {
-                    if rand.Intn(100) < mutationRate {
-                        cell.InputWeights[j] += rand.NormFloat64()
+                    if rng.Intn(100) < mutationRate {
+                        cell.InputWeights[j] += rng.NormFloat64()
                     }
                 }
                 for j := range cell.ForgetWeights {
-                    if rand.Intn(100) < mutationRate {
-                        cell.ForgetWeights[j] += rand.NormFloat64()
+                    if rng.Intn(100) < mutationRate {
+                        cell.ForgetWeights[j] += rng.NormFloat64()
                     }
                 }
                 for j := range cell.OutputWeights {
-                    if rand.Intn(100) < mutationRate {
-                        cell.OutputWeights[j] += rand.NormFloat64()
+                    if rng.Intn(100) < mutationRate {
+                        cell.OutputWeights[j] += rng.NormFloat64()
                     }
                 }
                 for j := range cell.CellWeights {
-                    if rand.Intn(100) < mutationRate {
-                        cell.CellWeights[j] += rand.NormFloat64()
+                    if rng.Intn(100) < mutationRate {
+                        cell.CellWeights[j] += rng.NormFloat64()
                     }
                 }
                 
                 // Mutate the biases
-                if rand.Intn(100) < mutationRate {
-                    cell.Bias += rand.NormFloat64()
+                if rng.Intn(100) < mutationRate {
+                    cell.Bias += rng.NormFloat64()
                 }
 
                 // Update the mutated LSTM cell in the layer
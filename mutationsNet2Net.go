@@ -0,0 +1,142 @@
+package dense
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Net2Net style growth: the network gets wider or deeper while computing exactly the same outputs,
+// so a trained model can keep growing without losing what it has learned.
+
+// Net2Wider copies a neuron of dense hidden layer layerIdx and splits every outgoing weight between the
+// original and the copy, so the next layer sees the same sum. The split ratio is drawn from rng so the
+// two neurons can drift apart under later mutations. It returns the ID of the new neuron.
+func Net2Wider(config *NetworkConfig, layerIdx int, neuronID string, rng *rand.Rand) (string, error) {
+	if layerIdx < 0 || layerIdx >= len(config.Layers.Hidden) {
+		return "", fmt.Errorf("hidden layer %d does not exist", layerIdx)
+	}
+	layer := config.Layers.Hidden[layerIdx]
+	if layer.LayerType != "dense" {
+		return "", fmt.Errorf("hidden layer %d is %q, only dense layers can be widened", layerIdx, layer.LayerType)
+	}
+	source, ok := layer.Neurons[neuronID]
+	if !ok {
+		return "", fmt.Errorf("neuron %s not found in hidden layer %d", neuronID, layerIdx)
+	}
+	consumer := nextTypedLayer(config, layerIdx)
+	if consumer == nil || consumer.LayerType != "dense" {
+		return "", fmt.Errorf("hidden layer %d does not feed a dense layer", layerIdx)
+	}
+
+	newID := uniqueNeuronID(layer.Neurons, neuronID+"_w")
+	copied := Neuron{ActivationType: source.ActivationType, Bias: source.Bias, Connections: make(map[string]Connection, len(source.Connections))}
+	for inputID, conn := range source.Connections {
+		copied.Connections[inputID] = conn
+	}
+	layer.Neurons[newID] = copied
+
+	ratio := 0.25 + 0.5*rng.Float64()
+	for _, id := range sortedKeys(consumer.Neurons) {
+		neuron := consumer.Neurons[id]
+		conn, ok := neuron.Connections[neuronID]
+		if !ok {
+			continue
+		}
+		neuron.Connections[neuronID] = Connection{Weight: conn.Weight * ratio}
+		neuron.Connections[newID] = Connection{Weight: conn.Weight * (1 - ratio)}
+		consumer.Neurons[id] = neuron
+	}
+	return newID, nil
+}
+
+// Net2Deeper inserts an identity dense layer at hidden position position. Each new neuron passes one
+// value of the preceding layer through with weight 1, no bias and a linear activation, and keeps that
+// value's key, so the layer after it is unchanged. The preceding layer must be dense (or the dense input).
+func Net2Deeper(config *NetworkConfig, position int) error {
+	if position < 0 || position > len(config.Layers.Hidden) {
+		return fmt.Errorf("cannot insert a layer at position %d of %d hidden layers", position, len(config.Layers.Hidden))
+	}
+	producer := previousTypedLayer(config, position)
+	if producer == nil || producer.LayerType != "dense" || len(producer.Neurons) == 0 {
+		return fmt.Errorf("the layer before position %d is not a dense layer", position)
+	}
+
+	identity := Layer{LayerType: "dense", Neurons: make(map[string]Neuron, len(producer.Neurons))}
+	for id := range producer.Neurons {
+		identity.Neurons[id] = Neuron{
+			ActivationType: "linear",
+			Connections:    map[string]Connection{id: {Weight: 1}},
+		}
+	}
+
+	hidden := make([]Layer, 0, len(config.Layers.Hidden)+1)
+	hidden = append(hidden, config.Layers.Hidden[:position]...)
+	hidden = append(hidden, identity)
+	hidden = append(hidden, config.Layers.Hidden[position:]...)
+	config.Layers.Hidden = hidden
+	return nil
+}
+
+// Net2WiderNeurons widens each dense hidden layer with probability mutationRate% by copying one of its
+// neurons, keeping the outputs unchanged.
+func Net2WiderNeurons(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+	for layerIdx, layer := range config.Layers.Hidden {
+		if layer.LayerType != "dense" || len(layer.Neurons) == 0 || rng.Intn(100) >= mutationRate {
+			continue
+		}
+		neuronIDs := sortedKeys(layer.Neurons)
+		Net2Wider(config, layerIdx, neuronIDs[rng.Intn(len(neuronIDs))], rng)
+	}
+}
+
+// Net2DeeperLayer inserts an identity layer at a random valid position with probability mutationRate%.
+func Net2DeeperLayer(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+	if rng.Intn(100) >= mutationRate {
+		return
+	}
+	var positions []int
+	for position := 0; position <= len(config.Layers.Hidden); position++ {
+		if producer := previousTypedLayer(config, position); producer != nil && producer.LayerType == "dense" && len(producer.Neurons) > 0 {
+			positions = append(positions, position)
+		}
+	}
+	if len(positions) == 0 {
+		return
+	}
+	Net2Deeper(config, positions[rng.Intn(len(positions))])
+}
+
+// nextTypedLayer returns the layer that consumes the output of hidden layer layerIdx. Untyped layers
+// pass data through in Feedforward, so they are skipped.
+func nextTypedLayer(config *NetworkConfig, layerIdx int) *Layer {
+	for i := layerIdx + 1; i < len(config.Layers.Hidden); i++ {
+		if config.Layers.Hidden[i].LayerType != "" {
+			return &config.Layers.Hidden[i]
+		}
+	}
+	if config.Layers.Output.LayerType == "" {
+		return nil
+	}
+	return &config.Layers.Output
+}
+
+// previousTypedLayer returns the layer whose output arrives at hidden position position, skipping
+// untyped layers; the input layer if there is none.
+func previousTypedLayer(config *NetworkConfig, position int) *Layer {
+	for i := position - 1; i >= 0; i-- {
+		if config.Layers.Hidden[i].LayerType != "" {
+			return &config.Layers.Hidden[i]
+		}
+	}
+	return &config.Layers.Input
+}
+
+// uniqueNeuronID returns base followed by the first number not yet used in the layer.
+func uniqueNeuronID(neurons map[string]Neuron, base string) string {
+	for i := 1; ; i++ {
+		id := fmt.Sprintf("%s%d", base, i)
+		if _, exists := neurons[id]; !exists {
+			return id
+		}
+	}
+}
@@ -12,6 +12,7 @@ func CreateSimpleNeuralNetworkWithParams(
 	outputActivationTypes []string,
 	modelID string,
 	projectName string,
+	rng *rand.Rand,
 ) *NetworkConfig {
 	// Initialize the metadata
 	network := &NetworkConfig{
@@ -38,13 +39,13 @@ func CreateSimpleNeuralNetworkWithParams(
 		newNeuron := Neuron{
 			ActivationType: "relu", // Using ReLU for hidden layer
 			Connections:    make(map[string]Connection),
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 		}
 
 		// Connect input neurons to hidden neurons
 		for j := 0; j < numInputs; j++ {
 			inputID := "input" + strconv.Itoa(j)
-			newNeuron.Connections[inputID] = Connection{Weight: rand.Float64()}
+			newNeuron.Connections[inputID] = Connection{Weight: rng.Float64()}
 		}
 
 		hiddenLayer.Neurons[neuronID] = newNeuron
@@ -65,13 +66,13 @@ func CreateSimpleNeuralNetworkWithParams(
 		outputNeuron := Neuron{
 			ActivationType: activationType, // Custom or default activation for output
 			Connections:    make(map[string]Connection),
-			Bias:           rand.Float64(),
+			Bias:           rng.Float64(),
 		}
 
 		// Connect hidden neurons to output neurons
 		for j := 0; j < numHiddenNeurons; j++ {
 			hiddenID := "hidden" + strconv.Itoa(j)
-			outputNeuron.Connections[hiddenID] = Connection{Weight: rand.Float64()}
+			outputNeuron.Connections[hiddenID] = Connection{Weight: rng.Float64()}
 		}
 
 		network.Layers.Output.Neurons[neuronID] = outputNeuron
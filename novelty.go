@@ -0,0 +1,195 @@
+package dense
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// NoveltyArchive keeps the behaviour descriptors of models that were novel when they were seen,
+// so later generations are rewarded for behaving differently from everything found so far.
+type NoveltyArchive struct {
+	Entries   []NoveltyEntry `json:"entries"`
+	K         int            `json:"k"`         // Nearest neighbours averaged into the novelty score
+	Threshold float64        `json:"threshold"` // Novelty a model needs to enter the archive
+	MaxSize   int            `json:"maxSize"`   // Oldest entries are dropped beyond this, 0 for unbounded
+}
+
+// NoveltyEntry is one archived behaviour descriptor.
+type NoveltyEntry struct {
+	ModelID    string    `json:"modelID"`
+	Descriptor []float64 `json:"descriptor"`
+}
+
+// NewNoveltyArchive returns an empty archive with the given settings.
+func NewNoveltyArchive(k int, threshold float64, maxSize int) *NoveltyArchive {
+	return &NoveltyArchive{K: k, Threshold: threshold, MaxSize: maxSize}
+}
+
+// BehaviorDescriptor runs the model on a fixed probe set and concatenates its outputs, in output key
+// order, into one vector. Models compared against each other must be given the same probes.
+func BehaviorDescriptor(config *NetworkConfig, probes []map[string]interface{}) []float64 {
+	outputKeys := sortedKeys(config.Layers.Output.Neurons)
+	descriptor := make([]float64, 0, len(probes)*len(outputKeys))
+	for _, probe := range probes {
+		outputs := Feedforward(config, probe)
+		for _, key := range outputKeys {
+			value := outputs[key]
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				value = 0
+			}
+			descriptor = append(descriptor, value)
+		}
+	}
+	return descriptor
+}
+
+// descriptorDistance is the Euclidean distance between two descriptors. Missing values in the
+// shorter one count as 0, so models with a different number of outputs can still be compared.
+func descriptorDistance(a, b []float64) float64 {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	sum := 0.0
+	for i := range a {
+		diff := a[i]
+		if i < len(b) {
+			diff -= b[i]
+		}
+		sum += diff * diff
+	}
+	return math.Sqrt(sum)
+}
+
+// Novelty is the mean distance from descriptor to its K nearest neighbours among the archive and
+// the given population descriptors. self is the index of descriptor in population, or -1.
+func (a *NoveltyArchive) Novelty(descriptor []float64, population [][]float64, self int) float64 {
+	var distances []float64
+	for _, entry := range a.Entries {
+		distances = append(distances, descriptorDistance(descriptor, entry.Descriptor))
+	}
+	for i, other := range population {
+		if i != self {
+			distances = append(distances, descriptorDistance(descriptor, other))
+		}
+	}
+	if len(distances) == 0 {
+		return 0
+	}
+
+	sort.Float64s(distances)
+	k := a.K
+	if k <= 0 || k > len(distances) {
+		k = len(distances)
+	}
+	sum := 0.0
+	for _, d := range distances[:k] {
+		sum += d
+	}
+	return sum / float64(k)
+}
+
+// Add appends a descriptor to the archive, dropping the oldest entries beyond MaxSize.
+func (a *NoveltyArchive) Add(modelID string, descriptor []float64) {
+	a.Entries = append(a.Entries, NoveltyEntry{ModelID: modelID, Descriptor: descriptor})
+	if a.MaxSize > 0 && len(a.Entries) > a.MaxSize {
+		a.Entries = a.Entries[len(a.Entries)-a.MaxSize:]
+	}
+}
+
+// ScoreNovelty measures the novelty of every model against the archive and the rest of the population,
+// then sets Objectives.Novelty and Objectives.Fitness, a blend of novelty (normalized to the most novel
+// model) and accuracy: weight 1 is pure novelty search, weight 0 is pure accuracy.
+// Models whose novelty beats the archive threshold are archived. The threshold is lowered when nobody
+// gets in and raised when many do, so the archive keeps growing at a steady pace. A threshold of 0 starts
+// at the population's mean novelty.
+func ScoreNovelty(models []*NetworkConfig, probes []map[string]interface{}, archive *NoveltyArchive, weight float64) {
+	descriptors := make([][]float64, len(models))
+	for i, model := range models {
+		descriptors[i] = BehaviorDescriptor(model, probes)
+	}
+
+	novelty := make([]float64, len(models))
+	maxNovelty := 0.0
+	for i := range models {
+		novelty[i] = archive.Novelty(descriptors[i], descriptors, i)
+		maxNovelty = math.Max(maxNovelty, novelty[i])
+	}
+	if archive.Threshold <= 0 && len(models) > 0 {
+		// Start from the population's mean novelty when no threshold was given
+		for _, n := range novelty {
+			archive.Threshold += n / float64(len(models))
+		}
+	}
+
+	added := 0
+	for i, model := range models {
+		if model.Metadata.Objectives == nil {
+			MeasureObjectives(model, nil)
+		}
+		normalized := 0.0
+		if maxNovelty > 0 {
+			normalized = novelty[i] / maxNovelty
+		}
+		objectives := model.Metadata.Objectives
+		objectives.Novelty = novelty[i]
+		objectives.Fitness = weight*normalized + (1-weight)*model.Metadata.LastTestAccuracy
+
+		if novelty[i] > archive.Threshold || len(archive.Entries) == 0 {
+			archive.Add(model.Metadata.ModelID, descriptors[i])
+			added++
+		}
+	}
+
+	switch {
+	case added == 0:
+		archive.Threshold *= 0.95
+	case added > len(models)/2:
+		archive.Threshold *= 1.2
+	}
+}
+
+// SelectByFitness keeps the n models with the highest Objectives.Fitness, as set by ScoreNovelty.
+// Models that were never scored rank by accuracy alone.
+func SelectByFitness(models []*NetworkConfig, n int) []*NetworkConfig {
+	fitness := func(model *NetworkConfig) float64 {
+		if model.Metadata.Objectives == nil || (model.Metadata.Objectives.Fitness == 0 && model.Metadata.Objectives.Novelty == 0) {
+			return model.Metadata.LastTestAccuracy
+		}
+		return model.Metadata.Objectives.Fitness
+	}
+
+	sorted := append([]*NetworkConfig(nil), models...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return fitness(sorted[i]) > fitness(sorted[j])
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// LoadNoveltyArchive reads an archive from a JSON file.
+func LoadNoveltyArchive(filePath string) (*NoveltyArchive, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read novelty archive: %w", err)
+	}
+
+	var archive NoveltyArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("failed to decode novelty archive: %w", err)
+	}
+	return &archive, nil
+}
+
+// SaveNoveltyArchive writes the archive to a JSON file.
+func SaveNoveltyArchive(filePath string, archive *NoveltyArchive) error {
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode novelty archive: %w", err)
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
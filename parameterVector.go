@@ -0,0 +1,80 @@
+package dense
+
+import "fmt"
+
+// FlattenParameters collects every weight and bias of the hidden and output layers into one vector.
+// Neurons and connections are visited in sorted key order, so the layout is the same for every
+// model with the same topology and SetParameters can write the vector back.
+func FlattenParameters(config *NetworkConfig) []float64 {
+	var params []float64
+	visitParameters(config, false, func(value *float64) {
+		params = append(params, *value)
+	})
+	return params
+}
+
+// SetParameters writes a vector produced by FlattenParameters back into the model.
+func SetParameters(config *NetworkConfig, params []float64) error {
+	if count := countVectorParameters(config); count != len(params) {
+		return fmt.Errorf("parameter vector has %d values but the model has %d", len(params), count)
+	}
+	i := 0
+	visitParameters(config, true, func(value *float64) {
+		*value = params[i]
+		i++
+	})
+	return nil
+}
+
+// countVectorParameters is the length of the vector FlattenParameters returns.
+func countVectorParameters(config *NetworkConfig) int {
+	count := 0
+	visitParameters(config, false, func(*float64) { count++ })
+	return count
+}
+
+// visitParameters calls visit with a pointer to every parameter in flattening order. Neurons are
+// stored by value in maps, so with write set they are updated through a copy that is written back;
+// without it the maps are left alone, so models can be read concurrently.
+func visitParameters(config *NetworkConfig, write bool, visit func(value *float64)) {
+	layers := make([]*Layer, 0, len(config.Layers.Hidden)+1)
+	for i := range config.Layers.Hidden {
+		layers = append(layers, &config.Layers.Hidden[i])
+	}
+	layers = append(layers, &config.Layers.Output)
+
+	for _, layer := range layers {
+		for _, neuronID := range sortedKeys(layer.Neurons) {
+			neuron := layer.Neurons[neuronID]
+			for _, connID := range sortedKeys(neuron.Connections) {
+				conn := neuron.Connections[connID]
+				visit(&conn.Weight)
+				if write {
+					neuron.Connections[connID] = conn
+				}
+			}
+			visit(&neuron.Bias)
+			if write {
+				layer.Neurons[neuronID] = neuron
+			}
+		}
+		for f := range layer.Filters {
+			filter := &layer.Filters[f]
+			for _, row := range filter.Weights {
+				for k := range row {
+					visit(&row[k])
+				}
+			}
+			visit(&filter.Bias)
+		}
+		for c := range layer.LSTMCells {
+			cell := &layer.LSTMCells[c]
+			for _, weights := range [][]float64{cell.InputWeights, cell.ForgetWeights, cell.OutputWeights, cell.CellWeights} {
+				for k := range weights {
+					visit(&weights[k])
+				}
+			}
+			visit(&cell.Bias)
+		}
+	}
+}
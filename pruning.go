@@ -0,0 +1,340 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// PruneOptions configures Prune. A pass is skipped when it has nothing to work with: magnitude pruning
+// needs a threshold, dead neuron and identity layer removal need probes.
+type PruneOptions struct {
+	MagnitudeThreshold float64                  // Connections with a smaller absolute weight are removed
+	Probes             []map[string]interface{} // Inputs the neuron activations are measured on
+	DeadTolerance      float64                  // A neuron whose activation varies less than this over the probes is constant
+	IdentityTolerance  float64                  // A layer whose outputs stay this close to its inputs is removed
+	MaxAccuracyDrop    float64                  // A pass that loses more accuracy than this is rolled back
+	// Evaluate returns the model's accuracy. Without it passes are never rolled back.
+	Evaluate func(config *NetworkConfig) float64
+}
+
+// PrunePass is the outcome of one pruning pass.
+type PrunePass struct {
+	Name           string  `json:"name"`
+	Removed        int     `json:"removed"` // Connections, neurons or layers, depending on the pass
+	AccuracyBefore float64 `json:"accuracyBefore"`
+	AccuracyAfter  float64 `json:"accuracyAfter"`
+	RolledBack     bool    `json:"rolledBack"`
+}
+
+// PruneReport summarizes a Prune run.
+type PruneReport struct {
+	Passes       []PrunePass `json:"passes"`
+	ParamsBefore int         `json:"paramsBefore"`
+	ParamsAfter  int         `json:"paramsAfter"`
+}
+
+// Prune removes small connections, constant neurons and near-identity layers, in that order. Each pass
+// runs on a copy and is only kept if accuracy drops by at most MaxAccuracyDrop. It fails on negative
+// thresholds or probes of different sizes, leaving the model untouched.
+func Prune(config *NetworkConfig, opts PruneOptions) (*PruneReport, error) {
+	if opts.MagnitudeThreshold < 0 || opts.DeadTolerance < 0 || opts.IdentityTolerance < 0 {
+		return nil, fmt.Errorf("pruning thresholds and tolerances must not be negative")
+	}
+	if opts.MaxAccuracyDrop < 0 {
+		return nil, fmt.Errorf("max accuracy drop must not be negative")
+	}
+	for i, probe := range opts.Probes {
+		if len(probe) != len(opts.Probes[0]) {
+			return nil, fmt.Errorf("probe %d has %d inputs but probe 0 has %d", i, len(probe), len(opts.Probes[0]))
+		}
+	}
+	report := &PruneReport{ParamsBefore: CountParameters(config)}
+	accuracy := 0.0
+	if opts.Evaluate != nil {
+		accuracy = opts.Evaluate(config)
+	}
+
+	type pass struct {
+		name    string
+		enabled bool
+		apply   func(config *NetworkConfig) int
+	}
+	passes := []pass{
+		{"magnitude", opts.MagnitudeThreshold > 0, func(c *NetworkConfig) int {
+			return PruneConnections(c, opts.MagnitudeThreshold)
+		}},
+		{"dead neurons", len(opts.Probes) > 0, func(c *NetworkConfig) int {
+			return PruneDeadNeurons(c, opts.Probes, opts.DeadTolerance)
+		}},
+		{"identity layers", len(opts.Probes) > 0, func(c *NetworkConfig) int {
+			return PruneIdentityLayers(c, opts.Probes, opts.IdentityTolerance)
+		}},
+	}
+
+	for _, p := range passes {
+		if !p.enabled {
+			continue
+		}
+		candidate := DeepCopy(config)
+		result := PrunePass{Name: p.name, Removed: p.apply(candidate), AccuracyBefore: accuracy, AccuracyAfter: accuracy}
+		if result.Removed > 0 && opts.Evaluate != nil {
+			result.AccuracyAfter = opts.Evaluate(candidate)
+			result.RolledBack = accuracy-result.AccuracyAfter > opts.MaxAccuracyDrop
+		}
+		if result.Removed > 0 && !result.RolledBack {
+			*config = *candidate
+			accuracy = result.AccuracyAfter
+		}
+		report.Passes = append(report.Passes, result)
+	}
+
+	report.ParamsAfter = CountParameters(config)
+	return report, nil
+}
+
+// NewPruneMutation wraps Prune as a mutation operator, e.g. RegisterMutation("Prune", NewPruneMutation(opts)).
+// The learning rate, mutation rate and random source are not used.
+func NewPruneMutation(opts PruneOptions) MutationFunc {
+	return func(config *NetworkConfig, learningRate float64, mutationRate int, rng *rand.Rand) {
+		if _, err := Prune(config, opts); err != nil {
+			fmt.Printf("Prune mutation skipped: %v\n", err)
+		}
+	}
+}
+
+// PruneConnections removes every dense connection in the hidden and output layers whose absolute
+// weight is below threshold and returns how many were removed.
+func PruneConnections(config *NetworkConfig, threshold float64) int {
+	removed := 0
+	for _, layer := range denseNeuronLayers(config) {
+		for id, neuron := range layer.Neurons {
+			for inputID, conn := range neuron.Connections {
+				if math.Abs(conn.Weight) < threshold {
+					delete(neuron.Connections, inputID)
+					removed++
+				}
+			}
+			layer.Neurons[id] = neuron
+		}
+	}
+	return removed
+}
+
+// PruneWeakConnections is the probe-free pruning mutation: each dense layer, with probability
+// mutationRate%, loses the connections weaker than a tenth of its mean absolute weight. A neuron whose
+// connections are all that weak keeps them. Nothing is evaluated here, so a child that got worse is
+// only dropped by selection; use Prune to roll passes back on accuracy.
+func PruneWeakConnections(config *NetworkConfig, mutationRate int, rng *rand.Rand) {
+	for _, layer := range denseNeuronLayers(config) {
+		if rng.Intn(100) >= mutationRate {
+			continue
+		}
+		sum, count := 0.0, 0
+		for _, neuron := range layer.Neurons {
+			for _, conn := range neuron.Connections {
+				sum += math.Abs(conn.Weight)
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		threshold := 0.1 * sum / float64(count)
+		for id, neuron := range layer.Neurons {
+			kept := 0
+			for _, conn := range neuron.Connections {
+				if math.Abs(conn.Weight) >= threshold {
+					kept++
+				}
+			}
+			if kept == 0 {
+				continue // Leave the neuron alone rather than cut it off from its inputs
+			}
+			for inputID, conn := range neuron.Connections {
+				if math.Abs(conn.Weight) < threshold {
+					delete(neuron.Connections, inputID)
+				}
+			}
+			layer.Neurons[id] = neuron
+		}
+	}
+}
+
+// PruneDeadNeurons removes dense hidden neurons whose activation is constant over the probes, within
+// tolerance. A dead (always zero) neuron is simply dropped; any other constant is folded into the biases
+// of the layer that consumes it, so the outputs stay the same. Every layer keeps at least one neuron.
+// It returns the number of neurons removed.
+func PruneDeadNeurons(config *NetworkConfig, probes []map[string]interface{}, tolerance float64) int {
+	activations := probeActivations(config, probes)
+	removed := 0
+	for i := range config.Layers.Hidden {
+		layer := &config.Layers.Hidden[i]
+		consumer := nextTypedLayer(config, i)
+		if layer.LayerType != "dense" || consumer == nil || consumer.LayerType != "dense" {
+			continue
+		}
+
+		for _, id := range sortedKeys(layer.Neurons) {
+			if len(layer.Neurons) == 1 {
+				break
+			}
+			value, constant := constantActivation(activations, i, id, tolerance)
+			if !constant {
+				continue
+			}
+			for consumerID, neuron := range consumer.Neurons {
+				if conn, ok := neuron.Connections[id]; ok {
+					neuron.Bias += conn.Weight * value
+					delete(neuron.Connections, id)
+					consumer.Neurons[consumerID] = neuron
+				}
+			}
+			delete(layer.Neurons, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// PruneIdentityLayers removes hidden layers that don't change the data: untyped layers, which
+// Feedforward passes through anyway, and dense layers whose outputs match their inputs key for key
+// within tolerance on every probe. It returns the number of layers removed.
+func PruneIdentityLayers(config *NetworkConfig, probes []map[string]interface{}, tolerance float64) int {
+	activations := probeActivations(config, probes)
+	var kept []Layer
+	removed := 0
+	for i, layer := range config.Layers.Hidden {
+		if layer.LayerType == "" || (layer.LayerType == "dense" && isIdentityLayer(activations, i, tolerance)) {
+			removed++
+			continue
+		}
+		kept = append(kept, layer)
+	}
+	config.Layers.Hidden = kept
+	return removed
+}
+
+// isIdentityLayer reports whether hidden layer i reproduces its input on every probe.
+func isIdentityLayer(activations [][]interface{}, i int, tolerance float64) bool {
+	if len(activations) == 0 {
+		return false
+	}
+	for _, probe := range activations {
+		in, inOK := probe[i].(map[string]float64)
+		out, outOK := probe[i+1].(map[string]float64)
+		if !inOK || !outOK || len(in) != len(out) {
+			return false
+		}
+		for key, value := range out {
+			inValue, ok := in[key]
+			if !ok || math.Abs(value-inValue) > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// constantActivation reports whether a neuron of hidden layer i has the same activation on every
+// probe, within tolerance, and returns its mean.
+func constantActivation(activations [][]interface{}, i int, id string, tolerance float64) (float64, bool) {
+	if len(activations) == 0 {
+		return 0, false
+	}
+	low, high, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, probe := range activations {
+		values, ok := probe[i+1].(map[string]float64)
+		if !ok {
+			return 0, false
+		}
+		value, ok := values[id]
+		if !ok || math.IsNaN(value) {
+			return 0, false
+		}
+		low, high, sum = math.Min(low, value), math.Max(high, value), sum+value
+	}
+	if high-low > tolerance {
+		return 0, false
+	}
+	return sum / float64(len(activations)), true
+}
+
+// probeActivations runs every probe through the hidden layers. For each probe, entry 0 is the network
+// input and entry i+1 the output of hidden layer i.
+func probeActivations(config *NetworkConfig, probes []map[string]interface{}) [][]interface{} {
+	var activations [][]interface{}
+	for _, probe := range probes {
+		data := networkInput(config, probe)
+		if data == nil {
+			continue
+		}
+		trace := []interface{}{data}
+		for _, layer := range config.Layers.Hidden {
+			switch layer.LayerType {
+			case "dense":
+				data = processDenseLayer(layer, data)
+			case "conv":
+				data = processConvLayer(layer, data)
+			case "lstm":
+				data = processLSTMLayer(layer, data)
+			}
+			trace = append(trace, data)
+		}
+		activations = append(activations, trace)
+	}
+	return activations
+}
+
+// networkInput converts the input values the way Feedforward does, or returns nil if they don't fit.
+func networkInput(config *NetworkConfig, inputValues map[string]interface{}) interface{} {
+	switch config.Layers.Input.LayerType {
+	case "dense":
+		inputData := make(map[string]float64, len(inputValues))
+		for k, v := range inputValues {
+			val, ok := v.(float64)
+			if !ok {
+				return nil
+			}
+			inputData[k] = val
+		}
+		return inputData
+	case "conv":
+		if imageData, ok := inputValues["image"].([][]float64); ok {
+			return imageData
+		}
+	case "lstm":
+		if sequenceData, ok := inputValues["sequence"].([][]float64); ok {
+			return sequenceData
+		}
+	}
+	return nil
+}
+
+// denseNeuronLayers returns the dense hidden layers and the output layer if it is dense.
+func denseNeuronLayers(config *NetworkConfig) []*Layer {
+	var layers []*Layer
+	for i := range config.Layers.Hidden {
+		if config.Layers.Hidden[i].LayerType == "dense" {
+			layers = append(layers, &config.Layers.Hidden[i])
+		}
+	}
+	if config.Layers.Output.LayerType == "dense" {
+		layers = append(layers, &config.Layers.Output)
+	}
+	return layers
+}
+
+// FormatPruneReport renders a report for logging.
+func FormatPruneReport(report *PruneReport) string {
+	s := fmt.Sprintf("Parameters %d -> %d\n", report.ParamsBefore, report.ParamsAfter)
+	for _, pass := range report.Passes {
+		status := "kept"
+		if pass.RolledBack {
+			status = "rolled back"
+		}
+		s += fmt.Sprintf("  %s: removed %d, accuracy %.2f%% -> %.2f%% (%s)\n",
+			pass.Name, pass.Removed, pass.AccuracyBefore*100, pass.AccuracyAfter*100, status)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package dense
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// NewRand returns a random source for the given seed. Every random operation in the package
+// takes one of these explicitly so runs can be repeated.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// NewSeed returns a fresh seed for a new experiment. Store it (e.g. in ModelMetadata.Seed)
+// so the experiment can be replayed later.
+func NewSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// DeriveSeed deterministically derives the seed for the index-th child of a parent seed.
+// It uses the splitmix64 finalizer so neighbouring indices give unrelated streams.
+func DeriveSeed(seed int64, index int) int64 {
+	z := uint64(seed) + uint64(index+1)*0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z = z ^ (z >> 31)
+	return int64(z)
+}
+
+// ModelRand returns a random source seeded from the model's metadata seed.
+func ModelRand(config *NetworkConfig) *rand.Rand {
+	return NewRand(config.Metadata.Seed)
+}
+
+// MutationRand advances the model's seed and returns a random source for its next mutation,
+// so mutating the same model repeatedly draws fresh but reproducible numbers.
+func MutationRand(config *NetworkConfig) *rand.Rand {
+	config.Metadata.Seed = DeriveSeed(config.Metadata.Seed, 0)
+	return NewRand(config.Metadata.Seed)
+}
+
+// SpawnChild copies the parent into a new child model with a seed derived from the parent's seed
+// and the child's index, and returns the random source the child should be mutated with.
+// Rerunning a generation with the same parent seeds reproduces exactly the same children.
+// An empty childID names the child after its seed. Only the child records the relationship;
+// call LinkParentChild once the child is kept so the parent lists it too.
+func SpawnChild(parent *NetworkConfig, index int, childID string) (*NetworkConfig, *rand.Rand) {
+	child := DeepCopy(parent)
+	child.Metadata.Seed = DeriveSeed(parent.Metadata.Seed, index)
+	if childID == "" {
+		childID = fmt.Sprintf("model_%016x", uint64(child.Metadata.Seed))
+	}
+	child.Metadata.ModelID = childID
+	child.Metadata.ParentModelIDs = []string{parent.Metadata.ModelID}
+	child.Metadata.ChildModelIDs = nil
+	child.Metadata.Objectives = nil // The child has to be measured on its own
+	return child, NewRand(child.Metadata.Seed)
+}
+
+// sortedKeys returns the keys of a map in a stable order. Map iteration order in Go is random,
+// so any loop that draws random numbers per entry has to iterate over sorted keys to be reproducible.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
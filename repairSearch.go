@@ -0,0 +1,304 @@
+package dense
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// RepairExample is an input with the output the model should give for it.
+type RepairExample struct {
+	InputID  string
+	Inputs   func() map[string]interface{} // Loads the raw inputs when no saved state can be reused; may be nil
+	Expected map[string]float64
+}
+
+// RepairMutation is an append-style mutation RepairSearch can try. Steps returns the lineage records to
+// apply to the child; the output layer is reattached after them.
+type RepairMutation struct {
+	Name  string
+	Steps func(config *NetworkConfig, rng *rand.Rand) []MutationRecord
+}
+
+// DefaultRepairMutations appends one fully connected layer, or one to three layers, of 10 to 128 neurons.
+func DefaultRepairMutations() []RepairMutation {
+	return []RepairMutation{
+		{Name: "AppendNewLayerFullConnections", Steps: func(config *NetworkConfig, rng *rand.Rand) []MutationRecord {
+			neurons := rng.Intn(119) + 10
+			return []MutationRecord{{Operator: "AppendNewLayerFullConnections", Seed: rng.Int63(), Args: []int{neurons}}}
+		}},
+		{Name: "AppendMultipleLayers", Steps: func(config *NetworkConfig, rng *rand.Rand) []MutationRecord {
+			neurons := rng.Intn(119) + 10
+			layers := rng.Intn(3) + 1
+			return []MutationRecord{{Operator: "AppendMultipleLayers", Seed: rng.Int63(), Args: []int{layers, neurons}}}
+		}},
+	}
+}
+
+// RepairOptions configures RepairSearch.
+type RepairOptions struct {
+	Attempts          int              // Children to try, defaults to 100
+	Workers           int              // Children mutated and evaluated concurrently, defaults to the number of CPUs
+	Mutations         []RepairMutation // Defaults to DefaultRepairMutations
+	NumOutputs        int              // Outputs of the reattached output layer, defaults to the model's
+	OutputActivations []string         // Their activations, defaults to the model's
+	MinFixed          int              // Targets a child has to get right to be considered, defaults to 1
+	MaxAccepted       int              // Stop once this many children are accepted, defaults to 1
+	Seed              int64            // Children get seeds derived from this, defaults to the model's seed
+	// Correct reports whether an output is right for the expected one. Defaults to SameTopOutput.
+	Correct func(output, expected map[string]float64) bool
+	// SaveDir is where accepted children are saved as <model ID>.json, "" to not save them. A model
+	// already saved there is never replaced: the child's ID gets a numbered suffix instead.
+	SaveDir string
+	// ChildID names an accepted child. Defaults to model_<seed>, as SpawnChild does.
+	ChildID func(child *NetworkConfig) string
+}
+
+// RepairChild is a child RepairSearch accepted.
+type RepairChild struct {
+	Config    *NetworkConfig
+	Path      string           // Where it was saved, "" if it wasn't
+	Mutations []MutationRecord // Mutations applied on top of the model
+	Fixed     []string         // Targets it gets right
+	Accuracy  float64          // Accuracy on the guard set
+}
+
+// RepairResult is the outcome of RepairSearch.
+type RepairResult struct {
+	Attempts         int
+	Candidates       int     // Children that fixed enough targets to be checked on the guard set
+	BaselineAccuracy float64 // The model's accuracy on the guard set
+	Accepted         []RepairChild
+}
+
+// repairAttempt is one mutated child and how it did on the targets and the guard set.
+type repairAttempt struct {
+	child    *NetworkConfig
+	fixed    []string
+	accuracy float64
+	checked  bool
+	err      error
+}
+
+// RepairSearch tries append-style mutations of a model to fix inputs it gets wrong. Each child is
+// evaluated from the states saved for the model stored at modelFilePath, resuming at the deepest layer
+// it shares with the model, so only the new layers are computed. A child is accepted when it gets at least
+// MinFixed targets right and its accuracy on the guard set is no lower than the model's. The guard set
+// can't be empty, or every child would pass.
+//
+// Children are tried in batches of Workers and accepted in attempt order, and each attempt's seed is
+// derived from Seed, so a search is reproducible. Accepted children are saved to SaveDir with the model
+// as their parent; the model records them as its children and is saved back to modelFilePath.
+func RepairSearch(model *NetworkConfig, modelFilePath string, targets, guard []RepairExample, opts RepairOptions) (*RepairResult, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("repair search needs at least one target")
+	}
+	if len(guard) == 0 {
+		return nil, fmt.Errorf("repair search needs a guard set to check children against")
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = 100
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if len(opts.Mutations) == 0 {
+		opts.Mutations = DefaultRepairMutations()
+	}
+	if opts.NumOutputs <= 0 {
+		opts.NumOutputs = len(model.Layers.Output.Neurons)
+	}
+	if opts.OutputActivations == nil {
+		opts.OutputActivations = outputActivations(model)
+	}
+	if opts.MinFixed <= 0 {
+		opts.MinFixed = 1
+	}
+	if opts.MaxAccepted <= 0 {
+		opts.MaxAccepted = 1
+	}
+	if opts.Seed == 0 {
+		opts.Seed = model.Metadata.Seed
+	}
+	if opts.Correct == nil {
+		opts.Correct = SameTopOutput
+	}
+	if opts.ChildID == nil {
+		opts.ChildID = func(child *NetworkConfig) string {
+			return fmt.Sprintf("model_%016x", uint64(child.Metadata.Seed))
+		}
+	}
+
+	// The model itself resumes from its last saved layer
+	baseline, err := NewChildEvaluator(model, model, modelFilePath)
+	if err != nil {
+		return nil, err
+	}
+	result := &RepairResult{BaselineAccuracy: repairAccuracy(baseline, guard, opts.Correct)}
+
+	for start := 0; start < opts.Attempts && len(result.Accepted) < opts.MaxAccepted; start += opts.Workers {
+		end := start + opts.Workers
+		if end > opts.Attempts {
+			end = opts.Attempts
+		}
+		attempts := make([]repairAttempt, end-start)
+
+		var wg sync.WaitGroup
+		for i := range attempts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				attempts[i] = tryRepair(model, modelFilePath, start+i, targets, guard, opts)
+			}(i)
+		}
+		wg.Wait()
+		result.Attempts += len(attempts)
+
+		for _, attempt := range attempts {
+			if attempt.err != nil {
+				fmt.Printf("Repair attempt failed: %v\n", attempt.err)
+				continue
+			}
+			if attempt.checked {
+				result.Candidates++
+			}
+			if !attempt.checked || attempt.accuracy < result.BaselineAccuracy || len(result.Accepted) >= opts.MaxAccepted {
+				continue
+			}
+			child, err := acceptRepair(model, attempt, opts)
+			if err != nil {
+				return result, err
+			}
+			result.Accepted = append(result.Accepted, child)
+		}
+	}
+
+	if len(result.Accepted) > 0 && opts.SaveDir != "" && modelFilePath != "" {
+		if err := SaveModel(modelFilePath, model); err != nil {
+			return result, fmt.Errorf("failed to record children on the model: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// tryRepair mutates one child and evaluates it on the targets, and on the guard set if it fixes enough of them.
+func tryRepair(model *NetworkConfig, modelFilePath string, attempt int, targets, guard []RepairExample, opts RepairOptions) repairAttempt {
+	child := DeepCopy(model)
+	child.Metadata.Seed = DeriveSeed(opts.Seed, attempt)
+	rng := ModelRand(child)
+
+	mutation := opts.Mutations[rng.Intn(len(opts.Mutations))]
+	for _, step := range mutation.Steps(child, rng) {
+		if _, err := ApplyMutationStep(child, step); err != nil {
+			return repairAttempt{err: err}
+		}
+	}
+	reattach := MutationRecord{Operator: "ReattachOutputLayer", Seed: rng.Int63(), Args: []int{opts.NumOutputs}, Activations: opts.OutputActivations}
+	if _, err := ApplyMutationStep(child, reattach); err != nil {
+		return repairAttempt{err: err}
+	}
+
+	evaluator, err := NewChildEvaluator(model, child, modelFilePath)
+	if err != nil {
+		return repairAttempt{err: err}
+	}
+	result := repairAttempt{child: child}
+	for _, target := range targets {
+		output, _, err := evaluator.Evaluate(target.InputID, target.Inputs)
+		if err == nil && opts.Correct(output, target.Expected) {
+			result.fixed = append(result.fixed, target.InputID)
+		}
+	}
+	if len(result.fixed) >= opts.MinFixed {
+		result.checked = true
+		result.accuracy = repairAccuracy(evaluator, guard, opts.Correct)
+	}
+	return result
+}
+
+// acceptRepair names an accepted child, links it to the model and saves it.
+func acceptRepair(model *NetworkConfig, attempt repairAttempt, opts RepairOptions) (RepairChild, error) {
+	child := attempt.child
+	mutations, err := ChildLineage(model, child)
+	if err != nil {
+		return RepairChild{}, err
+	}
+	mutations = append([]MutationRecord(nil), mutations...)
+	child.Metadata.ModelID = opts.ChildID(child)
+	if opts.SaveDir != "" {
+		child.Metadata.ModelID = unusedModelID(opts.SaveDir, child.Metadata.ModelID)
+	}
+	child.Metadata.ParentModelIDs = []string{model.Metadata.ModelID}
+	child.Metadata.ChildModelIDs = nil
+	child.Metadata.Objectives = nil
+	child.Metadata.LastTestAccuracy = attempt.accuracy
+	LinkParentChild(model, child)
+
+	accepted := RepairChild{Config: child, Mutations: mutations, Fixed: attempt.fixed, Accuracy: attempt.accuracy}
+	if opts.SaveDir != "" {
+		accepted.Path = filepath.Join(opts.SaveDir, child.Metadata.ModelID+".json")
+		if err := SaveModel(accepted.Path, child); err != nil {
+			return accepted, fmt.Errorf("failed to save repaired child: %w", err)
+		}
+	}
+	return accepted, nil
+}
+
+// unusedModelID returns id, or id with the lowest numbered suffix, such that no model of that ID is
+// saved in dir.
+func unusedModelID(dir, id string) string {
+	candidate := id
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(dir, candidate+".json")); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", id, n)
+	}
+}
+
+// repairAccuracy is the fraction of examples the evaluated model gets right. Examples that can't be
+// evaluated count as wrong.
+func repairAccuracy(evaluator *ChildEvaluator, examples []RepairExample, correct func(output, expected map[string]float64) bool) float64 {
+	right := 0
+	for _, example := range examples {
+		output, _, err := evaluator.Evaluate(example.InputID, example.Inputs)
+		if err == nil && correct(output, example.Expected) {
+			right++
+		}
+	}
+	return float64(right) / float64(len(examples))
+}
+
+// outputActivations returns the activations of the model's output neurons in output order.
+func outputActivations(model *NetworkConfig) []string {
+	keys := sortedKeys(model.Layers.Output.Neurons)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return len(keys[i]) < len(keys[j]) // output2 before output10
+	})
+	activations := make([]string, len(keys))
+	for i, key := range keys {
+		activations[i] = model.Layers.Output.Neurons[key].ActivationType
+	}
+	return activations
+}
+
+// SameTopOutput reports whether the highest output is at the same key as the highest expected value,
+// the usual check for classification.
+func SameTopOutput(output, expected map[string]float64) bool {
+	return len(output) > 0 && topKey(output) == topKey(expected)
+}
+
+// topKey returns the key of the largest value, the first in key order on ties.
+func topKey(values map[string]float64) string {
+	best := ""
+	for _, key := range sortedKeys(values) {
+		if best == "" || values[key] > values[best] {
+			best = key
+		}
+	}
+	return best
+}
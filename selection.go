@@ -0,0 +1,208 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ModelObjectives holds the objectives a model is ranked on and where it ended up in the last ranking.
+type ModelObjectives struct {
+	Accuracy         float64 `json:"accuracy"`          // Maximized
+	ParamCount       int     `json:"paramCount"`        // Minimized
+	InferenceTimeMs  float64 `json:"inferenceTimeMs"`   // Minimized, average Feedforward time per sample
+	ParetoRank       int     `json:"paretoRank"`        // 0 is the non-dominated front
+	CrowdingDistance float64 `json:"crowdingDistance"`  // Larger means a less crowded region of the front
+	Novelty          float64 `json:"novelty,omitempty"` // Distance to the nearest behaviours seen so far
+	Fitness          float64 `json:"fitness,omitempty"` // Novelty blended with accuracy by ScoreNovelty
+}
+
+// SelectionStrategy picks the n models that survive into the next generation.
+type SelectionStrategy func(models []*NetworkConfig, n int) []*NetworkConfig
+
+// selectionRegistry maps strategy names to their implementations.
+var selectionRegistry = map[string]SelectionStrategy{
+	"accuracy": SelectByAccuracy,
+	"nsga2":    SelectNSGA2,
+	"novelty":  SelectByFitness,
+}
+
+// RegisterSelectionStrategy adds or replaces a named selection strategy.
+func RegisterSelectionStrategy(name string, strategy SelectionStrategy) {
+	selectionRegistry[name] = strategy
+}
+
+// GetSelectionStrategy looks up a selection strategy by name ("accuracy", "nsga2" or "novelty" by default).
+func GetSelectionStrategy(name string) (SelectionStrategy, error) {
+	strategy, ok := selectionRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown selection strategy %q", name)
+	}
+	return strategy, nil
+}
+
+// MeasureObjectives fills Metadata.Objectives from the model's last test accuracy, its parameter count
+// and the average time Feedforward takes over the given inputs. Without inputs the time is left at 0.
+func MeasureObjectives(config *NetworkConfig, inputs []map[string]interface{}) *ModelObjectives {
+	objectives := &ModelObjectives{
+		Accuracy:   config.Metadata.LastTestAccuracy,
+		ParamCount: CountParameters(config),
+	}
+
+	if len(inputs) > 0 {
+		start := time.Now()
+		for _, input := range inputs {
+			Feedforward(config, input)
+		}
+		elapsed := time.Since(start)
+		objectives.InferenceTimeMs = float64(elapsed.Microseconds()) / 1000 / float64(len(inputs))
+	}
+
+	config.Metadata.Objectives = objectives
+	return objectives
+}
+
+// SelectByAccuracy keeps the n models with the highest LastTestAccuracy.
+func SelectByAccuracy(models []*NetworkConfig, n int) []*NetworkConfig {
+	sorted := append([]*NetworkConfig(nil), models...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Metadata.LastTestAccuracy > sorted[j].Metadata.LastTestAccuracy
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// SelectNSGA2 keeps n models using NSGA-II: whole Pareto fronts are taken in rank order and the front
+// that doesn't fit is cut by crowding distance. Models without objectives are measured without timing.
+func SelectNSGA2(models []*NetworkConfig, n int) []*NetworkConfig {
+	fronts := RankNSGA2(models)
+
+	var selected []*NetworkConfig
+	for _, front := range fronts {
+		if len(selected)+len(front) <= n {
+			selected = append(selected, front...)
+			continue
+		}
+		sorted := append([]*NetworkConfig(nil), front...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Metadata.Objectives.CrowdingDistance > sorted[j].Metadata.Objectives.CrowdingDistance
+		})
+		selected = append(selected, sorted[:n-len(selected)]...)
+		break
+	}
+	return selected
+}
+
+// RankNSGA2 sorts the models into Pareto fronts (fast non-dominated sort) and records each model's
+// rank and crowding distance in Metadata.Objectives. The accuracy objective is refreshed from
+// LastTestAccuracy so it always reflects the latest evaluation.
+func RankNSGA2(models []*NetworkConfig) [][]*NetworkConfig {
+	for _, model := range models {
+		if model.Metadata.Objectives == nil {
+			MeasureObjectives(model, nil)
+		}
+		model.Metadata.Objectives.Accuracy = model.Metadata.LastTestAccuracy
+	}
+
+	dominatedBy := make([][]int, len(models)) // Models each model dominates
+	dominationCount := make([]int, len(models))
+	var current []int
+	for i := range models {
+		for j := range models {
+			if i == j {
+				continue
+			}
+			if Dominates(models[i].Metadata.Objectives, models[j].Metadata.Objectives) {
+				dominatedBy[i] = append(dominatedBy[i], j)
+			} else if Dominates(models[j].Metadata.Objectives, models[i].Metadata.Objectives) {
+				dominationCount[i]++
+			}
+		}
+		if dominationCount[i] == 0 {
+			current = append(current, i)
+		}
+	}
+
+	var fronts [][]*NetworkConfig
+	for rank := 0; len(current) > 0; rank++ {
+		front := make([]*NetworkConfig, len(current))
+		var next []int
+		for k, i := range current {
+			models[i].Metadata.Objectives.ParetoRank = rank
+			front[k] = models[i]
+			for _, j := range dominatedBy[i] {
+				dominationCount[j]--
+				if dominationCount[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		assignCrowdingDistance(front)
+		fronts = append(fronts, front)
+		current = next
+	}
+	return fronts
+}
+
+// Dominates reports whether a is at least as good as b on every objective and strictly better on one.
+func Dominates(a, b *ModelObjectives) bool {
+	if a.Accuracy < b.Accuracy || a.ParamCount > b.ParamCount || a.InferenceTimeMs > b.InferenceTimeMs {
+		return false
+	}
+	return a.Accuracy > b.Accuracy || a.ParamCount < b.ParamCount || a.InferenceTimeMs < b.InferenceTimeMs
+}
+
+// CrowdedLess is the NSGA-II crowded comparison: lower rank wins, then larger crowding distance.
+// Useful for tournament selection after RankNSGA2.
+func CrowdedLess(a, b *ModelObjectives) bool {
+	if a.ParetoRank != b.ParetoRank {
+		return a.ParetoRank < b.ParetoRank
+	}
+	return a.CrowdingDistance > b.CrowdingDistance
+}
+
+// assignCrowdingDistance computes the crowding distance of every model in a front. Boundary models get
+// math.MaxFloat64 rather than +Inf so the value can still be written to JSON.
+func assignCrowdingDistance(front []*NetworkConfig) {
+	for _, model := range front {
+		model.Metadata.Objectives.CrowdingDistance = 0
+	}
+	if len(front) <= 2 {
+		for _, model := range front {
+			model.Metadata.Objectives.CrowdingDistance = math.MaxFloat64
+		}
+		return
+	}
+
+	objectiveValues := []func(o *ModelObjectives) float64{
+		func(o *ModelObjectives) float64 { return o.Accuracy },
+		func(o *ModelObjectives) float64 { return float64(o.ParamCount) },
+		func(o *ModelObjectives) float64 { return o.InferenceTimeMs },
+	}
+
+	sorted := append([]*NetworkConfig(nil), front...)
+	for _, value := range objectiveValues {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return value(sorted[i].Metadata.Objectives) < value(sorted[j].Metadata.Objectives)
+		})
+		first := sorted[0].Metadata.Objectives
+		last := sorted[len(sorted)-1].Metadata.Objectives
+		first.CrowdingDistance = math.MaxFloat64
+		last.CrowdingDistance = math.MaxFloat64
+
+		spread := value(last) - value(first)
+		if spread == 0 {
+			continue
+		}
+		for i := 1; i < len(sorted)-1; i++ {
+			objectives := sorted[i].Metadata.Objectives
+			if objectives.CrowdingDistance == math.MaxFloat64 {
+				continue
+			}
+			objectives.CrowdingDistance += (value(sorted[i+1].Metadata.Objectives) - value(sorted[i-1].Metadata.Objectives)) / spread
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package dense
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+// DefaultMappedShardBudget is the memory budget of MappedLayerStates.
+const DefaultMappedShardBudget = 1 << 30
+
+// MappedLayerStates is the mapping pool used to read layer states when many models are evaluated against
+// the same cached layers. Change its budget with SetMemoryBudget.
+var MappedLayerStates = NewMappedShards(DefaultMappedShardBudget)
+
+// hostLittleEndian reports whether stored values can be used in place.
+var hostLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// MappedShards reads packed shard files through read-only memory mappings, so repeated reads of the same
+// layer cost no system calls or copies. Open mappings are kept in an LRU and the least recently used ones
+// are unmapped once their total size exceeds the memory budget. A mapping in use by a ShardView is never
+// unmapped, so the budget can be exceeded while views are open.
+//
+// A mapping is a snapshot of the file. It is reused while it holds the inputs asked for, and mapped again
+// only when State asks for an input it doesn't hold and the file has grown since. Records that were
+// written and not yet indexed (after a crash) are only picked up after the file is opened by a ShardStore.
+type MappedShards struct {
+	mu     sync.Mutex
+	budget int64
+	used   int64
+	lru    *list.List // *mappedShard, most recently used first
+	byPath map[string]*list.Element
+}
+
+// mappedShard is one mapped shard file and its index.
+type mappedShard struct {
+	path      string
+	data      []byte
+	unmap     func() error
+	precision ShardPrecision
+	offsets   map[string]int64
+	schemas   [][]string
+	refs      int
+	dropped   bool // Removed from the pool while in use, unmapped by the last Release
+}
+
+// NewMappedShards returns an empty mapping pool that keeps at most memoryBudget bytes mapped.
+func NewMappedShards(memoryBudget int64) *MappedShards {
+	return &MappedShards{budget: memoryBudget, lru: list.New(), byPath: make(map[string]*list.Element)}
+}
+
+// SetMemoryBudget changes the number of mapped bytes kept and unmaps what no longer fits.
+func (m *MappedShards) SetMemoryBudget(memoryBudget int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budget = memoryBudget
+	m.evict()
+}
+
+// MappedBytes returns the size of all current mappings.
+func (m *MappedShards) MappedBytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// Open returns a view of the shard file at path, mapping it if it isn't mapped yet. The view must be
+// released when its values are no longer used.
+func (m *MappedShards) Open(path string) (*ShardView, error) {
+	return m.open(path, "")
+}
+
+// State reads the state of an input in the form ContinueFeedforward takes.
+func (m *MappedShards) State(path, inputID string) (interface{}, error) {
+	view, err := m.open(path, inputID)
+	if err != nil {
+		return nil, err
+	}
+	defer view.Release()
+	return view.State(inputID)
+}
+
+// open returns a view of the shard file at path. An existing mapping is replaced only when inputID is
+// set, isn't in the mapping and the file has grown past it.
+func (m *MappedShards) open(path, inputID string) (*ShardView, error) {
+	path = filepath.Clean(path)
+	noteShardUse(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.byPath[path]; ok {
+		shard := elem.Value.(*mappedShard)
+		_, has := shard.offsets[inputID]
+		if inputID == "" || has || !fileGrown(path, int64(len(shard.data))) {
+			m.lru.MoveToFront(elem)
+			shard.refs++
+			return &ShardView{pool: m, shard: shard}, nil
+		}
+		m.drop(elem)
+	}
+
+	shard, err := mapShard(path)
+	if err != nil {
+		return nil, err
+	}
+	shard.refs++
+	m.byPath[path] = m.lru.PushFront(shard)
+	m.used += int64(len(shard.data))
+	m.evict()
+	return &ShardView{pool: m, shard: shard}, nil
+}
+
+// fileGrown reports whether the file at path is now larger than size.
+func fileGrown(path string, size int64) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > size
+}
+
+// Forget unmaps a file, if it is mapped, so it can be deleted. Views still using it keep it mapped until
+// they are released.
+func (m *MappedShards) Forget(path string) error {
+	forgetShardUse(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.byPath[filepath.Clean(path)]; ok {
+		return m.drop(elem)
+	}
+	return nil
+}
+
+// Close unmaps every mapping. Mappings still in use are unmapped when their last view is released.
+func (m *MappedShards) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var firstErr error
+	for elem := m.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if err := m.drop(elem); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		elem = next
+	}
+	return firstErr
+}
+
+// evict unmaps unused mappings, least recently used first, until the budget is met.
+func (m *MappedShards) evict() {
+	for elem := m.lru.Back(); elem != nil && m.used > m.budget; {
+		prev := elem.Prev()
+		if elem.Value.(*mappedShard).refs == 0 {
+			if err := m.drop(elem); err != nil {
+				fmt.Printf("Error unmapping %s: %v\n", elem.Value.(*mappedShard).path, err)
+			}
+		}
+		elem = prev
+	}
+}
+
+// drop removes a mapping from the pool and unmaps it unless a view still uses it.
+func (m *MappedShards) drop(elem *list.Element) error {
+	shard := elem.Value.(*mappedShard)
+	m.lru.Remove(elem)
+	delete(m.byPath, shard.path)
+	m.used -= int64(len(shard.data))
+	if shard.refs > 0 {
+		shard.dropped = true
+		return nil
+	}
+	return shard.unmap()
+}
+
+// mapShard maps a shard file and loads its index.
+func mapShard(path string) (*mappedShard, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("no shard file %s: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < shardHeaderSize {
+		return nil, fmt.Errorf("shard file %s is too short", path)
+	}
+	index, err := os.ReadFile(path + ".idx")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard index: %w", err)
+	}
+
+	data, unmap, err := mapFile(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to map shard file %s: %w", path, err)
+	}
+	shard := &mappedShard{path: path, data: data, unmap: unmap, offsets: make(map[string]int64)}
+	if err := shard.load(index); err != nil {
+		unmap()
+		return nil, fmt.Errorf("failed to load shard file %s: %w", path, err)
+	}
+	return shard, nil
+}
+
+// load reads the header and the index entries of records inside the mapping. The index is read after the
+// file size, so it can list records appended past the mapping; those are left out.
+func (s *mappedShard) load(index []byte) error {
+	if err := checkShardHeader(s.data); err != nil {
+		return err
+	}
+	s.precision = ShardPrecision(s.data[5])
+
+	for pos := 0; ; {
+		tag, offset, id, next, ok := readIndexEntry(index, pos)
+		if !ok || offset+recordHeaderSize > int64(len(s.data)) {
+			break
+		}
+		if offset+recordHeaderSize+int64(binary.LittleEndian.Uint32(s.data[offset+1:])) > int64(len(s.data)) {
+			break
+		}
+		switch tag {
+		case recordSchema:
+			payload, err := s.record(offset, tag)
+			if err != nil {
+				return err
+			}
+			keys, err := decodeSchema(payload)
+			if err != nil {
+				return err
+			}
+			s.schemas = append(s.schemas, keys)
+		case recordState, recordTensor:
+			s.offsets[id] = offset
+		default:
+			return fmt.Errorf("unknown record tag %q at offset %d", tag, offset)
+		}
+		pos = next
+	}
+	return nil
+}
+
+// record returns the checked payload of the record at offset. It aliases the mapping.
+func (s *mappedShard) record(offset int64, tag byte) ([]byte, error) {
+	header := s.data[offset : offset+recordHeaderSize]
+	if header[0] != tag {
+		return nil, fmt.Errorf("record at %d is %q, expected %q", offset, header[0], tag)
+	}
+	end := offset + recordHeaderSize + int64(binary.LittleEndian.Uint32(header[1:]))
+	if end > int64(len(s.data)) {
+		return nil, fmt.Errorf("record at %d runs past the end of the file", offset)
+	}
+	payload := s.data[offset+recordHeaderSize : end]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[5:]) {
+		return nil, fmt.Errorf("checksum mismatch in record at %d", offset)
+	}
+	return payload, nil
+}
+
+// statePayload returns the checked payload of the state record of an input.
+func (s *mappedShard) statePayload(offset int64, tag byte, inputID string) ([]byte, error) {
+	payload, err := s.record(offset, tag)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := stateInputID(payload); err != nil || id != inputID {
+		return nil, fmt.Errorf("record at %d does not hold input %s", offset, inputID)
+	}
+	return payload, nil
+}
+
+// ShardView keeps a mapped shard file alive while its values are used.
+type ShardView struct {
+	pool     *MappedShards
+	shard    *mappedShard
+	released bool
+}
+
+// Has reports whether the mapped file holds a state for the input.
+func (v *ShardView) Has(inputID string) bool {
+	_, ok := v.shard.offsets[inputID]
+	return ok
+}
+
+// State decodes the state of an input into a map[string]float64, [][]float64 or [][][]float64 that does
+// not point into the mapping.
+func (v *ShardView) State(inputID string) (interface{}, error) {
+	if v.released {
+		return nil, fmt.Errorf("shard view of %s is released", v.shard.path)
+	}
+	offset, ok := v.shard.offsets[inputID]
+	if !ok {
+		return nil, fmt.Errorf("no state for input %s in %s: %w", inputID, v.shard.path, os.ErrNotExist)
+	}
+	tag := v.shard.data[offset]
+	if tag != recordTensor {
+		tag = recordState
+	}
+	payload, err := v.shard.statePayload(offset, tag, inputID)
+	if err != nil {
+		return nil, err
+	}
+	state, err := decodeState(tag, payload, offset, v.shard.precision, v.shard.schemas)
+	if err != nil {
+		return nil, fmt.Errorf("state for input %s: %w", inputID, err)
+	}
+	return state, nil
+}
+
+// Values returns the values of an input's map state and the keys they belong to, in the same order. For
+// float64 files the values point straight into the mapping: they must not be modified and are only
+// valid until the view is released. float32 files are decoded into a new slice.
+func (v *ShardView) Values(inputID string) ([]float64, []string, error) {
+	if v.released {
+		return nil, nil, fmt.Errorf("shard view of %s is released", v.shard.path)
+	}
+	offset, ok := v.shard.offsets[inputID]
+	if !ok {
+		return nil, nil, fmt.Errorf("no state for input %s in %s: %w", inputID, v.shard.path, os.ErrNotExist)
+	}
+	payload, err := v.shard.statePayload(offset, recordState, inputID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, raw, err := stateValues(payload, offset, v.shard.precision, v.shard.schemas)
+	if err != nil {
+		return nil, nil, fmt.Errorf("state for input %s: %w", inputID, err)
+	}
+	return shardFloats(raw, v.shard.precision), keys, nil
+}
+
+// Release gives the mapping back to the pool. The view and its values must not be used afterwards.
+func (v *ShardView) Release() {
+	m := v.pool
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v.released {
+		return
+	}
+	v.released = true
+	v.shard.refs--
+	if v.shard.refs == 0 && v.shard.dropped {
+		if err := v.shard.unmap(); err != nil {
+			fmt.Printf("Error unmapping %s: %v\n", v.shard.path, err)
+		}
+	}
+	m.evict()
+}
+
+// shardFloats returns stored values as float64s, in place when the layout allows it.
+func shardFloats(raw []byte, precision ShardPrecision) []float64 {
+	n := len(raw) / int(precision)
+	if n == 0 {
+		return []float64{}
+	}
+	if precision == ShardFloat64 && hostLittleEndian && uintptr(unsafe.Pointer(&raw[0]))%8 == 0 {
+		return unsafe.Slice((*float64)(unsafe.Pointer(&raw[0])), n)
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = decodeShardValue(raw[i*int(precision):], precision)
+	}
+	return values
+}
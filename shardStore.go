@@ -0,0 +1,1012 @@
+package dense
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packed layer state shards: every state of one layer lives in a single append-only file instead of one
+// CSV per input. The file starts with a header and holds key schemas, map states and tensor states, each
+// record with its own checksum. A sidecar index file lists the record offsets, so a state is read with one
+// random access. Writes only ever append, and a torn record at the end of the file (a crash mid-write) is
+// ignored when the store is opened again and overwritten by the next record. The file never shrinks, so
+// memory mappings of it stay valid.
+//
+//	header: "DSHD" | version uint8 | precision uint8
+//	record: tag uint8 | payload length uint32 | crc32 of payload uint32 | payload
+//	schema payload: key count uint32 | (key length uint16 | key)...
+//	state payload:  schema uint32 | input ID length uint16 | input ID | padding | values in schema key order
+//	tensor payload: rank uint32 | input ID length uint16 | input ID | shape length uint32 | shape uint32... | padding | values
+//	index entry:    tag uint8 | offset int64 | input ID length uint16 | input ID
+//
+// Map states are the outputs of dense, conv and LSTM layers. Tensor states are the [][]float64 images and
+// sequences that untyped layers pass on, and [][][]float64 image stacks. Their shape lists the outer length
+// followed by the length of every nested slice in order, so ragged rows keep their lengths.
+//
+// The values of a state are padded to start at a file offset that is a multiple of the value size, so a
+// memory-mapped file can hand them out as a float slice without copying.
+const (
+	shardMagic       = "DSHD"
+	shardVersion     = 1
+	shardHeaderSize  = 6
+	recordHeaderSize = 9
+	recordSchema     = 'K'
+	recordState      = 'S'
+	recordTensor     = 'T'
+)
+
+// ShardPrecision is the number of bytes stored per value.
+type ShardPrecision uint8
+
+const (
+	ShardFloat32 ShardPrecision = 4
+	ShardFloat64 ShardPrecision = 8
+)
+
+// DefaultShardPrecision is used for shard files created by SaveShardedLayerState and the activation cache.
+// float64 keeps the saved states bit for bit identical to a full Feedforward.
+var DefaultShardPrecision = ShardFloat64
+
+// ShardStore is an open packed shard file. It is safe for concurrent use, but the index is kept in memory,
+// so a file should only be open once per process; the layer state helpers share one handle per file.
+type ShardStore struct {
+	Path      string
+	Precision ShardPrecision
+
+	mu        sync.RWMutex
+	file      *os.File
+	indexFile *os.File
+	offsets   map[string]int64
+	schemas   [][]string
+	schemaIDs map[string]uint32
+	size      int64
+}
+
+// OpenShardStore opens the shard file at path, creating it with the given precision if it doesn't exist.
+// An existing file keeps the precision it was created with.
+func OpenShardStore(path string, precision ShardPrecision) (*ShardStore, error) {
+	if precision != ShardFloat32 && precision != ShardFloat64 {
+		return nil, fmt.Errorf("unsupported shard precision %d", precision)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create shard folder: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard file: %w", err)
+	}
+	s := &ShardStore{Path: path, Precision: precision, file: file, offsets: make(map[string]int64), schemaIDs: make(map[string]uint32)}
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to load shard file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// load reads or writes the header, loads the index and recovers records appended after it.
+func (s *ShardStore) load() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = info.Size()
+
+	header := make([]byte, shardHeaderSize)
+	if s.size == 0 {
+		copy(header, shardMagic)
+		header[4], header[5] = shardVersion, byte(s.Precision)
+		if _, err := s.file.WriteAt(header, 0); err != nil {
+			return err
+		}
+		s.size = shardHeaderSize
+	} else {
+		if _, err := s.file.ReadAt(header, 0); err != nil {
+			return fmt.Errorf("failed to read header: %w", err)
+		}
+		if err := checkShardHeader(header); err != nil {
+			return err
+		}
+		s.Precision = ShardPrecision(header[5])
+	}
+
+	if s.indexFile, err = os.OpenFile(s.Path+".idx", os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return err
+	}
+	end, err := s.loadIndex()
+	if err != nil {
+		return err
+	}
+	return s.recover(end)
+}
+
+// loadIndex reads the index file and returns the end of the last indexed record. Schema records are read
+// and checked; state records are only checked when they are read. A partial entry at the end of the
+// index is cut off.
+func (s *ShardStore) loadIndex() (int64, error) {
+	data, err := io.ReadAll(s.indexFile)
+	if err != nil {
+		return 0, err
+	}
+	last := int64(-1)
+	pos := 0
+	for {
+		tag, offset, id, next, ok := readIndexEntry(data, pos)
+		if !ok || offset+recordHeaderSize > s.size {
+			break // Entries past the data are rebuilt by recover
+		}
+
+		var payload []byte
+		if tag == recordSchema {
+			if payload, err = s.readRecord(offset, tag); err != nil {
+				if s.recordEnd(offset) > s.size {
+					break // Torn, recover drops it
+				}
+				return 0, err
+			}
+		}
+		if err := s.register(tag, offset, id, payload); err != nil {
+			return 0, err
+		}
+		if offset > last {
+			last = offset
+		}
+		pos = next
+	}
+	if err := s.indexFile.Truncate(int64(pos)); err != nil {
+		return 0, err
+	}
+	if _, err := s.indexFile.Seek(int64(pos), io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if last < 0 {
+		return shardHeaderSize, nil
+	}
+	end := s.recordEnd(last)
+	if end > s.size {
+		return last, nil // The last indexed record is torn, recover drops it
+	}
+	return end, nil
+}
+
+// recover indexes the records between end and the end of the file, which were written but not indexed,
+// and drops a torn record at the end along with anything after it. The file isn't truncated, since other
+// processes may have it mapped; appending starts at end instead.
+func (s *ShardStore) recover(end int64) error {
+	for end < s.size {
+		header := make([]byte, recordHeaderSize)
+		if _, err := s.file.ReadAt(header, end); err != nil {
+			break
+		}
+		payload, err := s.readRecord(end, header[0])
+		if err != nil {
+			break
+		}
+		id := ""
+		if header[0] == recordState || header[0] == recordTensor {
+			id, err = stateInputID(payload)
+			if err != nil {
+				break
+			}
+		}
+		if err := s.register(header[0], end, id, payload); err != nil {
+			return err
+		}
+		if err := s.appendIndex(header[0], end, id); err != nil {
+			return err
+		}
+		end += recordHeaderSize + int64(len(payload))
+	}
+	if end < s.size {
+		s.size = end // The next record overwrites the rest
+		for id, offset := range s.offsets {
+			if offset >= end {
+				delete(s.offsets, id)
+			}
+		}
+		return s.truncateIndex(end)
+	}
+	return nil
+}
+
+// truncateIndex cuts the index file before the first entry of a record at or past end, so entries of
+// dropped records can't point at the records written there later.
+func (s *ShardStore) truncateIndex(end int64) error {
+	if _, err := s.indexFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(s.indexFile)
+	if err != nil {
+		return err
+	}
+	pos := 0
+	for {
+		_, offset, _, next, ok := readIndexEntry(data, pos)
+		if !ok || offset >= end {
+			break
+		}
+		pos = next
+	}
+	if err := s.indexFile.Truncate(int64(pos)); err != nil {
+		return err
+	}
+	_, err = s.indexFile.Seek(int64(pos), io.SeekStart)
+	return err
+}
+
+// recordEnd returns where the record at offset ends according to its header, or past the end of the
+// file if the header can't be read.
+func (s *ShardStore) recordEnd(offset int64) int64 {
+	header := make([]byte, recordHeaderSize)
+	if _, err := s.file.ReadAt(header, offset); err != nil {
+		return s.size + 1
+	}
+	return offset + recordHeaderSize + int64(binary.LittleEndian.Uint32(header[1:]))
+}
+
+// register adds a loaded record to the in-memory index.
+func (s *ShardStore) register(tag byte, offset int64, id string, payload []byte) error {
+	switch tag {
+	case recordSchema:
+		keys, err := decodeSchema(payload)
+		if err != nil {
+			return err
+		}
+		s.schemaIDs[strings.Join(keys, "\x00")] = uint32(len(s.schemas))
+		s.schemas = append(s.schemas, keys)
+	case recordState, recordTensor:
+		s.offsets[id] = offset
+	default:
+		return fmt.Errorf("unknown record tag %q at offset %d", tag, offset)
+	}
+	return nil
+}
+
+// readStateRecord reads and checks the map or tensor state record at offset.
+func (s *ShardStore) readStateRecord(offset int64) (byte, []byte, error) {
+	tag := make([]byte, 1)
+	if _, err := s.file.ReadAt(tag, offset); err != nil {
+		return 0, nil, fmt.Errorf("failed to read record header at %d: %w", offset, err)
+	}
+	if tag[0] != recordTensor {
+		tag[0] = recordState
+	}
+	payload, err := s.readRecord(offset, tag[0])
+	return tag[0], payload, err
+}
+
+// readRecord reads and checks the record at offset.
+func (s *ShardStore) readRecord(offset int64, tag byte) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := s.file.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("failed to read record header at %d: %w", offset, err)
+	}
+	if header[0] != tag {
+		return nil, fmt.Errorf("record at %d is %q, expected %q", offset, header[0], tag)
+	}
+	length := binary.LittleEndian.Uint32(header[1:])
+	if offset+recordHeaderSize+int64(length) > s.size {
+		return nil, fmt.Errorf("record at %d runs past the end of the file", offset)
+	}
+	payload := make([]byte, length)
+	if _, err := s.file.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		return nil, fmt.Errorf("failed to read record at %d: %w", offset, err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[5:]) {
+		return nil, fmt.Errorf("checksum mismatch in record at %d", offset)
+	}
+	return payload, nil
+}
+
+// appendRecord writes a record at the end of the data and indexes it. A failed write leaves the size
+// alone, so the next record overwrites what was written of it.
+func (s *ShardStore) appendRecord(tag byte, id string, payload []byte) (int64, error) {
+	record := make([]byte, recordHeaderSize+len(payload))
+	record[0] = tag
+	binary.LittleEndian.PutUint32(record[1:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[5:], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	offset := s.size
+	if _, err := s.file.WriteAt(record, offset); err != nil {
+		return 0, fmt.Errorf("failed to write record: %w", err)
+	}
+	s.size += int64(len(record))
+	return offset, s.appendIndex(tag, offset, id)
+}
+
+// appendIndex adds an entry to the index file.
+func (s *ShardStore) appendIndex(tag byte, offset int64, id string) error {
+	entry := make([]byte, 11+len(id))
+	entry[0] = tag
+	binary.LittleEndian.PutUint64(entry[1:], uint64(offset))
+	binary.LittleEndian.PutUint16(entry[9:], uint16(len(id)))
+	copy(entry[11:], id)
+	if _, err := s.indexFile.Write(entry); err != nil {
+		return fmt.Errorf("failed to write index entry: %w", err)
+	}
+	return nil
+}
+
+// Put stores the state for an input: a map, or a [][]float64 or [][][]float64 tensor. Storing an input
+// again appends a new record that replaces the old one.
+func (s *ShardStore) Put(inputID string, state interface{}) error {
+	if len(inputID) > math.MaxUint16 {
+		return fmt.Errorf("input ID %q is too long", inputID)
+	}
+	switch v := state.(type) {
+	case map[string]float64:
+		return s.putMap(inputID, v)
+	case [][]float64, [][][]float64:
+		return s.putTensor(inputID, state)
+	}
+	return fmt.Errorf("cannot store layer state of type %T", state)
+}
+
+// putMap stores a map state against the schema of its keys, adding the schema if it is new.
+func (s *ShardStore) putMap(inputID string, values map[string]float64) error {
+	keys := sortedKeys(values)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("shard store %s is closed", s.Path)
+	}
+
+	schemaKey := strings.Join(keys, "\x00")
+	schemaID, ok := s.schemaIDs[schemaKey]
+	if !ok {
+		payload, err := encodeSchema(keys)
+		if err != nil {
+			return err
+		}
+		if _, err := s.appendRecord(recordSchema, "", payload); err != nil {
+			return err
+		}
+		schemaID = uint32(len(s.schemas))
+		s.schemaIDs[schemaKey] = schemaID
+		s.schemas = append(s.schemas, keys)
+	}
+
+	pos := valuesStart(s.Precision, s.size, 6+len(inputID))
+	payload := make([]byte, pos+len(keys)*int(s.Precision))
+	binary.LittleEndian.PutUint32(payload, schemaID)
+	binary.LittleEndian.PutUint16(payload[4:], uint16(len(inputID)))
+	copy(payload[6:], inputID)
+	for _, key := range keys {
+		encodeShardValue(payload[pos:], values[key], s.Precision)
+		pos += int(s.Precision)
+	}
+
+	offset, err := s.appendRecord(recordState, inputID, payload)
+	if err != nil {
+		return err
+	}
+	s.offsets[inputID] = offset
+	return nil
+}
+
+// putTensor stores a [][]float64 or [][][]float64 state with its shape.
+func (s *ShardStore) putTensor(inputID string, state interface{}) error {
+	rank, shape, values := flattenTensor(state)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("shard store %s is closed", s.Path)
+	}
+
+	pos := 10 + len(inputID) + 4*len(shape)
+	start := valuesStart(s.Precision, s.size, pos)
+	payload := make([]byte, start+len(values)*int(s.Precision))
+	binary.LittleEndian.PutUint32(payload, uint32(rank))
+	binary.LittleEndian.PutUint16(payload[4:], uint16(len(inputID)))
+	copy(payload[6:], inputID)
+	binary.LittleEndian.PutUint32(payload[6+len(inputID):], uint32(len(shape)))
+	for i, n := range shape {
+		binary.LittleEndian.PutUint32(payload[10+len(inputID)+4*i:], uint32(n))
+	}
+	for i, value := range values {
+		encodeShardValue(payload[start+i*int(s.Precision):], value, s.Precision)
+	}
+
+	offset, err := s.appendRecord(recordTensor, inputID, payload)
+	if err != nil {
+		return err
+	}
+	s.offsets[inputID] = offset
+	return nil
+}
+
+// Get reads the state stored for an input in the form it was stored: a map[string]float64, [][]float64
+// or [][][]float64.
+func (s *ShardStore) Get(inputID string) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.file == nil {
+		return nil, fmt.Errorf("shard store %s is closed", s.Path)
+	}
+	offset, ok := s.offsets[inputID]
+	if !ok {
+		return nil, fmt.Errorf("no state for input %s in %s: %w", inputID, s.Path, os.ErrNotExist)
+	}
+	tag, payload, err := s.readStateRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := stateInputID(payload); err != nil || id != inputID {
+		return nil, fmt.Errorf("record at %d in %s does not hold input %s", offset, s.Path, inputID)
+	}
+	state, err := decodeState(tag, payload, offset, s.Precision, s.schemas)
+	if err != nil {
+		return nil, fmt.Errorf("state for input %s: %w", inputID, err)
+	}
+	return state, nil
+}
+
+// Has reports whether a state is stored for the input.
+func (s *ShardStore) Has(inputID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.offsets[inputID]
+	return ok
+}
+
+// IDs returns the stored input IDs in sorted order.
+func (s *ShardStore) IDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.offsets))
+	for id := range s.offsets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Len returns the number of stored inputs.
+func (s *ShardStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.offsets)
+}
+
+// Close closes the shard and index files.
+func (s *ShardStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, f := range []*os.File{s.file, s.indexFile} {
+		if f != nil {
+			if err := f.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	s.file, s.indexFile = nil, nil
+	return firstErr
+}
+
+// encodeSchema serializes a key list.
+func encodeSchema(keys []string) ([]byte, error) {
+	payload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(payload, uint32(len(keys)))
+	for _, key := range keys {
+		if len(key) > math.MaxUint16 {
+			return nil, fmt.Errorf("key %q is too long", key)
+		}
+		payload = binary.LittleEndian.AppendUint16(payload, uint16(len(key)))
+		payload = append(payload, key...)
+	}
+	return payload, nil
+}
+
+// decodeSchema parses a key list written by encodeSchema.
+func decodeSchema(payload []byte) ([]string, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("schema record is too short")
+	}
+	count := int(binary.LittleEndian.Uint32(payload))
+	keys := make([]string, 0, count)
+	pos := 4
+	for i := 0; i < count; i++ {
+		if pos+2 > len(payload) {
+			return nil, fmt.Errorf("schema record is truncated")
+		}
+		n := int(binary.LittleEndian.Uint16(payload[pos:]))
+		if pos+2+n > len(payload) {
+			return nil, fmt.Errorf("schema record is truncated")
+		}
+		keys = append(keys, string(payload[pos+2:pos+2+n]))
+		pos += 2 + n
+	}
+	return keys, nil
+}
+
+// readIndexEntry parses the index entry at pos and returns the position of the next one. ok is false at
+// the end of the data or at a partial entry.
+func readIndexEntry(data []byte, pos int) (tag byte, offset int64, id string, next int, ok bool) {
+	if pos+11 > len(data) {
+		return 0, 0, "", pos, false
+	}
+	tag = data[pos]
+	offset = int64(binary.LittleEndian.Uint64(data[pos+1:]))
+	next = pos + 11 + int(binary.LittleEndian.Uint16(data[pos+9:]))
+	if next > len(data) || offset < shardHeaderSize {
+		return 0, 0, "", pos, false
+	}
+	return tag, offset, string(data[pos+11 : next]), next, true
+}
+
+// checkShardHeader validates the header of an existing shard file.
+func checkShardHeader(header []byte) error {
+	if len(header) < shardHeaderSize || string(header[:4]) != shardMagic || header[4] != shardVersion {
+		return fmt.Errorf("not a shard file of version %d", shardVersion)
+	}
+	if precision := ShardPrecision(header[5]); precision != ShardFloat32 && precision != ShardFloat64 {
+		return fmt.Errorf("unsupported shard precision %d", precision)
+	}
+	return nil
+}
+
+// valuesStart returns where the values begin in the payload of a record written at offset, when the
+// fields before them end at pos.
+func valuesStart(precision ShardPrecision, offset int64, pos int) int {
+	start := offset + recordHeaderSize + int64(pos)
+	return pos + int((int64(precision)-start%int64(precision))%int64(precision))
+}
+
+// stateValues splits the payload of the state record at offset into its keys and raw value bytes.
+func stateValues(payload []byte, offset int64, precision ShardPrecision, schemas [][]string) ([]string, []byte, error) {
+	if len(payload) < 6 {
+		return nil, nil, fmt.Errorf("state record is too short")
+	}
+	schemaID := binary.LittleEndian.Uint32(payload)
+	if int(schemaID) >= len(schemas) {
+		return nil, nil, fmt.Errorf("unknown schema %d", schemaID)
+	}
+	keys := schemas[schemaID]
+	pos := valuesStart(precision, offset, 6+int(binary.LittleEndian.Uint16(payload[4:])))
+	if len(payload)-pos != len(keys)*int(precision) {
+		return nil, nil, fmt.Errorf("%d value bytes, expected %d", len(payload)-pos, len(keys)*int(precision))
+	}
+	return keys, payload[pos:], nil
+}
+
+// decodeState decodes the payload of a map or tensor state record written at offset.
+func decodeState(tag byte, payload []byte, offset int64, precision ShardPrecision, schemas [][]string) (interface{}, error) {
+	if tag == recordTensor {
+		return decodeTensor(payload, offset, precision)
+	}
+	keys, values, err := stateValues(payload, offset, precision, schemas)
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string]float64, len(keys))
+	for i, key := range keys {
+		state[key] = decodeShardValue(values[i*int(precision):], precision)
+	}
+	return state, nil
+}
+
+// flattenTensor returns the rank, the shape and the values in row order of a [][]float64 or
+// [][][]float64 state.
+func flattenTensor(state interface{}) (int, []int, []float64) {
+	var shape []int
+	var values []float64
+	switch v := state.(type) {
+	case [][]float64:
+		shape = append(shape, len(v))
+		for _, row := range v {
+			shape = append(shape, len(row))
+			values = append(values, row...)
+		}
+		return 2, shape, values
+	case [][][]float64:
+		shape = append(shape, len(v))
+		for _, image := range v {
+			shape = append(shape, len(image))
+			for _, row := range image {
+				shape = append(shape, len(row))
+				values = append(values, row...)
+			}
+		}
+		return 3, shape, values
+	}
+	return 0, nil, nil
+}
+
+// decodeTensor rebuilds the [][]float64 or [][][]float64 of a tensor record written at offset.
+func decodeTensor(payload []byte, offset int64, precision ShardPrecision) (interface{}, error) {
+	if len(payload) < 10 {
+		return nil, fmt.Errorf("tensor record is too short")
+	}
+	rank := binary.LittleEndian.Uint32(payload)
+	pos := 6 + int(binary.LittleEndian.Uint16(payload[4:]))
+	if pos+4 > len(payload) {
+		return nil, fmt.Errorf("tensor record is truncated")
+	}
+	shapeLen := int(binary.LittleEndian.Uint32(payload[pos:]))
+	pos += 4
+	if pos+4*shapeLen > len(payload) {
+		return nil, fmt.Errorf("tensor record is truncated")
+	}
+	shape := make([]int, shapeLen)
+	for i := range shape {
+		shape[i] = int(binary.LittleEndian.Uint32(payload[pos+4*i:]))
+	}
+	raw := payload[valuesStart(precision, offset, pos+4*shapeLen):]
+
+	// next returns the next shape entry and the next n values
+	shapePos, valuePos := 0, 0
+	next := func() (int, error) {
+		if shapePos >= len(shape) {
+			return 0, fmt.Errorf("tensor shape is truncated")
+		}
+		shapePos++
+		return shape[shapePos-1], nil
+	}
+	row := func() ([]float64, error) {
+		n, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if (valuePos+n)*int(precision) > len(raw) {
+			return nil, fmt.Errorf("tensor values are truncated")
+		}
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = decodeShardValue(raw[(valuePos+i)*int(precision):], precision)
+		}
+		valuePos += n
+		return values, nil
+	}
+	matrix := func() ([][]float64, error) {
+		n, err := next()
+		if err != nil {
+			return nil, err
+		}
+		rows := make([][]float64, n)
+		for i := range rows {
+			if rows[i], err = row(); err != nil {
+				return nil, err
+			}
+		}
+		return rows, nil
+	}
+
+	var state interface{}
+	var err error
+	switch rank {
+	case 2:
+		state, err = matrix()
+	case 3:
+		var n int
+		if n, err = next(); err == nil {
+			images := make([][][]float64, n)
+			for i := 0; i < n && err == nil; i++ {
+				images[i], err = matrix()
+			}
+			state = images
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tensor rank %d", rank)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shapePos != len(shape) || valuePos*int(precision) != len(raw) {
+		return nil, fmt.Errorf("tensor shape does not match its %d value bytes", len(raw))
+	}
+	return state, nil
+}
+
+// encodeShardValue writes one value.
+func encodeShardValue(b []byte, value float64, precision ShardPrecision) {
+	if precision == ShardFloat32 {
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(value)))
+	} else {
+		binary.LittleEndian.PutUint64(b, math.Float64bits(value))
+	}
+}
+
+// decodeShardValue reads one stored value.
+func decodeShardValue(b []byte, precision ShardPrecision) float64 {
+	if precision == ShardFloat32 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// stateInputID returns the input ID of a state payload.
+func stateInputID(payload []byte) (string, error) {
+	if len(payload) < 6 {
+		return "", fmt.Errorf("state record is too short")
+	}
+	n := int(binary.LittleEndian.Uint16(payload[4:]))
+	if 6+n > len(payload) {
+		return "", fmt.Errorf("state record is truncated")
+	}
+	return string(payload[6 : 6+n]), nil
+}
+
+// MaxOpenShardStores is the number of shard files the layer state helpers and the activation cache keep
+// open. Beyond it the least recently used idle handles are closed; they are opened again when needed.
+var MaxOpenShardStores = 128
+
+var (
+	shardStoresMu  sync.Mutex
+	shardStores    = make(map[string]*list.Element) // *sharedStore
+	shardStoresLRU = list.New()                     // Most recently used first
+)
+
+// sharedStore is an open shard file shared by the layer state helpers.
+type sharedStore struct {
+	path    string
+	store   *ShardStore
+	refs    int
+	dropped bool // Removed while in use, closed by the last release
+}
+
+// withShardStore runs use with the process-wide handle of a shard file, opening it on first use. Without
+// create, a missing file is an os.ErrNotExist error instead of a new empty store. The handle stays open
+// while use runs and may be closed afterwards, so use must not keep it.
+func withShardStore(path string, create bool, use func(store *ShardStore) error) error {
+	shared, err := acquireShardStore(path, create)
+	if err != nil {
+		return err
+	}
+	defer releaseShardStore(shared)
+	noteShardUse(shared.path)
+	return use(shared.store)
+}
+
+// acquireShardStore returns the shared handle of a shard file and marks it in use.
+func acquireShardStore(path string, create bool) (*sharedStore, error) {
+	path = filepath.Clean(path)
+	shardStoresMu.Lock()
+	defer shardStoresMu.Unlock()
+	if elem, ok := shardStores[path]; ok {
+		shardStoresLRU.MoveToFront(elem)
+		shared := elem.Value.(*sharedStore)
+		shared.refs++
+		return shared, nil
+	}
+	if !create {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("no shard file %s: %w", path, os.ErrNotExist)
+		}
+	}
+	store, err := OpenShardStore(path, DefaultShardPrecision)
+	if err != nil {
+		return nil, err
+	}
+	shared := &sharedStore{path: path, store: store, refs: 1}
+	shardStores[path] = shardStoresLRU.PushFront(shared)
+	closeIdleShardStores()
+	return shared, nil
+}
+
+// releaseShardStore gives a handle back and closes idle handles beyond MaxOpenShardStores.
+func releaseShardStore(shared *sharedStore) {
+	shardStoresMu.Lock()
+	defer shardStoresMu.Unlock()
+	shared.refs--
+	if shared.refs == 0 && shared.dropped {
+		if err := shared.store.Close(); err != nil {
+			fmt.Printf("Error closing shard file %s: %v\n", shared.path, err)
+		}
+		return
+	}
+	closeIdleShardStores()
+}
+
+// closeIdleShardStores closes unused handles, least recently used first, until at most MaxOpenShardStores
+// are open. The caller holds shardStoresMu.
+func closeIdleShardStores() {
+	for elem := shardStoresLRU.Back(); elem != nil && shardStoresLRU.Len() > MaxOpenShardStores; {
+		prev := elem.Prev()
+		if elem.Value.(*sharedStore).refs == 0 {
+			if err := dropShardStore(elem); err != nil {
+				fmt.Printf("Error closing shard file %s: %v\n", elem.Value.(*sharedStore).path, err)
+			}
+		}
+		elem = prev
+	}
+}
+
+// dropShardStore removes a handle from the shared ones and closes it unless it is in use. The caller
+// holds shardStoresMu.
+func dropShardStore(elem *list.Element) error {
+	shared := elem.Value.(*sharedStore)
+	shardStoresLRU.Remove(elem)
+	delete(shardStores, shared.path)
+	if shared.refs > 0 {
+		shared.dropped = true
+		return nil
+	}
+	return shared.store.Close()
+}
+
+// closeSharedShardStore closes the shared handle of a shard file, if it is open, so the file can be deleted.
+func closeSharedShardStore(path string) error {
+	forgetShardUse(path)
+	shardStoresMu.Lock()
+	defer shardStoresMu.Unlock()
+	if elem, ok := shardStores[filepath.Clean(path)]; ok {
+		return dropShardStore(elem)
+	}
+	return nil
+}
+
+// ShardUseResolution is how often reads refresh the last use of a shard file. The layer state manager
+// evicts the files that were used least recently first, so this is how precise its order is.
+var ShardUseResolution = time.Minute
+
+var (
+	shardUsesMu sync.Mutex
+	shardUses   = make(map[string]time.Time) // When each file was last marked used
+)
+
+// noteShardUse marks a shard file used when it is read or written, at most once per ShardUseResolution.
+func noteShardUse(path string) {
+	path = filepath.Clean(path)
+	now := time.Now()
+	shardUsesMu.Lock()
+	if last, ok := shardUses[path]; ok && now.Sub(last) < ShardUseResolution {
+		shardUsesMu.Unlock()
+		return
+	}
+	shardUses[path] = now
+	shardUsesMu.Unlock()
+	markShardUsed(path)
+}
+
+// forgetShardUse drops the last use of a shard file that is being deleted.
+func forgetShardUse(path string) {
+	shardUsesMu.Lock()
+	delete(shardUses, filepath.Clean(path))
+	shardUsesMu.Unlock()
+}
+
+// markShardUsed sets the modification time of a shard file to now, which is what the layer state
+// manager reads as its last use.
+func markShardUsed(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// CloseShardStores closes every shard file opened by the layer state helpers and the activation cache.
+// Handles still in use are closed when they are released.
+func CloseShardStores() error {
+	shardStoresMu.Lock()
+	defer shardStoresMu.Unlock()
+	var firstErr error
+	for elem := shardStoresLRU.Front(); elem != nil; {
+		next := elem.Next()
+		if err := dropShardStore(elem); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		elem = next
+	}
+	return firstErr
+}
+
+// layerPassesMatrix reports whether the state of a hidden layer is a [][]float64: the input layer takes
+// an image or a sequence and no layer up to this one turns it into a map.
+func layerPassesMatrix(config *NetworkConfig, layerIndex int) bool {
+	if config.Layers.Input.LayerType != "conv" && config.Layers.Input.LayerType != "lstm" {
+		return false
+	}
+	for i := 0; i <= layerIndex && i < len(config.Layers.Hidden); i++ {
+		switch config.Layers.Hidden[i].LayerType {
+		case "dense", "conv", "lstm":
+			return false
+		}
+	}
+	return true
+}
+
+// LayerShardPath is the packed shard file of a model's hidden layer: <model folder>/layer_<n>.shard.
+func LayerShardPath(modelFilePath string, layerIndex int) string {
+	dir, file := filepath.Split(modelFilePath)
+	modelName := strings.TrimSuffix(file, filepath.Ext(file))
+	return filepath.Join(dir, modelName, fmt.Sprintf("layer_%d.shard", layerIndex))
+}
+
+// layerShardRefPath is the file pointing a model's layer at a shard of the generation's activation cache.
+func layerShardRefPath(modelFilePath string, layerIndex int) string {
+	return strings.TrimSuffix(LayerShardPath(modelFilePath, layerIndex), ".shard") + ".ref"
+}
+
+// SaveLayerShardRef records that the states of a model's layer are the activation cache's states for
+// prefixHash, so they are read from the cache instead of being stored again for the model.
+func SaveLayerShardRef(modelFilePath string, layerIndex int, prefixHash string) error {
+	path := layerShardRefPath(modelFilePath, layerIndex)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create model folder: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(prefixHash), 0644); err != nil {
+		return fmt.Errorf("failed to write layer shard reference: %w", err)
+	}
+	return nil
+}
+
+// resolveLayerShard returns the shard file holding a model's layer states: its own shard if it has one,
+// otherwise the activation cache shard its reference points to.
+func resolveLayerShard(modelFilePath string, layerIndex int) (string, error) {
+	path := LayerShardPath(modelFilePath, layerIndex)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	ref, err := os.ReadFile(layerShardRefPath(modelFilePath, layerIndex))
+	if err != nil {
+		return "", fmt.Errorf("no layer %d states for model %s: %w", layerIndex, modelFilePath, os.ErrNotExist)
+	}
+	return NewActivationCache(filepath.Dir(modelFilePath)).ShardPath(strings.TrimSpace(string(ref))), nil
+}
+
+// HasShardedLayerState reports whether the layer state of an input is saved for the model.
+func HasShardedLayerState(modelFilePath string, layerIndex int, inputID string) bool {
+	path, err := resolveLayerShard(modelFilePath, layerIndex)
+	if err != nil {
+		return false
+	}
+	has := false
+	withShardStore(path, false, func(store *ShardStore) error {
+		has = store.Has(inputID)
+		return nil
+	})
+	return has
+}
+
+// MigrateCSVShards converts a folder of per-input CSV shards (input_<id>.csv, as written by earlier
+// versions of SaveShardedLayerState) for hidden layer layerIndex of config into the packed shard file
+// storePath. Shards that can't be parsed are reported and skipped, and so are tensor shards unless the
+// model passes a [][]float64 on at that layer: CSV shards wrote [][][]float64 states row after row, so
+// they can't be rebuilt. config may be nil when the model is unknown. It returns the number of inputs
+// migrated.
+func MigrateCSVShards(shardFolder, storePath string, precision ShardPrecision, config *NetworkConfig, layerIndex int) (int, error) {
+	entries, err := os.ReadDir(shardFolder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read shard folder: %w", err)
+	}
+	store, err := OpenShardStore(storePath, precision)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	migrated := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "input_") || filepath.Ext(name) != ".csv" {
+			continue
+		}
+		inputID := strings.TrimSuffix(strings.TrimPrefix(name, "input_"), ".csv")
+		state, err := readCSVShard(filepath.Join(shardFolder, name), inputID)
+		if err != nil {
+			fmt.Printf("Skipping shard %s: %v\n", name, err)
+			continue
+		}
+		if _, ok := state.([][]float64); ok && (config == nil || !layerPassesMatrix(config, layerIndex)) {
+			fmt.Printf("Skipping shard %s: its rows may belong to several images, which CSV shards don't keep apart\n", name)
+			continue
+		}
+		if err := store.Put(inputID, state); err != nil {
+			return migrated, fmt.Errorf("failed to migrate shard %s: %w", name, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"dense"
+)
+
+func main() {
+	// Setup command-line flags
+	dir := flag.String("dir", "./host/generations", "Directory containing the numbered generation folders")
+	evict := flag.Bool("evict-unselected", false, "Delete the layer states of models that were not selected into the next generation")
+	quotaMB := flag.Int64("quota-mb", 0, "Delete the least recently used layer states until they fit in this many MB (0 for no limit)")
+	dryRun := flag.Bool("dry-run", false, "Only report what would be deleted")
+	flag.Parse()
+
+	manager := dense.NewLayerStateManager(*dir, *quotaMB<<20)
+	manager.DryRun = *dryRun
+
+	if *evict {
+		freed, err := manager.EvictUnselected()
+		if err != nil {
+			fmt.Println("Error evicting unselected models:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Freed %.1f MB from unselected models\n", float64(freed)/(1<<20))
+	}
+	if *quotaMB > 0 {
+		freed, err := manager.EnforceQuota()
+		if err != nil {
+			fmt.Println("Error enforcing quota:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Freed %.1f MB to meet the quota\n", float64(freed)/(1<<20))
+	}
+
+	usage, err := manager.Usage()
+	if err != nil {
+		fmt.Println("Error measuring layer states:", err)
+		os.Exit(1)
+	}
+	var total int64
+	for _, gen := range usage {
+		fmt.Printf("Generation %d: %.1f MB, activation cache %.1f MB\n", gen.Generation, float64(gen.Bytes)/(1<<20), float64(gen.ActivationCacheBytes)/(1<<20))
+		for _, model := range gen.Models {
+			status := ""
+			if model.Live {
+				status = " (live)"
+			} else if model.Selected {
+				status = " (selected)"
+			}
+			fmt.Printf("  %s: %.1f MB%s\n", model.ModelID, float64(model.Bytes)/(1<<20), status)
+		}
+		total += gen.Bytes
+	}
+	fmt.Printf("Layer states take %.1f MB in total\n", float64(total)/(1<<20))
+}
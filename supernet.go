@@ -0,0 +1,570 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// SupernetSpace describes the candidate operations of a one-shot NAS supernet. Feedforward can only run
+// conv layers on an image and LSTM layers on a sequence, so those candidates are offered in the first
+// slot of image and sequence models; every other slot chooses between dense widths.
+type SupernetSpace struct {
+	InputType         string // "dense", "conv" (image) or "lstm" (sequence)
+	InputSize         int    // Dense inputs, or features per time step for sequences
+	ImageRows         int    // Image size for conv inputs
+	ImageCols         int
+	Slots             int   // Layer slots in the supernet
+	DenseWidths       []int // Candidate neuron counts for dense slots
+	ConvKernels       []int // Candidate kernel sizes for the first slot of image models
+	ConvFilters       int   // Filters per conv candidate, defaults to 1
+	LSTMCells         []int // Candidate cell counts for the first slot of sequence models
+	Activation        string
+	NumOutputs        int
+	OutputActivations []string
+}
+
+// SupernetSlot holds the candidate layers of one slot and their architecture weights (logits).
+type SupernetSlot struct {
+	Candidates []Layer   `json:"candidates"`
+	Alpha      []float64 `json:"alpha"`
+}
+
+// Supernet is an over-parameterized network whose slots output the softmax(alpha)-weighted mix of all
+// their candidate layers, so the architecture choice becomes continuous and can be trained with the weights.
+type Supernet struct {
+	Input  Layer          `json:"input"`
+	Slots  []SupernetSlot `json:"slots"`
+	Output Layer          `json:"output"`
+}
+
+// SupernetSample is one training example: network inputs as passed to Feedforward and the expected outputs.
+type SupernetSample struct {
+	Inputs  map[string]interface{}
+	Targets map[string]float64
+}
+
+// SupernetOptions configures TrainSupernet.
+type SupernetOptions struct {
+	Steps            int
+	BatchSize        int     // Samples per fitness estimate, 0 for all
+	Pairs            int     // Antithetic pairs per gradient estimate
+	Sigma            float64 // Perturbation size
+	WeightRate       float64 // Step size for the candidate weights
+	ArchitectureRate float64 // Step size for the architecture logits
+	Workers          int
+	Seed             int64
+	// Fitness scores one prediction, higher is better. Defaults to the negative mean squared error.
+	Fitness func(outputs, targets map[string]float64) float64
+	// OnStep is called after each step with the fitness of the updated supernet on that step's batches.
+	OnStep func(step int, trainFitness, validationFitness float64)
+}
+
+// NewSupernet builds a supernet over the search space with randomly initialized candidates.
+func NewSupernet(space SupernetSpace, rng *rand.Rand) (*Supernet, error) {
+	if space.Slots <= 0 {
+		return nil, fmt.Errorf("supernet needs at least one slot")
+	}
+	if len(space.DenseWidths) == 0 {
+		return nil, fmt.Errorf("supernet needs at least one dense width")
+	}
+	if space.Activation == "" {
+		space.Activation = "relu"
+	}
+	if space.ConvFilters <= 0 {
+		space.ConvFilters = 1
+	}
+
+	net := &Supernet{Input: Layer{LayerType: space.InputType}}
+	var keys []string // Keys produced by the previous slot
+	switch space.InputType {
+	case "dense":
+		net.Input.Neurons = make(map[string]Neuron, space.InputSize)
+		for i := 0; i < space.InputSize; i++ {
+			keys = append(keys, "input"+strconv.Itoa(i))
+			net.Input.Neurons[keys[i]] = Neuron{}
+		}
+	case "conv":
+		if len(space.ConvKernels) == 0 || space.ImageRows <= 0 || space.ImageCols <= 0 {
+			return nil, fmt.Errorf("image supernets need conv kernels and an image size")
+		}
+	case "lstm":
+		if len(space.LSTMCells) == 0 || space.InputSize <= 0 {
+			return nil, fmt.Errorf("sequence supernets need LSTM cell counts and an input size")
+		}
+	default:
+		return nil, fmt.Errorf("unknown input type %q", space.InputType)
+	}
+
+	for s := 0; s < space.Slots; s++ {
+		var slot SupernetSlot
+		switch {
+		case s == 0 && space.InputType == "conv":
+			outputs := 0
+			for _, kernel := range space.ConvKernels {
+				layer := Layer{LayerType: "conv", Stride: 1, Padding: kernel / 2}
+				for f := 0; f < space.ConvFilters; f++ {
+					layer.Filters = append(layer.Filters, Filter{Weights: scaledMatrix(kernel, kernel, 1/float64(kernel), rng)})
+				}
+				slot.Candidates = append(slot.Candidates, layer)
+				rows := space.ImageRows + 2*layer.Padding - kernel + 1
+				cols := space.ImageCols + 2*layer.Padding - kernel + 1
+				if n := space.ConvFilters * rows * cols; n > outputs {
+					outputs = n
+				}
+			}
+			keys = numberedKeys("conv_output", outputs)
+		case s == 0 && space.InputType == "lstm":
+			maxCells := 0
+			for _, cells := range space.LSTMCells {
+				layer := Layer{LayerType: "lstm"}
+				for c := 0; c < cells; c++ {
+					scale := 1 / math.Sqrt(float64(space.InputSize))
+					layer.LSTMCells = append(layer.LSTMCells, LSTMCell{
+						InputWeights:  scaledSlice(space.InputSize, scale, rng),
+						ForgetWeights: scaledSlice(space.InputSize, scale, rng),
+						OutputWeights: scaledSlice(space.InputSize, scale, rng),
+						CellWeights:   scaledSlice(space.InputSize, scale, rng),
+					})
+				}
+				slot.Candidates = append(slot.Candidates, layer)
+				if cells > maxCells {
+					maxCells = cells
+				}
+			}
+			keys = numberedKeys("lstm", maxCells)
+		default:
+			maxWidth := 0
+			for _, width := range space.DenseWidths {
+				slot.Candidates = append(slot.Candidates, randomDenseLayer(width, "neuron", space.Activation, keys, rng))
+				if width > maxWidth {
+					maxWidth = width
+				}
+			}
+			// Dense candidates share neuron IDs, so the narrower widths mix into the first neurons of the wider ones
+			keys = nil
+			for i := 1; i <= maxWidth; i++ {
+				keys = append(keys, "neuron"+strconv.Itoa(i))
+			}
+		}
+		slot.Alpha = make([]float64, len(slot.Candidates))
+		net.Slots = append(net.Slots, slot)
+	}
+
+	net.Output = randomDenseLayer(space.NumOutputs, "output", "", keys, rng)
+	for i := 0; i < space.NumOutputs && i < len(space.OutputActivations); i++ {
+		id := "output" + strconv.Itoa(i)
+		neuron := net.Output.Neurons[id]
+		neuron.ActivationType = space.OutputActivations[i]
+		net.Output.Neurons[id] = neuron
+	}
+	return net, nil
+}
+
+// Feedforward runs the supernet, mixing the candidates of every slot by their architecture probabilities.
+func (s *Supernet) Feedforward(inputValues map[string]interface{}) map[string]float64 {
+	inputConfig := &NetworkConfig{}
+	inputConfig.Layers.Input = s.Input
+	data := networkInput(inputConfig, inputValues)
+	if data == nil {
+		return nil
+	}
+
+	for _, slot := range s.Slots {
+		probs := softmax(slot.Alpha)
+		mixed := make(map[string]float64)
+		for c, candidate := range slot.Candidates {
+			out, _ := processLayer(candidate, data).(map[string]float64)
+			for key, value := range out {
+				mixed[key] += probs[c] * value
+			}
+		}
+		data = mixed
+	}
+
+	out, _ := processDenseLayer(s.Output, data).(map[string]float64)
+	return out
+}
+
+// Probabilities returns the softmax of every slot's architecture weights.
+func (s *Supernet) Probabilities() [][]float64 {
+	probs := make([][]float64, len(s.Slots))
+	for i, slot := range s.Slots {
+		probs[i] = softmax(slot.Alpha)
+	}
+	return probs
+}
+
+// StrongestChoices returns the candidate with the highest architecture weight in every slot.
+func (s *Supernet) StrongestChoices() []int {
+	choices := make([]int, len(s.Slots))
+	for i, slot := range s.Slots {
+		for c, alpha := range slot.Alpha {
+			if alpha > slot.Alpha[choices[i]] {
+				choices[i] = c
+			}
+		}
+	}
+	return choices
+}
+
+// SampleArchitecture picks a random candidate per slot, for weight-sharing architecture search.
+func (s *Supernet) SampleArchitecture(rng *rand.Rand) []int {
+	choices := make([]int, len(s.Slots))
+	for i, slot := range s.Slots {
+		choices[i] = rng.Intn(len(slot.Candidates))
+	}
+	return choices
+}
+
+// Derive builds a discrete NetworkConfig from one candidate per slot, inheriting the supernet weights.
+// The layer after each slot has its weights scaled by the chosen candidate's probability so it sees the
+// same contribution as in the supernet, and connections to values the chosen layers don't produce are
+// dropped.
+func (s *Supernet) Derive(choices []int, modelID, projectName string) (*NetworkConfig, error) {
+	if len(choices) != len(s.Slots) {
+		return nil, fmt.Errorf("got %d choices for %d slots", len(choices), len(s.Slots))
+	}
+	config := &NetworkConfig{Metadata: ModelMetadata{ModelID: modelID, ProjectName: projectName}}
+	config.Layers.Input = deepCopyLayer(s.Input)
+
+	for i, slot := range s.Slots {
+		if choices[i] < 0 || choices[i] >= len(slot.Candidates) {
+			return nil, fmt.Errorf("slot %d has no candidate %d", i, choices[i])
+		}
+		config.Layers.Hidden = append(config.Layers.Hidden, deepCopyLayer(slot.Candidates[choices[i]]))
+	}
+	config.Layers.Output = deepCopyLayer(s.Output)
+
+	// Consumers are always dense: every slot after the first and the output layer
+	for i, slot := range s.Slots {
+		consumer := &config.Layers.Output
+		if i+1 < len(config.Layers.Hidden) {
+			consumer = &config.Layers.Hidden[i+1]
+		}
+		scale := softmax(slot.Alpha)[choices[i]]
+		produced := layerOutputKeys(config.Layers.Hidden[i])
+		for id, neuron := range consumer.Neurons {
+			for inputID, conn := range neuron.Connections {
+				if produced != nil && !produced[inputID] {
+					delete(neuron.Connections, inputID)
+					continue
+				}
+				neuron.Connections[inputID] = Connection{Weight: conn.Weight * scale}
+			}
+			consumer.Neurons[id] = neuron
+		}
+	}
+	return config, nil
+}
+
+// layerOutputKeys returns the keys a dense or LSTM layer produces, or nil when it depends on the input size.
+func layerOutputKeys(layer Layer) map[string]bool {
+	switch layer.LayerType {
+	case "dense":
+		keys := make(map[string]bool, len(layer.Neurons))
+		for id := range layer.Neurons {
+			keys[id] = true
+		}
+		return keys
+	case "lstm":
+		keys := make(map[string]bool, len(layer.LSTMCells))
+		for i := range layer.LSTMCells {
+			keys["lstm"+strconv.Itoa(i)] = true
+		}
+		return keys
+	}
+	return nil
+}
+
+// TrainSupernet trains the candidate weights and the architecture weights jointly, DARTS style: each step
+// updates the weights on the training samples, then the architecture on the validation samples. The
+// engine has no automatic differentiation, so both gradients are estimated with antithetic OpenAI-ES.
+func TrainSupernet(net *Supernet, train, validation []SupernetSample, opts SupernetOptions) error {
+	if len(train) == 0 || len(validation) == 0 {
+		return fmt.Errorf("supernet training needs training and validation samples")
+	}
+	if opts.Sigma <= 0 {
+		opts.Sigma = 0.05
+	}
+	if opts.Pairs <= 0 {
+		opts.Pairs = 10
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.Fitness == nil {
+		opts.Fitness = negativeMSE
+	}
+	rng := NewRand(opts.Seed)
+
+	for step := 0; step < opts.Steps; step++ {
+		trainBatch := sampleBatch(train, opts.BatchSize, rng)
+		weights := FlattenParameters(net.weightView())
+		gradient := estimateESGradient(weights, opts, rng, func(candidate *Supernet, params []float64) float64 {
+			SetParameters(candidate.weightView(), params)
+			return candidate.fitness(trainBatch, opts.Fitness)
+		}, net)
+		for k := range weights {
+			weights[k] += opts.WeightRate * gradient[k]
+		}
+		SetParameters(net.weightView(), weights)
+
+		validationBatch := sampleBatch(validation, opts.BatchSize, rng)
+		alphas := net.alphaVector()
+		gradient = estimateESGradient(alphas, opts, rng, func(candidate *Supernet, params []float64) float64 {
+			candidate.setAlphaVector(params)
+			return candidate.fitness(validationBatch, opts.Fitness)
+		}, net)
+		for k := range alphas {
+			alphas[k] += opts.ArchitectureRate * gradient[k]
+		}
+		net.setAlphaVector(alphas)
+
+		if opts.OnStep != nil {
+			opts.OnStep(step, net.fitness(trainBatch, opts.Fitness), net.fitness(validationBatch, opts.Fitness))
+		}
+	}
+	return nil
+}
+
+// SearchSupernet is one-shot NAS by random search: it evaluates numSamples random architectures with the
+// weights they inherit from the trained supernet, plus the strongest choices, and returns the best.
+func SearchSupernet(net *Supernet, validation []SupernetSample, numSamples int, fitness func(outputs, targets map[string]float64) float64, rng *rand.Rand) ([]int, float64, error) {
+	if fitness == nil {
+		fitness = negativeMSE
+	}
+	best := net.StrongestChoices()
+	bestFitness := math.Inf(-1)
+	for i := 0; i <= numSamples; i++ {
+		choices := best
+		if i > 0 {
+			choices = net.SampleArchitecture(rng)
+		}
+		config, err := net.Derive(choices, "", "")
+		if err != nil {
+			return nil, 0, err
+		}
+		score := 0.0
+		for _, sample := range validation {
+			score += fitness(Feedforward(config, sample.Inputs), sample.Targets) / float64(len(validation))
+		}
+		if score > bestFitness {
+			best, bestFitness = choices, score
+		}
+	}
+	return best, bestFitness, nil
+}
+
+// weightView is a NetworkConfig sharing the supernet's candidate and output layers, so the parameter
+// vector helpers can read and write the supernet weights.
+func (s *Supernet) weightView() *NetworkConfig {
+	config := &NetworkConfig{}
+	for _, slot := range s.Slots {
+		config.Layers.Hidden = append(config.Layers.Hidden, slot.Candidates...)
+	}
+	config.Layers.Output = s.Output
+	return config
+}
+
+// alphaVector concatenates the architecture weights of all slots.
+func (s *Supernet) alphaVector() []float64 {
+	var alphas []float64
+	for _, slot := range s.Slots {
+		alphas = append(alphas, slot.Alpha...)
+	}
+	return alphas
+}
+
+// setAlphaVector writes a vector from alphaVector back into the slots.
+func (s *Supernet) setAlphaVector(alphas []float64) {
+	k := 0
+	for i := range s.Slots {
+		k += copy(s.Slots[i].Alpha, alphas[k:])
+	}
+}
+
+// fitness is the mean fitness of the supernet over the samples.
+func (s *Supernet) fitness(samples []SupernetSample, fitness func(outputs, targets map[string]float64) float64) float64 {
+	total := 0.0
+	for _, sample := range samples {
+		total += fitness(s.Feedforward(sample.Inputs), sample.Targets)
+	}
+	return total / float64(len(samples))
+}
+
+// copySupernet deep copies the supernet so workers can evaluate perturbations side by side.
+func copySupernet(s *Supernet) *Supernet {
+	c := &Supernet{Input: deepCopyLayer(s.Input), Output: deepCopyLayer(s.Output)}
+	for _, slot := range s.Slots {
+		copied := SupernetSlot{Alpha: append([]float64(nil), slot.Alpha...)}
+		for _, candidate := range slot.Candidates {
+			copied.Candidates = append(copied.Candidates, deepCopyLayer(candidate))
+		}
+		c.Slots = append(c.Slots, copied)
+	}
+	return c
+}
+
+// estimateESGradient estimates the fitness gradient at theta from antithetic perturbations evaluated in
+// parallel on copies of net.
+func estimateESGradient(theta []float64, opts SupernetOptions, rng *rand.Rand, evaluate func(candidate *Supernet, params []float64) float64, net *Supernet) []float64 {
+	noise := make([][]float64, opts.Pairs)
+	candidates := make([][]float64, 0, 2*opts.Pairs)
+	for i := range noise {
+		eps := make([]float64, len(theta))
+		plus := make([]float64, len(theta))
+		minus := make([]float64, len(theta))
+		for k := range eps {
+			eps[k] = rng.NormFloat64()
+			plus[k] = theta[k] + opts.Sigma*eps[k]
+			minus[k] = theta[k] - opts.Sigma*eps[k]
+		}
+		noise[i] = eps
+		candidates = append(candidates, plus, minus)
+	}
+
+	fitness := make([]float64, len(candidates))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			candidate := copySupernet(net)
+			for i := range jobs {
+				fitness[i] = evaluate(candidate, candidates[i])
+			}
+		}()
+	}
+	for i := range candidates {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	ranks := centredRanks(fitness)
+	gradient := make([]float64, len(theta))
+	scale := 1 / (float64(opts.Pairs) * opts.Sigma)
+	for i, eps := range noise {
+		weight := (ranks[2*i] - ranks[2*i+1]) * scale
+		for k := range gradient {
+			gradient[k] += weight * eps[k]
+		}
+	}
+	return gradient
+}
+
+// processLayer runs a single layer the way Feedforward does; untyped layers pass the data through.
+func processLayer(layer Layer, data interface{}) interface{} {
+	switch layer.LayerType {
+	case "dense":
+		return processDenseLayer(layer, data)
+	case "conv":
+		return processConvLayer(layer, data)
+	case "lstm":
+		return processLSTMLayer(layer, data)
+	}
+	return data
+}
+
+// sampleBatch returns batchSize random samples, or all of them when batchSize is 0 or too large.
+func sampleBatch(samples []SupernetSample, batchSize int, rng *rand.Rand) []SupernetSample {
+	if batchSize <= 0 || batchSize >= len(samples) {
+		return samples
+	}
+	batch := make([]SupernetSample, batchSize)
+	for i := range batch {
+		batch[i] = samples[rng.Intn(len(samples))]
+	}
+	return batch
+}
+
+// negativeMSE is the default supernet fitness: minus the mean squared error over the target keys.
+func negativeMSE(outputs, targets map[string]float64) float64 {
+	if len(targets) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for key, target := range targets {
+		diff := outputs[key] - target
+		if math.IsNaN(diff) || math.IsInf(diff, 0) {
+			diff = 1e3
+		}
+		sum += diff * diff
+	}
+	return -sum / float64(len(targets))
+}
+
+// softmax turns logits into probabilities.
+func softmax(logits []float64) []float64 {
+	probs := make([]float64, len(logits))
+	if len(logits) == 0 {
+		return probs
+	}
+	maxLogit := logits[0]
+	for _, l := range logits {
+		maxLogit = math.Max(maxLogit, l)
+	}
+	sum := 0.0
+	for i, l := range logits {
+		probs[i] = math.Exp(l - maxLogit)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return probs
+}
+
+// randomDenseLayer creates a dense layer of width neurons named prefix1..prefixN (or prefix0.. for
+// outputs), fully connected to inputKeys with weights scaled by the fan-in.
+func randomDenseLayer(width int, prefix, activation string, inputKeys []string, rng *rand.Rand) Layer {
+	layer := Layer{LayerType: "dense", Neurons: make(map[string]Neuron, width)}
+	scale := 1.0
+	if len(inputKeys) > 0 {
+		scale = 1 / math.Sqrt(float64(len(inputKeys)))
+	}
+	first := 1
+	if prefix == "output" {
+		first = 0
+	}
+	for i := first; i < width+first; i++ {
+		neuron := Neuron{ActivationType: activation, Connections: make(map[string]Connection, len(inputKeys))}
+		for _, key := range inputKeys {
+			neuron.Connections[key] = Connection{Weight: rng.NormFloat64() * scale}
+		}
+		layer.Neurons[prefix+strconv.Itoa(i)] = neuron
+	}
+	return layer
+}
+
+// numberedKeys returns prefix0 .. prefix(n-1).
+func numberedKeys(prefix string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = prefix + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// scaledSlice returns n normally distributed values times scale.
+func scaledSlice(n int, scale float64, rng *rand.Rand) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = rng.NormFloat64() * scale
+	}
+	return values
+}
+
+// scaledMatrix returns a rows x cols matrix of normally distributed values times scale.
+func scaledMatrix(rows, cols int, scale float64, rng *rand.Rand) [][]float64 {
+	m := make([][]float64, rows)
+	for i := range m {
+		m[i] = scaledSlice(cols, scale, rng)
+	}
+	return m
+}
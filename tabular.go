@@ -0,0 +1,475 @@
+package dense
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Normalization methods of a tabular column.
+const (
+	NormalizeNone   = ""
+	NormalizeMinMax = "minmax" // (x - min) / (max - min)
+	NormalizeZScore = "zscore" // (x - mean) / std
+)
+
+// Missing value policies of a tabular column.
+const (
+	MissingMean  = "mean"  // Numeric columns get the training mean, categorical ones the most frequent category
+	MissingZero  = "zero"  // 0, or no category at all
+	MissingDrop  = "drop"  // The row is left out of the dataset
+	MissingError = "error" // Loading fails
+)
+
+// TabularColumn maps CSV columns to neurons.
+type TabularColumn struct {
+	Match       string `json:"match"`                 // Header name or path.Match pattern, like "pixel*"
+	Output      bool   `json:"output,omitempty"`      // Targets instead of inputs
+	Categorical bool   `json:"categorical,omitempty"` // One-hot encoded, one neuron per category seen while fitting
+	// Neuron names the neurons: "" keeps the column name (name_category for categories), a template with %d
+	// numbers the neurons of all columns and categories the mapping matches, like "input%d", and anything
+	// else is the ID of the single neuron of a numeric column.
+	Neuron    string `json:"neuron,omitempty"`
+	Normalize string `json:"normalize,omitempty"` // NormalizeNone, NormalizeMinMax or NormalizeZScore; numeric columns only
+	Missing   string `json:"missing,omitempty"`   // Missing value policy, MissingMean by default
+}
+
+// TabularFeature is a column fitted to the training data.
+type TabularFeature struct {
+	Column       string   `json:"column"`
+	Output       bool     `json:"output,omitempty"`
+	Neurons      []string `json:"neurons"`
+	Categorical  bool     `json:"categorical,omitempty"`
+	Categories   []string `json:"categories,omitempty"` // In neuron order
+	Normalize    string   `json:"normalize,omitempty"`
+	Missing      string   `json:"missing,omitempty"`
+	Min          float64  `json:"min"`
+	Max          float64  `json:"max"`
+	Mean         float64  `json:"mean"`
+	Std          float64  `json:"std"`
+	FillCategory string   `json:"fillCategory,omitempty"`
+}
+
+// TabularTransform turns CSV rows into inputs and targets. It holds the statistics fitted on the training
+// data, so test data and inference inputs are encoded and normalized the same way.
+type TabularTransform struct {
+	Features []TabularFeature `json:"features"`
+}
+
+// LoadTabularDataset reads a CSV file with a header, fits a transform for the columns to it and returns
+// the transformed rows. Columns no mapping matches are ignored; when a column matches several mappings the
+// first one wins. Rows are identified by the file's base name and their number, starting at 0 below the
+// header, e.g. "train_0", so datasets from different files can share a generation.
+func LoadTabularDataset(filePath string, columns []TabularColumn) (SliceDataset, *TabularTransform, error) {
+	header, rows, err := readTabularCSV(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	transform, err := FitTabularTransform(header, rows, columns)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataset, err := transform.apply(DatasetName(filePath), header, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataset, transform, nil
+}
+
+// Dataset reads another CSV file, such as a test set, with the fitted transform.
+func (t *TabularTransform) Dataset(filePath string) (SliceDataset, error) {
+	header, rows, err := readTabularCSV(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return t.apply(DatasetName(filePath), header, rows)
+}
+
+// readTabularCSV reads the header and rows of a CSV file.
+func readTabularCSV(filePath string) ([]string, [][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open CSV dataset: %w", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV dataset: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("CSV dataset %s has no header", filePath)
+	}
+	header := make([]string, len(records[0]))
+	for i, name := range records[0] {
+		header[i] = strings.TrimSpace(name)
+	}
+	return header, records[1:], nil
+}
+
+// FitTabularTransform fits the columns to the rows of a CSV file.
+func FitTabularTransform(header []string, rows [][]string, columns []TabularColumn) (*TabularTransform, error) {
+	for _, column := range columns {
+		if _, err := path.Match(column.Match, ""); err != nil {
+			return nil, fmt.Errorf("bad column pattern %q: %w", column.Match, err)
+		}
+		switch column.Normalize {
+		case NormalizeNone, NormalizeMinMax, NormalizeZScore:
+		default:
+			return nil, fmt.Errorf("unknown normalization %q", column.Normalize)
+		}
+		switch column.Missing {
+		case "", MissingMean, MissingZero, MissingDrop, MissingError:
+		default:
+			return nil, fmt.Errorf("unknown missing value policy %q", column.Missing)
+		}
+	}
+
+	transform := &TabularTransform{}
+	numbered := make([]int, len(columns)) // Neurons numbered so far per mapping
+	for col, name := range header {
+		m := matchTabularColumn(columns, name)
+		if m < 0 {
+			continue
+		}
+		column := columns[m]
+		feature := TabularFeature{Column: name, Output: column.Output, Categorical: column.Categorical, Normalize: column.Normalize, Missing: column.Missing}
+		if feature.Missing == "" {
+			feature.Missing = MissingMean
+		}
+
+		var err error
+		if column.Categorical {
+			err = feature.fitCategories(col, rows)
+		} else {
+			err = feature.fitNumbers(col, rows)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{""}
+		if column.Categorical {
+			names = feature.Categories
+		}
+		for _, category := range names {
+			feature.Neurons = append(feature.Neurons, tabularNeuron(column, name, category, numbered[m]))
+			numbered[m]++
+		}
+		transform.Features = append(transform.Features, feature)
+	}
+
+	seen := make(map[string]string)
+	for _, feature := range transform.Features {
+		for _, neuron := range feature.Neurons {
+			if other, ok := seen[neuron]; ok {
+				return nil, fmt.Errorf("columns %s and %s both map to neuron %s", other, feature.Column, neuron)
+			}
+			seen[neuron] = feature.Column
+		}
+	}
+	return transform, nil
+}
+
+// matchTabularColumn returns the first mapping matching a header name, or -1.
+func matchTabularColumn(columns []TabularColumn, name string) int {
+	for i, column := range columns {
+		if ok, _ := path.Match(column.Match, name); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// tabularNeuron names the neuron of a column or one of its categories.
+func tabularNeuron(column TabularColumn, name, category string, index int) string {
+	switch {
+	case strings.Contains(column.Neuron, "%d"):
+		return fmt.Sprintf(column.Neuron, index)
+	case column.Neuron != "" && !column.Categorical:
+		return column.Neuron
+	case category != "":
+		prefix := name
+		if column.Neuron != "" {
+			prefix = column.Neuron
+		}
+		return prefix + "_" + category
+	}
+	return name
+}
+
+// fitNumbers computes the range, mean and standard deviation of a numeric column.
+func (f *TabularFeature) fitNumbers(col int, rows [][]string) error {
+	var sum, sumSquares float64
+	n := 0
+	f.Min, f.Max = math.Inf(1), math.Inf(-1)
+	for row, record := range rows {
+		raw := tabularCell(record, col)
+		if missingTabularValue(raw) {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("row %d, column %s: %w", row+1, f.Column, err)
+		}
+		f.Min, f.Max = math.Min(f.Min, value), math.Max(f.Max, value)
+		sum += value
+		sumSquares += value * value
+		n++
+	}
+	if n == 0 {
+		f.Min, f.Max = 0, 0
+		return nil
+	}
+	f.Mean = sum / float64(n)
+	f.Std = math.Sqrt(math.Max(sumSquares/float64(n)-f.Mean*f.Mean, 0))
+	return nil
+}
+
+// fitCategories collects the categories of a column, in numeric order when they are all numbers, and
+// its most frequent category.
+func (f *TabularFeature) fitCategories(col int, rows [][]string) error {
+	if f.Normalize != NormalizeNone {
+		return fmt.Errorf("column %s is categorical and can't be normalized", f.Column)
+	}
+	counts := make(map[string]int)
+	for _, record := range rows {
+		if raw := tabularCell(record, col); !missingTabularValue(raw) {
+			counts[raw]++
+		}
+	}
+	f.Categories = sortedKeys(counts)
+	numeric := true
+	for _, category := range f.Categories {
+		if _, err := strconv.ParseFloat(category, 64); err != nil {
+			numeric = false
+			break
+		}
+	}
+	if numeric {
+		sort.SliceStable(f.Categories, func(i, j int) bool {
+			a, _ := strconv.ParseFloat(f.Categories[i], 64)
+			b, _ := strconv.ParseFloat(f.Categories[j], 64)
+			return a < b
+		})
+	}
+	for _, category := range f.Categories {
+		if f.FillCategory == "" || counts[category] > counts[f.FillCategory] {
+			f.FillCategory = category
+		}
+	}
+	return nil
+}
+
+// tabularCell returns a trimmed cell, "" when the row is short.
+func tabularCell(record []string, col int) string {
+	if col >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[col])
+}
+
+// missingTabularValue reports whether a cell holds no value.
+func missingTabularValue(raw string) bool {
+	switch strings.ToLower(raw) {
+	case "", "na", "n/a", "nan", "null", "?":
+		return true
+	}
+	return false
+}
+
+// apply transforms the rows of a CSV file with the given header. Samples get the ID <name>_<row>.
+func (t *TabularTransform) apply(name string, header []string, rows [][]string) (SliceDataset, error) {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, feature := range t.Features {
+		if _, ok := columns[feature.Column]; !ok {
+			return nil, fmt.Errorf("CSV dataset has no column %s", feature.Column)
+		}
+	}
+
+	dataset := make(SliceDataset, 0, len(rows))
+	for row, record := range rows {
+		values := make(map[string]string, len(t.Features))
+		for _, feature := range t.Features {
+			values[feature.Column] = tabularCell(record, columns[feature.Column])
+		}
+		inputs, targets, keep, err := t.transform(values, true)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row+1, err)
+		}
+		if keep {
+			dataset = append(dataset, Sample{ID: fmt.Sprintf("%s_%d", name, row), Inputs: func() map[string]interface{} { return inputs }, Targets: targets})
+		}
+	}
+	return dataset, nil
+}
+
+// Inputs transforms one row for inference, given as column name to value. Output columns are not needed.
+// A missing value the policy would drop the row for is an error here.
+func (t *TabularTransform) Inputs(values map[string]string) (map[string]interface{}, error) {
+	inputs, _, keep, err := t.transform(values, false)
+	if err != nil {
+		return nil, err
+	}
+	if !keep {
+		return nil, fmt.Errorf("row has a missing value and its column drops such rows")
+	}
+	return inputs, nil
+}
+
+// transform encodes one row. keep is false when a missing value drops the row.
+func (t *TabularTransform) transform(values map[string]string, withTargets bool) (inputs map[string]interface{}, targets map[string]float64, keep bool, err error) {
+	inputs = make(map[string]interface{})
+	targets = make(map[string]float64)
+	for _, feature := range t.Features {
+		if feature.Output && !withTargets {
+			continue
+		}
+		encoded, keep, err := feature.encode(strings.TrimSpace(values[feature.Column]))
+		if err != nil || !keep {
+			return nil, nil, keep, err
+		}
+		for i, neuron := range feature.Neurons {
+			if feature.Output {
+				targets[neuron] = encoded[i]
+			} else {
+				inputs[neuron] = encoded[i]
+			}
+		}
+	}
+	return inputs, targets, true, nil
+}
+
+// encode returns the neuron values of one cell.
+func (f *TabularFeature) encode(raw string) ([]float64, bool, error) {
+	missing := missingTabularValue(raw)
+	if missing {
+		switch f.Missing {
+		case MissingDrop:
+			return nil, false, nil
+		case MissingError:
+			return nil, false, fmt.Errorf("column %s has no value", f.Column)
+		}
+	}
+
+	if f.Categorical {
+		encoded := make([]float64, len(f.Neurons))
+		if missing && f.Missing == MissingZero {
+			return encoded, true, nil
+		}
+		if missing {
+			raw = f.FillCategory
+		}
+		for i, category := range f.Categories {
+			if category == raw {
+				encoded[i] = 1
+			}
+		}
+		return encoded, true, nil // Categories not seen while fitting encode as all zeros
+	}
+
+	var value float64
+	switch {
+	case missing && f.Missing == MissingZero:
+		return []float64{0}, true, nil // 0 after normalization, not before
+	case missing:
+		value = f.Mean
+	default:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("column %s: %w", f.Column, err)
+		}
+		value = parsed
+	}
+	return []float64{f.normalize(value)}, true, nil
+}
+
+// normalize applies the fitted normalization. Constant columns normalize to 0.
+func (f *TabularFeature) normalize(value float64) float64 {
+	switch f.Normalize {
+	case NormalizeMinMax:
+		if f.Max > f.Min {
+			return (value - f.Min) / (f.Max - f.Min)
+		}
+		return 0
+	case NormalizeZScore:
+		if f.Std > 0 {
+			return (value - f.Mean) / f.Std
+		}
+		return 0
+	}
+	return value
+}
+
+// denormalize undoes normalize.
+func (f *TabularFeature) denormalize(value float64) float64 {
+	switch f.Normalize {
+	case NormalizeMinMax:
+		return f.Min + value*(f.Max-f.Min)
+	case NormalizeZScore:
+		return f.Mean + value*f.Std
+	}
+	return value
+}
+
+// DecodeOutputs turns a model's outputs back into output column values: numeric columns are denormalized
+// and categorical ones get the category with the highest output.
+func (t *TabularTransform) DecodeOutputs(outputs map[string]float64) map[string]string {
+	decoded := make(map[string]string)
+	for _, feature := range t.Features {
+		if !feature.Output {
+			continue
+		}
+		if !feature.Categorical {
+			decoded[feature.Column] = strconv.FormatFloat(feature.denormalize(outputs[feature.Neurons[0]]), 'g', -1, 64)
+			continue
+		}
+		best := -1
+		for i, neuron := range feature.Neurons {
+			if best < 0 || outputs[neuron] > outputs[feature.Neurons[best]] {
+				best = i
+			}
+		}
+		if best >= 0 {
+			decoded[feature.Column] = feature.Categories[best]
+		}
+	}
+	return decoded
+}
+
+// TabularTransformPath is where the transform of a model is saved: next to the model file, with a
+// .tabular extension so generation scans don't take it for a model.
+func TabularTransformPath(modelFilePath string) string {
+	return strings.TrimSuffix(modelFilePath, ".json") + ".tabular"
+}
+
+// SaveTabularTransform saves the transform a model was trained with next to the model.
+func SaveTabularTransform(modelFilePath string, transform *TabularTransform) error {
+	data, err := json.MarshalIndent(transform, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tabular transform: %w", err)
+	}
+	return os.WriteFile(TabularTransformPath(modelFilePath), data, 0644)
+}
+
+// LoadTabularTransform reads the transform saved next to a model.
+func LoadTabularTransform(modelFilePath string) (*TabularTransform, error) {
+	data, err := os.ReadFile(TabularTransformPath(modelFilePath))
+	if err != nil {
+		return nil, err
+	}
+	var transform TabularTransform
+	if err := json.Unmarshal(data, &transform); err != nil {
+		return nil, fmt.Errorf("failed to decode tabular transform: %w", err)
+	}
+	return &transform, nil
+}
@@ -65,47 +65,42 @@ func writeData(writer *csv.Writer, numRows int) {
 	writer.Flush() // Flush the buffer
 }
 
-func loadTestData(filePath string) ([]dense.TestData, error) {
-	file, err := os.Open(filePath)
+// loadTestData maps input1..3 and output1..3 of data.csv to the neurons of the same name. The transform
+// normalizes new rows the same way at inference.
+func loadTestData(filePath string) (dense.SliceDataset, *dense.TabularTransform, error) {
+	return dense.LoadTabularDataset(filePath, []dense.TabularColumn{
+		{Match: "input*"},
+		{Match: "output*", Output: true},
+	})
+}
+
+// saveNetworkConfig saves the model along with the transform its inputs need.
+func saveNetworkConfig(config *dense.NetworkConfig, transform *dense.TabularTransform, filename string) error {
+	configJSON, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := os.WriteFile(filename, configJSON, 0644); err != nil {
+		return err
 	}
-	defer file.Close()
+	return dense.SaveTabularTransform(filename, transform)
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// predictRow runs a saved model on one raw CSV row, transformed with the transform saved next to it.
+func predictRow(filename string, row map[string]string) (map[string]string, error) {
+	config, err := dense.LoadModel(filename)
 	if err != nil {
 		return nil, err
 	}
-
-	var testData []dense.TestData
-	for _, record := range records[1:] { // skip headers
-		inputs := map[string]float64{
-			"input1": parseFloat(record[0]),
-			"input2": parseFloat(record[1]),
-			"input3": parseFloat(record[2]),
-		}
-		outputs := map[string]float64{
-			"output1": parseFloat(record[3]),
-			"output2": parseFloat(record[4]),
-			"output3": parseFloat(record[5]),
-		}
-		testData = append(testData, dense.TestData{Inputs: inputs, Outputs: outputs})
+	transform, err := dense.LoadTabularTransform(filename)
+	if err != nil {
+		return nil, err
 	}
-	return testData, nil
-}
-
-func parseFloat(value string) float64 {
-	result, _ := strconv.ParseFloat(value, 64)
-	return result
-}
-
-func saveNetworkConfig(config *dense.NetworkConfig, filename string) error {
-	configJSON, err := json.MarshalIndent(config, "", "  ")
+	inputs, err := transform.Inputs(row)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(filename, configJSON, 0644)
+	return transform.DecodeOutputs(dense.Feedforward(config, inputs)), nil
 }
 
 func logImprovement(iteration int, error float64, improvement float64) error {
@@ -124,11 +119,12 @@ func logImprovement(iteration int, error float64, improvement float64) error {
 	return nil
 }
 
-func evaluateNetwork(config *dense.NetworkConfig, testData []dense.TestData) float64 {
+func evaluateNetwork(config *dense.NetworkConfig, testData dense.Dataset) float64 {
 	totalError := 0.0
-	for _, data := range testData {
-		outputs := dense.Feedforward(config, data.Inputs)
-		for key, expected := range data.Outputs {
+	for i := 0; i < testData.Len(); i++ {
+		sample := testData.Sample(i)
+		outputs := dense.Feedforward(config, sample.Inputs())
+		for key, expected := range sample.Targets {
 			actual := outputs[key]
 			totalError += math.Abs(expected - actual)
 		}
@@ -138,20 +134,21 @@ func evaluateNetwork(config *dense.NetworkConfig, testData []dense.TestData) flo
 
 // Add new layers or neurons randomly to increase complexity
 func mutateNetwork(config *dense.NetworkConfig) {
-	rand.Seed(time.Now().UnixNano())
+	// Draw from the model's own seed so the mutation can be replayed
+	rng := dense.MutationRand(config)
 
 	// Randomly add a new neuron in an existing hidden layer
-	if rand.Float64() < 0.3 { // 30% chance to add a neuron
+	if rng.Float64() < 0.3 { // 30% chance to add a neuron
 		for i := range config.Layers.Hidden {
-			newNeuronID := fmt.Sprintf("new_neuron_%d", rand.Intn(1000))
+			newNeuronID := fmt.Sprintf("new_neuron_%d", rng.Intn(1000))
 			newNeuron := dense.Neuron{
 				ActivationType: "relu",
 				Connections:    make(map[string]dense.Connection),
-				Bias:           rand.NormFloat64(),
+				Bias:           rng.NormFloat64(),
 			}
 			for inputID := range config.Layers.Input.Neurons {
 				newNeuron.Connections[inputID] = dense.Connection{
-					Weight: rand.NormFloat64(),
+					Weight: rng.NormFloat64(),
 				}
 			}
 			config.Layers.Hidden[i].Neurons[newNeuronID] = newNeuron
@@ -160,22 +157,22 @@ func mutateNetwork(config *dense.NetworkConfig) {
 	}
 
 	// Randomly add a new hidden layer
-	if rand.Float64() < 0.2 { // 20% chance to add a new hidden layer
+	if rng.Float64() < 0.2 { // 20% chance to add a new hidden layer
 		newLayer := dense.Layer{
 			Neurons: map[string]dense.Neuron{},
 		}
-		for i := 0; i < rand.Intn(3)+1; i++ { // Add 1 to 3 neurons in this new layer
-			newNeuronID := fmt.Sprintf("new_hidden_neuron_%d", rand.Intn(1000))
+		for i := 0; i < rng.Intn(3)+1; i++ { // Add 1 to 3 neurons in this new layer
+			newNeuronID := fmt.Sprintf("new_hidden_neuron_%d", rng.Intn(1000))
 			newNeuron := dense.Neuron{
 				ActivationType: "relu",
 				Connections:    make(map[string]dense.Connection),
-				Bias:           rand.NormFloat64(),
+				Bias:           rng.NormFloat64(),
 			}
 			// Connect to previous layer's neurons
 			if len(config.Layers.Hidden) > 0 {
 				for prevNeuronID := range config.Layers.Hidden[len(config.Layers.Hidden)-1].Neurons {
 					newNeuron.Connections[prevNeuronID] = dense.Connection{
-						Weight: rand.NormFloat64(),
+						Weight: rng.NormFloat64(),
 					}
 				}
 			}
@@ -190,11 +187,11 @@ func mutateNetwork(config *dense.NetworkConfig) {
 			// Randomly tweak weights
 			for inputID := range neuron.Connections {
 				neuron.Connections[inputID] = dense.Connection{
-					Weight: neuron.Connections[inputID].Weight + rand.NormFloat64()*0.1,
+					Weight: neuron.Connections[inputID].Weight + rng.NormFloat64()*0.1,
 				}
 			}
 			// Randomly tweak biases
-			neuron.Bias += rand.NormFloat64() * 0.1
+			neuron.Bias += rng.NormFloat64() * 0.1
 			layer.Neurons[nodeID] = neuron
 		}
 	}
@@ -215,7 +212,7 @@ func test1main() {
 	createTestData(".")
 
 	// Step 2: Load the test data
-	testData, err := loadTestData("./data.csv")
+	testData, transform, err := loadTestData("./data.csv")
 	if err != nil {
 		fmt.Println("Error loading test data:", err)
 		return
@@ -229,7 +226,7 @@ func test1main() {
 	fmt.Printf("Initial Error: %f\n", bestError)
 
 	// Step 5: Save the initial network configuration
-	err = saveNetworkConfig(config, "initial_network.json")
+	err = saveNetworkConfig(config, transform, "initial_network.json")
 	if err != nil {
 		fmt.Println("Error saving network configuration:", err)
 		return
@@ -275,7 +272,7 @@ func test1main() {
 			fmt.Printf("Iteration %d: Improved Error: %f (Improvement: %.2f%%)\n", i, bestError, improvement)
 
 			// Save the improved network configuration
-			err = saveNetworkConfig(config, fmt.Sprintf("network_iteration_%d.json", i))
+			err = saveNetworkConfig(config, transform, fmt.Sprintf("network_iteration_%d.json", i))
 			if err != nil {
 				fmt.Println("Error saving network configuration:", err)
 				return
@@ -299,5 +296,17 @@ func test1main() {
 	}
 
 	fmt.Printf("Final Best Error: %f\n", bestError)
+
+	// Step 7: Run the saved network on a raw row, as it would be on new data
+	if err := saveNetworkConfig(config, transform, "best_network.json"); err != nil {
+		fmt.Println("Error saving network configuration:", err)
+		return
+	}
+	outputs, err := predictRow("best_network.json", map[string]string{"input1": "5", "input2": "6", "input3": "7"})
+	if err != nil {
+		fmt.Println("Error running the saved network:", err)
+		return
+	}
+	fmt.Println("Outputs for 5, 6, 7:", outputs)
 }
 */
\ No newline at end of file
@@ -249,105 +249,94 @@ func LoadCSVLayerState(filePath string, inputID string) interface{} {
 
 
 
-// SaveShardedLayerState saves the layer state for each input as a separate file (shard) in a dedicated folder.
-func SaveShardedLayerState(data interface{}, modelFilePath string, layerIndex int, inputID string) {
-    // Create a folder for storing shards for the given layer
-    dir, file := filepath.Split(modelFilePath)
-    modelName := strings.TrimSuffix(file, filepath.Ext(file))
-    layerShardFolder := filepath.Join(dir, modelName, fmt.Sprintf("layer_%d_shards", layerIndex))
-    
-    // Create the directory if it doesn't exist
-    os.MkdirAll(layerShardFolder, os.ModePerm)
-
-    // Define the CSV file name for the specific input ID shard
-    fileName := filepath.Join(layerShardFolder, fmt.Sprintf("input_%s.csv", inputID))
+// SaveShardedLayerState saves the layer state of one input in the packed shard file of the model's layer.
+func SaveShardedLayerState(data interface{}, modelFilePath string, layerIndex int, inputID string) error {
+    return withShardStore(LayerShardPath(modelFilePath, layerIndex), true, func(store *ShardStore) error {
+        return store.Put(inputID, data)
+    })
+}
 
-    // Save the state for this input to a CSV file
-    fileHandle, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// LoadShardedLayerState loads the saved layer state of one input, from the model's own packed shard file
+// or from the activation cache shard its layer refers to.
+func LoadShardedLayerState(modelFilePath string, layerIndex int, inputID string) (interface{}, error) {
+    path, err := resolveLayerShard(modelFilePath, layerIndex)
     if err != nil {
-        panic(err)
-    }
-    defer fileHandle.Close()
-
-    writer := csv.NewWriter(fileHandle)
-
-    // Write data to the CSV file based on the type of `data`
-    switch v := data.(type) {
-    case map[string]float64:
-        for key, value := range v {
-            record := []string{inputID, key, strconv.FormatFloat(value, 'g', -1, 64)}
-            writer.Write(record)
-        }
-
-    case [][]float64:
-        for _, row := range v {
-            var record []string
-            record = append(record, inputID)
-            for _, value := range row {
-                record = append(record, strconv.FormatFloat(value, 'g', -1, 64))
-            }
-            writer.Write(record)
-        }
-
-    case [][][]float64:
-        for _, image := range v {
-            for _, row := range image {
-                var record []string
-                record = append(record, inputID)
-                for _, value := range row {
-                    record = append(record, strconv.FormatFloat(value, 'g', -1, 64))
-                }
-                writer.Write(record)
-            }
-        }
+        return nil, err
     }
-
-    // Flush the writer to ensure everything is written properly, including newlines.
-    writer.Flush()
-
-    // Check for any error that occurred during writing or flushing
-    if err := writer.Error(); err != nil {
-        panic(err)
+    var state interface{}
+    err = withShardStore(path, false, func(store *ShardStore) (err error) {
+        state, err = store.Get(inputID)
+        return err
+    })
+    if err != nil {
+        return nil, err
     }
+    return state, nil
 }
 
-
-
-// LoadShardedLayerState loads the saved layer state for a specific inputID shard from a CSV file.
-func LoadShardedLayerState(modelFilePath string, layerIndex int, inputID string) interface{} {
-    // Define the path to the shard for this input
-    dir, fileName := filepath.Split(modelFilePath)
-    modelName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-    layerShardFolder := filepath.Join(dir, modelName, fmt.Sprintf("layer_%d_shards", layerIndex))
-    shardFilePath := filepath.Join(layerShardFolder, fmt.Sprintf("input_%s.csv", inputID))
-    //fmt.Println("shard",shardFilePath)
-    // Open the shard file
-    fileHandle, err := os.Open(shardFilePath)
+// readCSVShard reads a per-input CSV shard as written before the packed format: (inputID, key, value)
+// rows for map states, or (inputID, values...) rows for [][]float64 states. [][][]float64 states were
+// written as the rows of all images one after another, so they come back as a single [][]float64 that
+// can't be told apart from an image; MigrateCSVShards checks the model before keeping one.
+func readCSVShard(filePath string, inputID string) (interface{}, error) {
+    file, err := os.Open(filePath)
     if err != nil {
-        panic(err)
+        return nil, fmt.Errorf("failed to open CSV shard: %w", err)
     }
-    defer fileHandle.Close()
+    defer file.Close()
 
-    reader := csv.NewReader(fileHandle)
+    reader := csv.NewReader(file)
+    reader.FieldsPerRecord = -1
     records, err := reader.ReadAll()
     if err != nil {
-        panic(err)
+        return nil, fmt.Errorf("failed to read CSV shard: %w", err)
+    }
+    for _, record := range records {
+        if len(record) == 0 || record[0] != inputID {
+            return nil, fmt.Errorf("row %v does not belong to input %s", record, inputID)
+        }
     }
 
-    // Assuming the saved layer state is a map[string]float64
-    savedLayerState := make(map[string]float64)
+    // Map keys are neuron IDs, so a row whose second field isn't a number is a key/value row
+    isMap := len(records) > 0
     for _, record := range records {
-        if len(record) >= 3 && record[0] == inputID {
-            key := record[1]
+        if len(record) != 3 {
+            isMap = false
+            break
+        }
+    }
+    if isMap {
+        isMap = false
+        for _, record := range records {
+            if _, err := strconv.ParseFloat(record[1], 64); err != nil {
+                isMap = true
+                break
+            }
+        }
+    }
+
+    if isMap {
+        state := make(map[string]float64, len(records))
+        for _, record := range records {
             value, err := strconv.ParseFloat(record[2], 64)
             if err != nil {
-                panic(err)
+                return nil, fmt.Errorf("failed to parse value of %s: %w", record[1], err)
             }
-            savedLayerState[key] = value
+            state[record[1]] = value
         }
+        return state, nil
     }
 
-    return savedLayerState
+    rows := make([][]float64, len(records))
+    for i, record := range records {
+        rows[i] = make([]float64, len(record)-1)
+        for j, field := range record[1:] {
+            if rows[i][j], err = strconv.ParseFloat(field, 64); err != nil {
+                return nil, fmt.Errorf("failed to parse row %d: %w", i, err)
+            }
+        }
+    }
+    return rows, nil
 }
 
 